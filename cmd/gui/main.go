@@ -5,11 +5,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 
 	"myproxy.com/p/internal/config"
 	"myproxy.com/p/internal/database"
 	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/server"
 	"myproxy.com/p/internal/ui"
 )
 
@@ -27,6 +27,11 @@ func main() {
 	}
 	defer database.CloseDB()
 
+	// 旧版本的服务器 ID 混入了时间戳，按连接参数重新生成（只执行一次）
+	if _, err := server.MigrateServerIDs(); err != nil {
+		log.Printf("迁移服务器 ID 失败: %v", err)
+	}
+
 	// 从数据库加载配置，如果不存在则从 JSON 文件加载并迁移
 	cfg, err := loadConfigFromDB(configPath)
 	if err != nil {
@@ -61,6 +66,14 @@ func main() {
 
 	// 设置logger到appState
 	appState.Logger = logger
+	appState.SubscriptionManager.SetLogger(logger)
+	appState.PingManager.SetLogger(logger)
+
+	// 启动故障转移监控（未启用时不做任何操作）
+	appState.StartFailoverMonitor()
+
+	// 启动订阅自动更新调度
+	appState.StartSubscriptionScheduler()
 
 	// Logger初始化后，启动日志文件监控（用于监控xray日志等直接从文件写入的日志）
 	if appState.LogsPanel != nil {
@@ -88,7 +101,7 @@ func main() {
 		// 保存布局配置到数据库
 		mainWindow.SaveLayoutConfig()
 		// 保存应用配置到数据库
-		if err := saveConfigToDB(cfg); err != nil {
+		if err := database.SaveAppSettings(cfg); err != nil {
 			log.Printf("保存配置到数据库失败: %v", err)
 		}
 		// 隐藏窗口而不是关闭（Fyne 会自动处理 Dock 图标点击显示窗口）
@@ -104,63 +117,29 @@ func main() {
 
 // loadConfigFromDB 从数据库加载配置，如果不存在则从 JSON 文件加载并迁移到数据库。
 func loadConfigFromDB(configPath string) (*config.Config, error) {
-	// 尝试从数据库加载配置
-	logLevel, _ := database.GetAppConfigWithDefault("logLevel", "")
-	logFile, _ := database.GetAppConfigWithDefault("logFile", "")
-	autoProxyEnabledStr, _ := database.GetAppConfigWithDefault("autoProxyEnabled", "")
-	autoProxyPortStr, _ := database.GetAppConfigWithDefault("autoProxyPort", "")
-
-	// 如果数据库中有配置，使用数据库配置
-	if logLevel != "" || logFile != "" || autoProxyEnabledStr != "" || autoProxyPortStr != "" {
-		cfg := config.DefaultConfig()
-		if logLevel != "" {
-			cfg.LogLevel = logLevel
-		}
-		if logFile != "" {
-			cfg.LogFile = logFile
-		}
-		if autoProxyEnabledStr != "" {
-			if enabled, err := strconv.ParseBool(autoProxyEnabledStr); err == nil {
-				cfg.AutoProxyEnabled = enabled
-			}
-		}
-		if autoProxyPortStr != "" {
-			// 允许任意端口值，不进行有效性检查（用户可根据实际情况选择端口）
-			if port, err := strconv.Atoi(autoProxyPortStr); err == nil {
-				cfg.AutoProxyPort = port
-			}
-		}
+	// 如果数据库中有任一配置项，使用数据库配置（未保存的项使用默认值）
+	cfg, invalid, err := database.LoadAppSettings()
+	if err != nil {
+		return nil, err
+	}
+	for key, err := range invalid {
+		log.Printf("解析配置 %s 失败: %v", key, err)
+	}
+	if cfg != nil {
 		return cfg, nil
 	}
 
 	// 数据库中没有配置，从 JSON 文件加载（向后兼容）
-	cfg, err := config.LoadConfig(configPath)
+	cfg, err = config.LoadConfig(configPath)
 	if err != nil {
 		return nil, err
 	}
 
 	// 将配置迁移到数据库
-	if err := saveConfigToDB(cfg); err != nil {
+	if err := database.SaveAppSettings(cfg); err != nil {
 		log.Printf("迁移配置到数据库失败: %v", err)
 		// 即使迁移失败，也返回配置，保证应用可以启动
 	}
 
 	return cfg, nil
 }
-
-// saveConfigToDB 将配置保存到数据库。
-func saveConfigToDB(cfg *config.Config) error {
-	if err := database.SetAppConfig("logLevel", cfg.LogLevel); err != nil {
-		return err
-	}
-	if err := database.SetAppConfig("logFile", cfg.LogFile); err != nil {
-		return err
-	}
-	if err := database.SetAppConfig("autoProxyEnabled", strconv.FormatBool(cfg.AutoProxyEnabled)); err != nil {
-		return err
-	}
-	if err := database.SetAppConfig("autoProxyPort", strconv.Itoa(cfg.AutoProxyPort)); err != nil {
-		return err
-	}
-	return nil
-}
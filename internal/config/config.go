@@ -2,9 +2,13 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 )
 
 // Server 表示一个代理服务器的配置信息。
@@ -16,9 +20,10 @@ type Server struct {
 	Username         string `json:"username"`          // 认证用户名
 	Password         string `json:"password"`          // 认证密码
 	Delay            int    `json:"delay"`             // 延迟（毫秒）
+	SpeedMbps        float64 `json:"speed_mbps,omitempty"` // 下载速度（Mbps），0 表示未测速，-1 表示测速失败
 	Selected         bool   `json:"selected"`          // 是否被选中
 	Enabled          bool   `json:"enabled"`           // 是否启用
-	ProtocolType     string `json:"protocol_type"`     // 协议类型: vmess, ss, ssr, socks5, etc.
+	ProtocolType     string `json:"protocol_type"`     // 协议类型: vmess, vless, ss, ssr, trojan, socks5, http, etc.
 	
 	// VMess 协议字段
 	VMessVersion     string `json:"vmess_version,omitempty"`     // VMess 版本 (v)
@@ -30,6 +35,8 @@ type Server struct {
 	VMessHost        string `json:"vmess_host,omitempty"`        // VMess 伪装域名 (host)
 	VMessPath        string `json:"vmess_path,omitempty"`        // VMess 路径 (path)
 	VMessTLS         string `json:"vmess_tls,omitempty"`         // VMess TLS 配置 (tls): "", "tls"
+	VMessSNI         string `json:"vmess_sni,omitempty"`         // VMess TLS SNI (sni)，为空时使用伪装域名
+	VMessAllowInsecure bool  `json:"vmess_allow_insecure,omitempty"` // VMess 是否允许不安全连接 (skip-cert-verify)
 	
 	// Shadowsocks 协议字段
 	SSMethod         string `json:"ss_method,omitempty"`         // Shadowsocks 加密方法
@@ -47,7 +54,30 @@ type Server struct {
 	TrojanSNI         string `json:"trojan_sni,omitempty"`        // Trojan SNI
 	TrojanAlpn        string `json:"trojan_alpn,omitempty"`       // Trojan ALPN
 	TrojanAllowInsecure bool  `json:"trojan_allow_insecure,omitempty"` // Trojan 是否允许不安全连接
-	
+	TrojanNetwork     string `json:"trojan_network,omitempty"`    // Trojan 传输协议: "", tcp, ws, grpc
+	TrojanHost        string `json:"trojan_host,omitempty"`       // Trojan 伪装域名 (ws Host)
+	TrojanPath        string `json:"trojan_path,omitempty"`       // Trojan 路径 (ws path)，gRPC 时为 serviceName
+
+	// VLESS 协议字段
+	VLESSUUID          string `json:"vless_uuid,omitempty"`           // VLESS UUID (id)
+	VLESSFlow          string `json:"vless_flow,omitempty"`           // VLESS 流控 (flow): "", xtls-rprx-vision
+	VLESSEncryption    string `json:"vless_encryption,omitempty"`     // VLESS 加密方式 (encryption)，通常为 none
+	VLESSSecurity      string `json:"vless_security,omitempty"`       // VLESS 传输层安全 (security): "", none, tls, reality
+	VLESSNetwork       string `json:"vless_network,omitempty"`        // VLESS 传输协议 (type): tcp, ws, grpc, httpupgrade, xhttp
+	VLESSHeaderType    string `json:"vless_header_type,omitempty"`    // VLESS 伪装类型 (headerType): none, http
+	VLESSHost          string `json:"vless_host,omitempty"`           // VLESS 伪装域名 (host)
+	VLESSPath          string `json:"vless_path,omitempty"`           // VLESS 路径 (path)，gRPC 时为 serviceName
+	VLESSSNI           string `json:"vless_sni,omitempty"`            // VLESS TLS/REALITY SNI (sni)
+	VLESSFingerprint   string `json:"vless_fingerprint,omitempty"`    // VLESS uTLS 指纹 (fp)
+	VLESSAlpn          string `json:"vless_alpn,omitempty"`           // VLESS ALPN，逗号分隔 (alpn)
+	VLESSAllowInsecure bool   `json:"vless_allow_insecure,omitempty"` // VLESS 是否允许不安全连接 (allowInsecure)
+	VLESSPublicKey     string `json:"vless_public_key,omitempty"`     // REALITY 公钥 (pbk)
+	VLESSShortID       string `json:"vless_short_id,omitempty"`       // REALITY ShortId (sid)
+	VLESSSpiderX       string `json:"vless_spider_x,omitempty"`       // REALITY SpiderX (spx)
+
+	// 链式代理：经由前置节点连接本节点（前置节点也可以有自己的前置节点）
+	UpstreamID string `json:"upstream_id,omitempty"` // 前置节点 ID，为空表示直接连接
+
 	// 原始配置 JSON（用于存储完整的协议配置，便于未来扩展）
 	RawConfig        string `json:"raw_config,omitempty"`        // 原始配置 JSON 字符串
 }
@@ -59,22 +89,89 @@ type Config struct {
 	SelectedServerID         string   `json:"selectedServerID"`         // 当前选中的服务器ID
 	SelectedSubscriptionID   int64    `json:"selectedSubscriptionID"`   // 当前选中的订阅ID，0表示全部
 	AutoProxyEnabled         bool     `json:"autoProxyEnabled"`         // 自动代理是否启用
-	AutoProxyPort            int      `json:"autoProxyPort"`            // 自动代理监听端口
+	AutoProxyPort            int      `json:"autoProxyPort"`            // 本地 SOCKS5 监听端口（同时接受 HTTP 代理请求，即混合端口）
+	HTTPPort                 int      `json:"httpPort"`                 // 独立的 HTTP 代理端口，0 表示仅使用混合端口
+	ListenAddr               string   `json:"listenAddr"`               // 本地监听地址: 127.0.0.1（仅本机）或 0.0.0.0（局域网共享）
+	PortFallback             bool     `json:"portFallback"`             // 端口被占用时是否自动选择空闲端口
 	LogLevel                 string   `json:"logLevel"`                 // 日志级别
 	LogFile                  string   `json:"logFile"`                  // 日志文件路径
+	RoutingMode              string   `json:"routingMode"`              // 路由模式: direct, global, smart
+	InboundAccounts          []InboundAccount `json:"inboundAccounts,omitempty"` // 本地入站认证账户，为空表示不认证
+	AllowedSources           []string         `json:"allowedSources,omitempty"`  // 允许访问本地入站的来源 IP/CIDR，为空表示不限制
+	BalancerEnabled          bool             `json:"balancerEnabled"`           // 是否对当前订阅的全部启用节点做负载均衡
+	BalancerStrategy         string           `json:"balancerStrategy"`          // 负载均衡策略: random, roundRobin, leastPing, leastLoad
+	FailoverEnabled          bool             `json:"failoverEnabled"`           // 当前节点不可用时是否自动切换节点
+	FailoverInterval         int              `json:"failoverInterval"`          // 健康检查间隔（秒）
+	FailoverThreshold        int              `json:"failoverThreshold"`         // 连续失败多少次后切换节点
+	FailoverCooldown         int              `json:"failoverCooldown"`          // 两次自动切换之间的最小间隔（秒）
+	PingMode                 string           `json:"pingMode"`                  // 测速模式: tcp, url
+	PingTestURL              string           `json:"pingTestURL,omitempty"`     // URL 测速的目标地址，为空时使用默认地址
+	PingConcurrency          int              `json:"pingConcurrency"`           // 批量测速的并发数
+	PingTimeout              int              `json:"pingTimeout"`               // 单个服务器的测速超时（秒）
+	LatencyHistorySize       int              `json:"latencyHistorySize"`        // 延迟统计使用的最近采样数（同时是每个服务器保留的采样数）
+	LatencyHistoryHours      int              `json:"latencyHistoryHours"`       // 延迟统计的时间范围（小时），更早的采样会被清理
+	SpeedTestURL             string           `json:"speedTestURL,omitempty"`    // 下载测速的文件地址，为空时使用默认地址
+	SpeedTestMaxMB           int              `json:"speedTestMaxMB"`            // 单个服务器下载测速的数据量上限（MB）
+	SpeedTestSeconds         int              `json:"speedTestSeconds"`          // 单个服务器下载测速的时长上限（秒）
 }
 
+// 负载均衡策略常量定义（与 xray 的 balancer strategy 类型一致）
+const (
+	BalancerStrategyRandom     = "random"     // 随机选择
+	BalancerStrategyRoundRobin = "roundRobin" // 轮询
+	BalancerStrategyLeastPing  = "leastPing"  // 延迟最低
+	BalancerStrategyLeastLoad  = "leastLoad"  // 负载最低（综合延迟和稳定性）
+)
+
+// InboundAccount 本地入站（SOCKS5/HTTP）认证账户
+type InboundAccount struct {
+	User string `json:"user"` // 用户名
+	Pass string `json:"pass"` // 密码
+}
+
+// 本地监听默认值
+const (
+	DefaultProxyPort  = 10080       // 默认本地混合端口
+	DefaultListenAddr = "127.0.0.1" // 默认仅监听本机
+)
+
+// 路由模式常量定义
+const (
+	RoutingModeDirect = "direct" // 直连：所有流量直接连接
+	RoutingModeGlobal = "global" // 全局：除局域网外所有流量走代理
+	RoutingModeSmart  = "smart"  // 智能：局域网和国内流量直连，其他走代理
+)
+
+// 测速模式常量定义
+const (
+	PingModeTCP = "tcp" // TCP 连接测速：只测量与服务器建立 TCP 连接的时间
+	PingModeURL = "url" // URL 测速：经由节点访问测试地址，验证协议、认证和 TLS 是否可用
+)
+
 // DefaultConfig 返回默认的应用配置。
+// 新安装默认使用智能路由，旧版本的配置缺少路由模式时按全局模式处理（见 database.LoadAppSettings）。
 // 返回：包含默认值的配置实例
 func DefaultConfig() *Config {
 	return &Config{
 		AutoProxyEnabled:       false,
-		AutoProxyPort:          1080,
+		AutoProxyPort:          DefaultProxyPort,
+		ListenAddr:             DefaultListenAddr,
 		LogLevel:               "info",
 		LogFile:                "myproxy.log",
 		Servers:                []Server{},
 		SelectedServerID:       "",
 		SelectedSubscriptionID: 0, // 默认显示全部订阅的服务器
+		RoutingMode:            RoutingModeSmart,
+		FailoverInterval:       30,
+		FailoverThreshold:      3,
+		FailoverCooldown:       300,
+		PingMode:               PingModeTCP,
+		PingConcurrency:        16,
+		PingTimeout:            5,
+		LatencyHistorySize:     20,
+		LatencyHistoryHours:    24,
+		SpeedTestMaxMB:         50,
+		SpeedTestSeconds:       10,
 	}
 }
 
@@ -147,6 +244,49 @@ func SaveConfig(config *Config, filePath string) error {
 	return nil
 }
 
+// Settings 返回只包含设置项的配置副本。
+// 服务器列表和选中的服务器由 ServerManager 加锁维护，副本中不包含这两项，可用于修改设置前的校验。
+func (c *Config) Settings() Config {
+	var s Config
+	copySettings(&s, c)
+	return s
+}
+
+// ApplySettings 写入 s 中的设置项，服务器列表和选中的服务器保持不变
+func (c *Config) ApplySettings(s *Config) {
+	copySettings(c, s)
+}
+
+// copySettings 复制除服务器列表和选中的服务器以外的全部字段
+func copySettings(dst, src *Config) {
+	dst.SelectedSubscriptionID = src.SelectedSubscriptionID
+	dst.AutoProxyEnabled = src.AutoProxyEnabled
+	dst.AutoProxyPort = src.AutoProxyPort
+	dst.HTTPPort = src.HTTPPort
+	dst.ListenAddr = src.ListenAddr
+	dst.PortFallback = src.PortFallback
+	dst.LogLevel = src.LogLevel
+	dst.LogFile = src.LogFile
+	dst.RoutingMode = src.RoutingMode
+	dst.InboundAccounts = slices.Clone(src.InboundAccounts)
+	dst.AllowedSources = slices.Clone(src.AllowedSources)
+	dst.BalancerEnabled = src.BalancerEnabled
+	dst.BalancerStrategy = src.BalancerStrategy
+	dst.FailoverEnabled = src.FailoverEnabled
+	dst.FailoverInterval = src.FailoverInterval
+	dst.FailoverThreshold = src.FailoverThreshold
+	dst.FailoverCooldown = src.FailoverCooldown
+	dst.PingMode = src.PingMode
+	dst.PingTestURL = src.PingTestURL
+	dst.PingConcurrency = src.PingConcurrency
+	dst.PingTimeout = src.PingTimeout
+	dst.LatencyHistorySize = src.LatencyHistorySize
+	dst.LatencyHistoryHours = src.LatencyHistoryHours
+	dst.SpeedTestURL = src.SpeedTestURL
+	dst.SpeedTestMaxMB = src.SpeedTestMaxMB
+	dst.SpeedTestSeconds = src.SpeedTestSeconds
+}
+
 // Validate 验证配置的有效性。
 // 该方法会检查日志级别、端口范围和服务器配置的合法性。
 // 返回：如果配置无效则返回错误，否则返回 nil
@@ -163,8 +303,73 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("无效的日志级别: %s", c.LogLevel)
 	}
 
+	// 检查路由模式（为空时按默认模式处理）
+	switch c.RoutingMode {
+	case "", RoutingModeDirect, RoutingModeGlobal, RoutingModeSmart:
+	default:
+		return fmt.Errorf("无效的路由模式: %s", c.RoutingMode)
+	}
+
 	// 注意：自动代理端口不进行有效性检查，允许用户根据实际情况选择任意端口
 
+	// 检查 HTTP 端口和监听地址
+	if c.HTTPPort < 0 || c.HTTPPort > 65535 {
+		return fmt.Errorf("无效的 HTTP 端口: %d", c.HTTPPort)
+	}
+	if c.ListenAddr != "" && net.ParseIP(c.ListenAddr) == nil {
+		return fmt.Errorf("无效的监听地址: %s", c.ListenAddr)
+	}
+
+	// 检查负载均衡策略
+	switch c.BalancerStrategy {
+	case "", BalancerStrategyRandom, BalancerStrategyRoundRobin, BalancerStrategyLeastPing, BalancerStrategyLeastLoad:
+	default:
+		return fmt.Errorf("无效的负载均衡策略: %s", c.BalancerStrategy)
+	}
+
+	// 检查测速模式和测试地址
+	switch c.PingMode {
+	case "", PingModeTCP, PingModeURL:
+	default:
+		return fmt.Errorf("无效的测速模式: %s", c.PingMode)
+	}
+	if c.PingTestURL != "" {
+		if u, err := url.Parse(c.PingTestURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的测速地址: %s", c.PingTestURL)
+		}
+	}
+	if c.PingConcurrency < 0 || c.PingTimeout < 0 {
+		return fmt.Errorf("测速并发数和超时不能为负数")
+	}
+	if c.LatencyHistorySize < 0 || c.LatencyHistoryHours < 0 {
+		return fmt.Errorf("延迟历史参数不能为负数")
+	}
+	if c.SpeedTestURL != "" {
+		if u, err := url.Parse(c.SpeedTestURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的下载测速地址: %s", c.SpeedTestURL)
+		}
+	}
+	if c.SpeedTestMaxMB < 0 || c.SpeedTestSeconds < 0 {
+		return fmt.Errorf("下载测速参数不能为负数")
+	}
+
+	// 检查故障转移参数（0 表示使用默认值）
+	if c.FailoverInterval < 0 || c.FailoverThreshold < 0 || c.FailoverCooldown < 0 {
+		return fmt.Errorf("故障转移参数不能为负数")
+	}
+
+	// 检查入站认证账户和来源白名单
+	for i, account := range c.InboundAccounts {
+		if account.User == "" || account.Pass == "" {
+			return fmt.Errorf("入站账户 %d 的用户名和密码不能为空", i)
+		}
+	}
+	for _, source := range c.AllowedSources {
+		if !IsValidSource(source) {
+			return fmt.Errorf("无效的来源地址: %s", source)
+		}
+	}
+
 	// 检查服务器列表（如果存在）
 	for i, server := range c.Servers {
 		if server.ID == "" {
@@ -178,6 +383,11 @@ func (c *Config) Validate() error {
 		if server.Port <= 0 || server.Port > 65535 {
 			return fmt.Errorf("服务器 %s 的端口无效: %d", server.ID, server.Port)
 		}
+		if server.UpstreamID != "" {
+			if _, err := ResolveChain(c.Servers, server.ID); errors.Is(err, ErrChainCycle) {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -201,6 +411,12 @@ func (c *Config) RemoveServer(id string) error {
 	for i, s := range c.Servers {
 		if s.ID == id {
 			c.Servers = append(c.Servers[:i], c.Servers[i+1:]...)
+			// 以该服务器为前置节点的服务器改为直接连接
+			for j := range c.Servers {
+				if c.Servers[j].UpstreamID == id {
+					c.Servers[j].UpstreamID = ""
+				}
+			}
 			// 如果删除的是选中的服务器，重置选中服务器
 			if c.SelectedServerID == id {
 				c.SelectedServerID = ""
@@ -258,3 +474,67 @@ func (c *Config) GetSelectedServer() (*Server, error) {
 
 	return nil, fmt.Errorf("没有选中的服务器")
 }
+
+// ErrChainCycle 前置节点链中存在循环引用
+var ErrChainCycle = errors.New("前置节点存在循环引用")
+
+// ResolveChain 解析服务器的前置节点链。
+// 返回的列表从目标服务器的直接前置节点开始依次向外，最后一个为由本机直接连接的入口节点；
+// 没有前置节点时返回空列表。前置节点不存在或存在循环引用时返回错误。
+func ResolveChain(servers []Server, id string) ([]*Server, error) {
+	byID := make(map[string]*Server, len(servers))
+	for i := range servers {
+		byID[servers[i].ID] = &servers[i]
+	}
+
+	current, ok := byID[id]
+	if !ok {
+		return nil, fmt.Errorf("服务器不存在: %s", id)
+	}
+
+	visited := map[string]bool{id: true}
+	var chain []*Server
+	for current.UpstreamID != "" {
+		if visited[current.UpstreamID] {
+			return nil, fmt.Errorf("%w: %s", ErrChainCycle, current.UpstreamID)
+		}
+		upstream, ok := byID[current.UpstreamID]
+		if !ok {
+			return nil, fmt.Errorf("服务器 %s 的前置节点不存在: %s", current.Name, current.UpstreamID)
+		}
+		visited[upstream.ID] = true
+		chain = append(chain, upstream)
+		current = upstream
+	}
+	return chain, nil
+}
+
+// ResolveChain 解析当前配置中指定服务器的前置节点链（见 ResolveChain 函数）
+func (c *Config) ResolveChain(id string) ([]*Server, error) {
+	return ResolveChain(c.Servers, id)
+}
+
+// IsValidSource 检查来源地址是否为合法的 IP 或 CIDR
+func IsValidSource(source string) bool {
+	if net.ParseIP(source) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(source)
+	return err == nil
+}
+
+// GetProxyPort 获取本地混合端口，未设置时返回默认端口
+func (c *Config) GetProxyPort() int {
+	if c.AutoProxyPort <= 0 || c.AutoProxyPort > 65535 {
+		return DefaultProxyPort
+	}
+	return c.AutoProxyPort
+}
+
+// GetListenAddr 获取本地监听地址，未设置时返回默认地址
+func (c *Config) GetListenAddr() string {
+	if c.ListenAddr == "" {
+		return DefaultListenAddr
+	}
+	return c.ListenAddr
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"myproxy.com/p/internal/config"
+)
+
+// legacyProxyPort 旧版本配置的默认本地端口，升级前未保存端口的配置沿用该值
+const legacyProxyPort = 1080
+
+// appSetting 应用设置项与 app_config 表键名的对应关系
+type appSetting struct {
+	key string
+	get func(c *config.Config) (string, error)
+	set func(c *config.Config, value string) error // value 非空时调用
+}
+
+// appSettings 保存到 app_config 表的全部应用设置项，保存和加载共用
+var appSettings = []appSetting{
+	stringSetting("logLevel", func(c *config.Config) *string { return &c.LogLevel }),
+	stringSetting("logFile", func(c *config.Config) *string { return &c.LogFile }),
+	boolSetting("autoProxyEnabled", func(c *config.Config) *bool { return &c.AutoProxyEnabled }),
+	intSetting("autoProxyPort", func(c *config.Config) *int { return &c.AutoProxyPort }),
+	stringSetting("routingMode", func(c *config.Config) *string { return &c.RoutingMode }),
+	stringSetting("listenAddr", func(c *config.Config) *string { return &c.ListenAddr }),
+	intSetting("httpPort", func(c *config.Config) *int { return &c.HTTPPort }),
+	boolSetting("portFallback", func(c *config.Config) *bool { return &c.PortFallback }),
+	jsonSetting("inboundAccounts", func(c *config.Config) interface{} { return &c.InboundAccounts }),
+	jsonSetting("allowedSources", func(c *config.Config) interface{} { return &c.AllowedSources }),
+	boolSetting("balancerEnabled", func(c *config.Config) *bool { return &c.BalancerEnabled }),
+	stringSetting("balancerStrategy", func(c *config.Config) *string { return &c.BalancerStrategy }),
+	boolSetting("failoverEnabled", func(c *config.Config) *bool { return &c.FailoverEnabled }),
+	intSetting("failoverInterval", func(c *config.Config) *int { return &c.FailoverInterval }),
+	intSetting("failoverThreshold", func(c *config.Config) *int { return &c.FailoverThreshold }),
+	intSetting("failoverCooldown", func(c *config.Config) *int { return &c.FailoverCooldown }),
+	stringSetting("pingMode", func(c *config.Config) *string { return &c.PingMode }),
+	stringSetting("pingTestURL", func(c *config.Config) *string { return &c.PingTestURL }),
+	intSetting("pingConcurrency", func(c *config.Config) *int { return &c.PingConcurrency }),
+	intSetting("pingTimeout", func(c *config.Config) *int { return &c.PingTimeout }),
+	intSetting("latencyHistorySize", func(c *config.Config) *int { return &c.LatencyHistorySize }),
+	intSetting("latencyHistoryHours", func(c *config.Config) *int { return &c.LatencyHistoryHours }),
+	stringSetting("speedTestURL", func(c *config.Config) *string { return &c.SpeedTestURL }),
+	intSetting("speedTestMaxMB", func(c *config.Config) *int { return &c.SpeedTestMaxMB }),
+	intSetting("speedTestSeconds", func(c *config.Config) *int { return &c.SpeedTestSeconds }),
+}
+
+func stringSetting(key string, field func(c *config.Config) *string) appSetting {
+	return appSetting{
+		key: key,
+		get: func(c *config.Config) (string, error) { return *field(c), nil },
+		set: func(c *config.Config, value string) error { *field(c) = value; return nil },
+	}
+}
+
+func boolSetting(key string, field func(c *config.Config) *bool) appSetting {
+	return appSetting{
+		key: key,
+		get: func(c *config.Config) (string, error) { return strconv.FormatBool(*field(c)), nil },
+		set: func(c *config.Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err == nil {
+				*field(c) = b
+			}
+			return err
+		},
+	}
+}
+
+func intSetting(key string, field func(c *config.Config) *int) appSetting {
+	return appSetting{
+		key: key,
+		get: func(c *config.Config) (string, error) { return strconv.Itoa(*field(c)), nil },
+		set: func(c *config.Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err == nil {
+				*field(c) = n
+			}
+			return err
+		},
+	}
+}
+
+func jsonSetting(key string, field func(c *config.Config) interface{}) appSetting {
+	return appSetting{
+		key: key,
+		get: func(c *config.Config) (string, error) {
+			data, err := json.Marshal(field(c))
+			return string(data), err
+		},
+		set: func(c *config.Config, value string) error { return json.Unmarshal([]byte(value), field(c)) },
+	}
+}
+
+// SaveAppSettings 将应用设置（服务器列表以外的配置项）保存到 app_config 表。
+// 返回：第一个保存失败的设置项的错误
+func SaveAppSettings(cfg *config.Config) error {
+	for _, setting := range appSettings {
+		value, err := setting.get(cfg)
+		if err != nil {
+			return fmt.Errorf("序列化配置 %s 失败: %w", setting.key, err)
+		}
+		if err := SetAppConfig(setting.key, value); err != nil {
+			return fmt.Errorf("保存配置 %s 失败: %w", setting.key, err)
+		}
+	}
+	return nil
+}
+
+// LoadAppSettings 从 app_config 表加载应用设置，未保存的项使用默认值，无法解析的值被忽略。
+// 数据库中没有任何设置项（新安装或尚未迁移）时返回 nil。
+// 已有的配置来自旧版本，未保存的本地端口和路由模式沿用旧版本的行为（1080 端口、全局代理），
+// 新的默认值只用于新安装。
+// 返回：配置和无法解析的设置项（键名到错误），以及读取数据库的错误
+func LoadAppSettings() (*config.Config, map[string]error, error) {
+	values := make(map[string]string, len(appSettings))
+	for _, setting := range appSettings {
+		value, err := GetAppConfig(setting.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if value != "" {
+			values[setting.key] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil, nil
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.AutoProxyPort = legacyProxyPort
+	cfg.RoutingMode = config.RoutingModeGlobal
+
+	invalid := make(map[string]error)
+	for _, setting := range appSettings {
+		value, ok := values[setting.key]
+		if !ok {
+			continue
+		}
+		if err := setting.set(cfg, value); err != nil {
+			invalid[setting.key] = err
+		}
+	}
+	return cfg, invalid, nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -54,6 +55,25 @@ func createTables() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		url TEXT NOT NULL UNIQUE,
 		label TEXT NOT NULL DEFAULT '',
+		profile_title TEXT NOT NULL DEFAULT '',
+		usage_upload INTEGER NOT NULL DEFAULT 0,
+		usage_download INTEGER NOT NULL DEFAULT 0,
+		usage_total INTEGER NOT NULL DEFAULT 0,
+		usage_expire INTEGER NOT NULL DEFAULT 0,
+		usage_updated_at INTEGER NOT NULL DEFAULT 0,
+		update_interval INTEGER NOT NULL DEFAULT 0,
+		last_success_at INTEGER NOT NULL DEFAULT 0,
+		last_failure_at INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		failure_count INTEGER NOT NULL DEFAULT 0,
+		next_update_at INTEGER NOT NULL DEFAULT 0,
+		node_filter TEXT NOT NULL DEFAULT '',
+		raw_body TEXT NOT NULL DEFAULT '',
+		fetched_at INTEGER NOT NULL DEFAULT 0,
+		etag TEXT NOT NULL DEFAULT '',
+		last_modified TEXT NOT NULL DEFAULT '',
+		fetch_options TEXT NOT NULL DEFAULT '',
+		parse_report TEXT NOT NULL DEFAULT '',
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -88,6 +108,32 @@ func createTables() error {
 		ssr_obfs_param TEXT DEFAULT '',
 		ssr_protocol TEXT DEFAULT '',
 		ssr_protocol_param TEXT DEFAULT '',
+		vless_uuid TEXT DEFAULT '',
+		vless_flow TEXT DEFAULT '',
+		vless_encryption TEXT DEFAULT '',
+		vless_security TEXT DEFAULT '',
+		vless_network TEXT DEFAULT '',
+		vless_header_type TEXT DEFAULT '',
+		vless_host TEXT DEFAULT '',
+		vless_path TEXT DEFAULT '',
+		vless_sni TEXT DEFAULT '',
+		vless_fingerprint TEXT DEFAULT '',
+		vless_alpn TEXT DEFAULT '',
+		vless_allow_insecure INTEGER DEFAULT 0,
+		vless_public_key TEXT DEFAULT '',
+		vless_short_id TEXT DEFAULT '',
+		vless_spider_x TEXT DEFAULT '',
+		vmess_sni TEXT DEFAULT '',
+		vmess_allow_insecure INTEGER DEFAULT 0,
+		trojan_password TEXT DEFAULT '',
+		trojan_sni TEXT DEFAULT '',
+		trojan_alpn TEXT DEFAULT '',
+		trojan_allow_insecure INTEGER DEFAULT 0,
+		trojan_network TEXT DEFAULT '',
+		trojan_host TEXT DEFAULT '',
+		trojan_path TEXT DEFAULT '',
+		upstream_id TEXT DEFAULT '',
+		speed_mbps REAL DEFAULT 0,
 		raw_config TEXT DEFAULT '',
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -114,6 +160,17 @@ func createTables() error {
 		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);`
 
+	// 创建延迟采样表（用于统计节点延迟的中位数、抖动和成功率）
+	createLatencySamplesTable := `
+	CREATE TABLE IF NOT EXISTS latency_samples (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		server_id TEXT NOT NULL,
+		tested_at INTEGER NOT NULL,
+		delay INTEGER NOT NULL DEFAULT -1,
+		success INTEGER NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT ''
+	);`
+
 	// 创建索引
 	createIndexes := `
 	CREATE INDEX IF NOT EXISTS idx_servers_subscription_id ON servers(subscription_id);
@@ -121,6 +178,7 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_subscriptions_url ON subscriptions(url);
 	CREATE INDEX IF NOT EXISTS idx_layout_config_key ON layout_config(key);
 	CREATE INDEX IF NOT EXISTS idx_app_config_key ON app_config(key);
+	CREATE INDEX IF NOT EXISTS idx_latency_samples_server ON latency_samples(server_id, tested_at);
 	`
 
 	if _, err := DB.Exec(createSubscriptionsTable); err != nil {
@@ -139,6 +197,10 @@ func createTables() error {
 		return fmt.Errorf("创建应用配置表失败: %w", err)
 	}
 
+	if _, err := DB.Exec(createLatencySamplesTable); err != nil {
+		return fmt.Errorf("创建延迟采样表失败: %w", err)
+	}
+
 	if _, err := DB.Exec(createIndexes); err != nil {
 		return fmt.Errorf("创建索引失败: %w", err)
 	}
@@ -176,6 +238,32 @@ func migrateTables() error {
 		{"ssr_protocol", "TEXT DEFAULT ''"},
 		{"ssr_protocol_param", "TEXT DEFAULT ''"},
 		{"raw_config", "TEXT DEFAULT ''"},
+		{"vless_uuid", "TEXT DEFAULT ''"},
+		{"vless_flow", "TEXT DEFAULT ''"},
+		{"vless_encryption", "TEXT DEFAULT ''"},
+		{"vless_security", "TEXT DEFAULT ''"},
+		{"vless_network", "TEXT DEFAULT ''"},
+		{"vless_header_type", "TEXT DEFAULT ''"},
+		{"vless_host", "TEXT DEFAULT ''"},
+		{"vless_path", "TEXT DEFAULT ''"},
+		{"vless_sni", "TEXT DEFAULT ''"},
+		{"vless_fingerprint", "TEXT DEFAULT ''"},
+		{"vless_alpn", "TEXT DEFAULT ''"},
+		{"vless_allow_insecure", "INTEGER DEFAULT 0"},
+		{"vless_public_key", "TEXT DEFAULT ''"},
+		{"vless_short_id", "TEXT DEFAULT ''"},
+		{"vless_spider_x", "TEXT DEFAULT ''"},
+		{"vmess_sni", "TEXT DEFAULT ''"},
+		{"vmess_allow_insecure", "INTEGER DEFAULT 0"},
+		{"trojan_password", "TEXT DEFAULT ''"},
+		{"trojan_sni", "TEXT DEFAULT ''"},
+		{"trojan_alpn", "TEXT DEFAULT ''"},
+		{"trojan_allow_insecure", "INTEGER DEFAULT 0"},
+		{"trojan_network", "TEXT DEFAULT ''"},
+		{"trojan_host", "TEXT DEFAULT ''"},
+		{"trojan_path", "TEXT DEFAULT ''"},
+		{"upstream_id", "TEXT DEFAULT ''"},
+		{"speed_mbps", "REAL DEFAULT 0"},
 	}
 
 	// 获取表结构信息
@@ -220,6 +308,60 @@ func migrateTables() error {
 		}
 	}
 
+	return migrateSubscriptionsTable()
+}
+
+// migrateSubscriptionsTable 为已有的订阅表添加新字段（如果不存在）
+func migrateSubscriptionsTable() error {
+	migrations := []struct {
+		column  string
+		colType string
+	}{
+		{"profile_title", "TEXT NOT NULL DEFAULT ''"},
+		{"usage_upload", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_download", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_total", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_expire", "INTEGER NOT NULL DEFAULT 0"},
+		{"usage_updated_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"update_interval", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_success_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_failure_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_error", "TEXT NOT NULL DEFAULT ''"},
+		{"failure_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"next_update_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"node_filter", "TEXT NOT NULL DEFAULT ''"},
+		{"raw_body", "TEXT NOT NULL DEFAULT ''"},
+		{"fetched_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"etag", "TEXT NOT NULL DEFAULT ''"},
+		{"last_modified", "TEXT NOT NULL DEFAULT ''"},
+		{"fetch_options", "TEXT NOT NULL DEFAULT ''"},
+		{"parse_report", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	rows, err := DB.Query("PRAGMA table_info(subscriptions)")
+	if err != nil {
+		return nil
+	}
+	existingColumns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, colType string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notnull, &dfltValue, &pk); err != nil {
+			continue
+		}
+		existingColumns[name] = true
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if !existingColumns[m.column] {
+			if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE subscriptions ADD COLUMN %s %s", m.column, m.colType)); err != nil {
+				return fmt.Errorf("添加订阅字段 %s 失败: %w", m.column, err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -235,11 +377,194 @@ func CloseDB() error {
 
 // Subscription 表示一个订阅配置，包含 URL 和标签信息。
 type Subscription struct {
-	ID        int64     `json:"id"`
-	URL       string    `json:"url"`
-	Label     string    `json:"label"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           int64                    `json:"id"`
+	URL          string                   `json:"url"`
+	Label        string                   `json:"label"`
+	ProfileTitle string                   `json:"profile_title"` // 订阅提供的名称（profile-title 响应头）
+	Usage        SubscriptionUsage        `json:"usage"`         // 流量与到期信息
+	Schedule     SubscriptionSchedule     `json:"schedule"`      // 自动更新计划与最近一次更新结果
+	Filter       SubscriptionFilter       `json:"filter"`        // 节点过滤与重命名规则
+	FetchedAt    time.Time                `json:"fetched_at"`    // 最近一次缓存原始内容的时间，零值表示没有缓存
+	FetchOptions SubscriptionFetchOptions `json:"fetch_options"` // 获取订阅时的请求设置
+	ParseReport  ParseReport              `json:"parse_report"`  // 最近一次解析的诊断报告
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+// DisplayName 返回用于显示的订阅名称：优先使用标签，其次是订阅提供的名称，最后是 URL
+func (s *Subscription) DisplayName() string {
+	if s.Label != "" {
+		return s.Label
+	}
+	if s.ProfileTitle != "" {
+		return s.ProfileTitle
+	}
+	return s.URL
+}
+
+// SubscriptionUsage 订阅的流量与到期信息（来自 subscription-userinfo 响应头）。
+type SubscriptionUsage struct {
+	Upload    int64     `json:"upload"`     // 已用上传流量（字节）
+	Download  int64     `json:"download"`   // 已用下载流量（字节）
+	Total     int64     `json:"total"`      // 总流量（字节），0 表示未知或不限量
+	ExpireAt  time.Time `json:"expire_at"`  // 到期时间，零值表示未知或长期有效
+	UpdatedAt time.Time `json:"updated_at"` // 获取时间，零值表示订阅从未提供过流量信息
+}
+
+// SubscriptionSchedule 订阅的自动更新计划与最近一次更新结果。
+type SubscriptionSchedule struct {
+	Interval      time.Duration `json:"interval"`        // 自动更新间隔，0 表示不自动更新
+	LastSuccessAt time.Time     `json:"last_success_at"` // 最近一次更新成功的时间
+	LastFailureAt time.Time     `json:"last_failure_at"` // 最近一次更新失败的时间
+	LastError     string        `json:"last_error"`      // 最近一次失败的错误信息，成功后清空
+	Failures      int           `json:"failures"`        // 连续失败次数，用于计算重试退避
+	NextUpdateAt  time.Time     `json:"next_update_at"`  // 下次自动更新时间，零值表示尚未安排
+}
+
+// 订阅请求的认证方式
+const (
+	AuthNone   = ""       // 不认证
+	AuthBasic  = "basic"  // HTTP Basic 认证
+	AuthBearer = "bearer" // Bearer 令牌
+)
+
+// SubscriptionFetchOptions 获取订阅时的请求设置。
+type SubscriptionFetchOptions struct {
+	Headers   map[string]string `json:"headers,omitempty"`    // 额外的请求头
+	UserAgent string            `json:"user_agent,omitempty"` // User-Agent，为空时使用默认值
+	AuthType  string            `json:"auth_type,omitempty"`  // 认证方式：AuthNone、AuthBasic 或 AuthBearer
+	Username  string            `json:"username,omitempty"`   // Basic 认证用户名
+	Password  string            `json:"password,omitempty"`   // Basic 认证密码
+	Token     string            `json:"token,omitempty"`      // Bearer 令牌
+	Mirrors   []string          `json:"mirrors,omitempty"`    // 备用地址，订阅地址获取失败时按顺序尝试
+	UseProxy  bool              `json:"use_proxy,omitempty"`  // 是否通过正在运行的本地代理获取
+}
+
+// IsZero 返回是否没有任何自定义设置
+func (o SubscriptionFetchOptions) IsZero() bool {
+	return len(o.Headers) == 0 && o.UserAgent == "" && o.AuthType == AuthNone &&
+		o.Username == "" && o.Password == "" && o.Token == "" && len(o.Mirrors) == 0 && !o.UseProxy
+}
+
+// ParseReport 订阅内容的解析诊断报告，记录无法解析的条目及原因。
+type ParseReport struct {
+	Format   string          `json:"format"`             // 识别出的订阅格式
+	Total    int             `json:"total"`              // 参与解析的条目（行或节点）总数
+	Accepted int             `json:"accepted"`           // 解析成功的条目数
+	Rejected []RejectedEntry `json:"rejected,omitempty"` // 解析失败的条目（数量过多时只保留前面的部分）
+	ParsedAt time.Time       `json:"parsed_at"`          // 解析时间，零值表示没有报告
+}
+
+// RejectedEntry 解析失败的单个条目
+type RejectedEntry struct {
+	Line    int    `json:"line"`    // 行号或条目序号（从 1 开始）
+	Content string `json:"content"` // 条目内容（已隐藏密码等敏感信息）
+	Parser  string `json:"parser"`  // 尝试的解析器
+	Error   string `json:"error"`   // 失败原因
+}
+
+// Failed 返回解析失败的条目数
+func (r ParseReport) Failed() int {
+	return r.Total - r.Accepted
+}
+
+// Summary 返回一行解析结果摘要，如 "Clash：共 20 条，成功 18 条，失败 2 条"
+func (r ParseReport) Summary() string {
+	return fmt.Sprintf("%s：共 %d 条，成功 %d 条，失败 %d 条", r.Format, r.Total, r.Accepted, r.Failed())
+}
+
+// SubscriptionCache 最近一次成功获取的订阅原始内容及用于条件请求的响应头。
+type SubscriptionCache struct {
+	Body         string    `json:"body"`          // 原始响应内容
+	FetchedAt    time.Time `json:"fetched_at"`    // 获取时间（服务器返回 304 时也会刷新）
+	ETag         string    `json:"etag"`          // ETag 响应头，用于 If-None-Match
+	LastModified string    `json:"last_modified"` // Last-Modified 响应头，用于 If-Modified-Since
+}
+
+// SubscriptionFilter 订阅的节点过滤与重命名规则，更新订阅时在保存服务器之前应用。
+// 所有模式均为正则表达式，为空表示不限制。
+type SubscriptionFilter struct {
+	Include         string       `json:"include,omitempty"`          // 只保留名称匹配的节点
+	Exclude         string       `json:"exclude,omitempty"`          // 排除名称匹配的节点
+	IncludeProtocol string       `json:"include_protocol,omitempty"` // 只保留协议类型匹配的节点
+	ExcludeProtocol string       `json:"exclude_protocol,omitempty"` // 排除协议类型匹配的节点
+	Renames         []RenameRule `json:"renames,omitempty"`          // 按顺序应用的重命名规则
+}
+
+// RenameRule 节点重命名规则，将名称中匹配 Pattern 的部分替换为 Replace（支持 $1 等分组引用）
+type RenameRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// IsZero 返回是否没有设置任何过滤或重命名规则
+func (f SubscriptionFilter) IsZero() bool {
+	return f.Include == "" && f.Exclude == "" && f.IncludeProtocol == "" && f.ExcludeProtocol == "" && len(f.Renames) == 0
+}
+
+// Used 返回已用流量（上传 + 下载）
+func (u SubscriptionUsage) Used() int64 {
+	return u.Upload + u.Download
+}
+
+// subscriptionColumns 查询订阅时的字段列表，与 scanSubscription 的扫描顺序一致
+const subscriptionColumns = `id, url, label, profile_title,
+	usage_upload, usage_download, usage_total, usage_expire, usage_updated_at,
+	update_interval, last_success_at, last_failure_at, last_error, failure_count, next_update_at,
+	node_filter, fetched_at, fetch_options, parse_report, created_at, updated_at`
+
+// scanSubscription 扫描一行订阅数据（字段顺序见 subscriptionColumns）
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	var sub Subscription
+	var expire, usageUpdatedAt int64
+	var interval, lastSuccess, lastFailure, nextUpdate, fetchedAt int64
+	var filter, fetchOptions, parseReport string
+	err := row.Scan(&sub.ID, &sub.URL, &sub.Label, &sub.ProfileTitle,
+		&sub.Usage.Upload, &sub.Usage.Download, &sub.Usage.Total, &expire, &usageUpdatedAt,
+		&interval, &lastSuccess, &lastFailure, &sub.Schedule.LastError, &sub.Schedule.Failures, &nextUpdate,
+		&filter, &fetchedAt, &fetchOptions, &parseReport, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.Usage.ExpireAt = unixTime(expire)
+	sub.Usage.UpdatedAt = unixTime(usageUpdatedAt)
+	sub.Schedule.Interval = time.Duration(interval) * time.Minute
+	sub.Schedule.LastSuccessAt = unixTime(lastSuccess)
+	sub.Schedule.LastFailureAt = unixTime(lastFailure)
+	sub.Schedule.NextUpdateAt = unixTime(nextUpdate)
+	sub.FetchedAt = unixTime(fetchedAt)
+	if filter != "" {
+		if err := json.Unmarshal([]byte(filter), &sub.Filter); err != nil {
+			return nil, fmt.Errorf("解析订阅过滤规则失败: %w", err)
+		}
+	}
+	if fetchOptions != "" {
+		if err := json.Unmarshal([]byte(fetchOptions), &sub.FetchOptions); err != nil {
+			return nil, fmt.Errorf("解析订阅请求设置失败: %w", err)
+		}
+	}
+	if parseReport != "" {
+		if err := json.Unmarshal([]byte(parseReport), &sub.ParseReport); err != nil {
+			return nil, fmt.Errorf("解析订阅解析报告失败: %w", err)
+		}
+	}
+	return &sub, nil
+}
+
+// unixTime 将 Unix 秒转换为时间，0 转换为零值
+func unixTime(sec int64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// unixSeconds 将时间转换为 Unix 秒，零值转换为 0
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
 }
 
 // AddOrUpdateSubscription 添加新订阅或更新现有订阅。
@@ -253,9 +578,7 @@ func AddOrUpdateSubscription(url, label string) (*Subscription, error) {
 	now := time.Now()
 
 	// 先尝试查询是否存在
-	var sub Subscription
-	err := DB.QueryRow("SELECT id, url, label, created_at, updated_at FROM subscriptions WHERE url = ?", url).
-		Scan(&sub.ID, &sub.URL, &sub.Label, &sub.CreatedAt, &sub.UpdatedAt)
+	sub, err := scanSubscription(DB.QueryRow("SELECT "+subscriptionColumns+" FROM subscriptions WHERE url = ?", url))
 
 	if err == sql.ErrNoRows {
 		// 不存在，插入新记录
@@ -272,6 +595,7 @@ func AddOrUpdateSubscription(url, label string) (*Subscription, error) {
 			return nil, fmt.Errorf("获取插入ID失败: %w", err)
 		}
 
+		sub = &Subscription{}
 		sub.ID = id
 		sub.URL = url
 		sub.Label = label
@@ -294,7 +618,7 @@ func AddOrUpdateSubscription(url, label string) (*Subscription, error) {
 		}
 	}
 
-	return &sub, nil
+	return sub, nil
 }
 
 // GetSubscriptionByURL 根据 URL 查找订阅。
@@ -303,11 +627,10 @@ func AddOrUpdateSubscription(url, label string) (*Subscription, error) {
 //
 // 返回：订阅实例和错误（如果未找到或发生错误）
 func GetSubscriptionByURL(url string) (*Subscription, error) {
-	var sub Subscription
-	err := DB.QueryRow(
-		"SELECT id, url, label, created_at, updated_at FROM subscriptions WHERE url = ?",
+	sub, err := scanSubscription(DB.QueryRow(
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE url = ?",
 		url,
-	).Scan(&sub.ID, &sub.URL, &sub.Label, &sub.CreatedAt, &sub.UpdatedAt)
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -316,13 +639,13 @@ func GetSubscriptionByURL(url string) (*Subscription, error) {
 		return nil, fmt.Errorf("查询订阅失败: %w", err)
 	}
 
-	return &sub, nil
+	return sub, nil
 }
 
 // GetAllSubscriptions 获取所有订阅列表。
 // 返回：订阅列表和错误（如果有）
 func GetAllSubscriptions() ([]*Subscription, error) {
-	rows, err := DB.Query("SELECT id, url, label, created_at, updated_at FROM subscriptions ORDER BY created_at DESC")
+	rows, err := DB.Query("SELECT " + subscriptionColumns + " FROM subscriptions ORDER BY created_at DESC")
 	if err != nil {
 		return nil, fmt.Errorf("查询订阅列表失败: %w", err)
 	}
@@ -330,11 +653,11 @@ func GetAllSubscriptions() ([]*Subscription, error) {
 
 	var subscriptions []*Subscription
 	for rows.Next() {
-		var sub Subscription
-		if err := rows.Scan(&sub.ID, &sub.URL, &sub.Label, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		sub, err := scanSubscription(rows)
+		if err != nil {
 			return nil, fmt.Errorf("扫描订阅数据失败: %w", err)
 		}
-		subscriptions = append(subscriptions, &sub)
+		subscriptions = append(subscriptions, sub)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -369,11 +692,10 @@ func DeleteSubscription(subscriptionID int64) error {
 //
 // 返回：订阅实例和错误（如果未找到或发生错误）
 func GetSubscriptionByID(id int64) (*Subscription, error) {
-	var sub Subscription
-	err := DB.QueryRow(
-		"SELECT id, url, label, created_at, updated_at FROM subscriptions WHERE id = ?",
+	sub, err := scanSubscription(DB.QueryRow(
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = ?",
 		id,
-	).Scan(&sub.ID, &sub.URL, &sub.Label, &sub.CreatedAt, &sub.UpdatedAt)
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -382,7 +704,189 @@ func GetSubscriptionByID(id int64) (*Subscription, error) {
 		return nil, fmt.Errorf("查询订阅失败: %w", err)
 	}
 
-	return &sub, nil
+	return sub, nil
+}
+
+// UpdateSubscriptionUsage 更新订阅的流量、到期信息和订阅名称。
+// 参数：
+//   - id: 订阅 ID
+//   - usage: 流量与到期信息（UpdatedAt 为获取时间）
+//   - profileTitle: 订阅提供的名称，为空时保留原值
+//
+// 返回：错误（如果有）
+func UpdateSubscriptionUsage(id int64, usage SubscriptionUsage, profileTitle string) error {
+	_, err := DB.Exec(
+		`UPDATE subscriptions SET usage_upload = ?, usage_download = ?, usage_total = ?, usage_expire = ?,
+			usage_updated_at = ?, profile_title = CASE WHEN ? = '' THEN profile_title ELSE ? END
+		 WHERE id = ?`,
+		usage.Upload, usage.Download, usage.Total, unixSeconds(usage.ExpireAt),
+		unixSeconds(usage.UpdatedAt), profileTitle, profileTitle, id,
+	)
+	if err != nil {
+		return fmt.Errorf("更新订阅流量信息失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateSubscriptionByID 根据 ID 修改订阅的 URL 和标签。
+// URL 变化时清空缓存的原始内容，避免向新地址发送旧的条件请求。
+// 参数：
+//   - id: 订阅 ID
+//   - url: 新的订阅 URL
+//   - label: 新的订阅标签
+//
+// 返回：错误（如果有）
+func UpdateSubscriptionByID(id int64, url, label string) error {
+	_, err := DB.Exec(
+		`UPDATE subscriptions SET url = ?, label = ?, updated_at = ?,
+			raw_body = CASE WHEN url = ? THEN raw_body ELSE '' END,
+			fetched_at = CASE WHEN url = ? THEN fetched_at ELSE 0 END,
+			etag = CASE WHEN url = ? THEN etag ELSE '' END,
+			last_modified = CASE WHEN url = ? THEN last_modified ELSE '' END
+		 WHERE id = ?`,
+		url, label, time.Now(), url, url, url, url, id,
+	)
+	if err != nil {
+		return fmt.Errorf("更新订阅失败: %w", err)
+	}
+	return nil
+}
+
+// SetSubscriptionInterval 设置订阅的自动更新间隔（按分钟保存）。
+// 修改间隔后清空下次更新时间，由调度器根据新间隔重新安排。
+// 参数：
+//   - id: 订阅 ID
+//   - interval: 自动更新间隔，0 表示不自动更新
+//
+// 返回：错误（如果有）
+func SetSubscriptionInterval(id int64, interval time.Duration) error {
+	_, err := DB.Exec(
+		"UPDATE subscriptions SET update_interval = ?, next_update_at = 0 WHERE id = ?",
+		int64(interval/time.Minute), id,
+	)
+	if err != nil {
+		return fmt.Errorf("设置订阅更新间隔失败: %w", err)
+	}
+	return nil
+}
+
+// SetSubscriptionFilter 设置订阅的节点过滤与重命名规则（以 JSON 保存），下次更新订阅时生效。
+// 参数：
+//   - id: 订阅 ID
+//   - filter: 过滤与重命名规则，零值表示清除
+//
+// 返回：错误（如果有）
+func SetSubscriptionFilter(id int64, filter SubscriptionFilter) error {
+	value := ""
+	if !filter.IsZero() {
+		data, err := json.Marshal(filter)
+		if err != nil {
+			return fmt.Errorf("序列化订阅过滤规则失败: %w", err)
+		}
+		value = string(data)
+	}
+	_, err := DB.Exec("UPDATE subscriptions SET node_filter = ? WHERE id = ?", value, id)
+	if err != nil {
+		return fmt.Errorf("设置订阅过滤规则失败: %w", err)
+	}
+	return nil
+}
+
+// SetSubscriptionFetchOptions 设置获取订阅时的请求设置（以 JSON 保存），下次更新订阅时生效。
+// 参数：
+//   - id: 订阅 ID
+//   - options: 请求设置，零值表示清除
+//
+// 返回：错误（如果有）
+func SetSubscriptionFetchOptions(id int64, options SubscriptionFetchOptions) error {
+	value := ""
+	if !options.IsZero() {
+		data, err := json.Marshal(options)
+		if err != nil {
+			return fmt.Errorf("序列化订阅请求设置失败: %w", err)
+		}
+		value = string(data)
+	}
+	_, err := DB.Exec("UPDATE subscriptions SET fetch_options = ? WHERE id = ?", value, id)
+	if err != nil {
+		return fmt.Errorf("设置订阅请求设置失败: %w", err)
+	}
+	return nil
+}
+
+// SetSubscriptionParseReport 保存订阅最近一次解析的诊断报告（以 JSON 保存）。
+// 参数：
+//   - id: 订阅 ID
+//   - report: 解析报告
+//
+// 返回：错误（如果有）
+func SetSubscriptionParseReport(id int64, report ParseReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化订阅解析报告失败: %w", err)
+	}
+	if _, err := DB.Exec("UPDATE subscriptions SET parse_report = ? WHERE id = ?", string(data), id); err != nil {
+		return fmt.Errorf("保存订阅解析报告失败: %w", err)
+	}
+	return nil
+}
+
+// GetSubscriptionCache 获取订阅缓存的原始内容。
+// 参数：
+//   - id: 订阅 ID
+//
+// 返回：缓存（订阅不存在时为 nil，从未缓存过时 Body 为空）和错误（如果有）
+func GetSubscriptionCache(id int64) (*SubscriptionCache, error) {
+	var cache SubscriptionCache
+	var fetchedAt int64
+	err := DB.QueryRow(
+		"SELECT raw_body, fetched_at, etag, last_modified FROM subscriptions WHERE id = ?", id,
+	).Scan(&cache.Body, &fetchedAt, &cache.ETag, &cache.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询订阅缓存失败: %w", err)
+	}
+	cache.FetchedAt = unixTime(fetchedAt)
+	return &cache, nil
+}
+
+// SaveSubscriptionCache 保存订阅的原始内容、获取时间和条件请求所需的响应头。
+// 参数：
+//   - id: 订阅 ID
+//   - cache: 要保存的缓存
+//
+// 返回：错误（如果有）
+func SaveSubscriptionCache(id int64, cache SubscriptionCache) error {
+	_, err := DB.Exec(
+		"UPDATE subscriptions SET raw_body = ?, fetched_at = ?, etag = ?, last_modified = ? WHERE id = ?",
+		cache.Body, unixSeconds(cache.FetchedAt), cache.ETag, cache.LastModified, id,
+	)
+	if err != nil {
+		return fmt.Errorf("保存订阅缓存失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateSubscriptionSchedule 保存订阅最近一次更新的结果和下次更新时间（不修改更新间隔）。
+// 参数：
+//   - id: 订阅 ID
+//   - schedule: 更新计划与结果
+//
+// 返回：错误（如果有）
+func UpdateSubscriptionSchedule(id int64, schedule SubscriptionSchedule) error {
+	_, err := DB.Exec(
+		`UPDATE subscriptions SET last_success_at = ?, last_failure_at = ?, last_error = ?,
+			failure_count = ?, next_update_at = ?
+		 WHERE id = ?`,
+		unixSeconds(schedule.LastSuccessAt), unixSeconds(schedule.LastFailureAt), schedule.LastError,
+		schedule.Failures, unixSeconds(schedule.NextUpdateAt), id,
+	)
+	if err != nil {
+		return fmt.Errorf("更新订阅更新计划失败: %w", err)
+	}
+	return nil
 }
 
 // GetServerCountBySubscriptionID 获取指定订阅的服务器数量。
@@ -408,22 +912,63 @@ func GetServerCountBySubscriptionID(subscriptionID int64) (int, error) {
 //
 // 返回：错误（如果有）
 func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
+	return addOrUpdateServer(DB, server, subscriptionID)
+}
+
+// AddServers 在一个事务中添加或更新多个服务器（逻辑见 AddOrUpdateServer），任一失败时全部回滚。
+// 参数：
+//   - servers: 服务器配置列表
+//   - subscriptionID: 关联的订阅 ID（可选，可为 nil）
+//
+// 返回：错误（如果有）
+func AddServers(servers []config.Server, subscriptionID *int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, server := range servers {
+		if err := addOrUpdateServer(tx, server, subscriptionID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// execer 抽象 *sql.DB 和 *sql.Tx，使同一段写入逻辑可以在事务内外复用
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// addOrUpdateServer 在 db（数据库或事务）中添加或更新服务器，逻辑见 AddOrUpdateServer
+func addOrUpdateServer(db execer, server config.Server, subscriptionID *int64) error {
 	now := time.Now()
 
 	// 检查服务器是否存在
 	var existingID string
 	var existingSubscriptionID sql.NullInt64
-	err := DB.QueryRow("SELECT id, subscription_id FROM servers WHERE id = ?", server.ID).
+	err := db.QueryRow("SELECT id, subscription_id FROM servers WHERE id = ?", server.ID).
 		Scan(&existingID, &existingSubscriptionID)
 
 	if err == sql.ErrNoRows {
 		// 不存在，插入新记录
-		_, err = DB.Exec(
+		_, err = db.Exec(
 			`INSERT INTO servers (id, subscription_id, name, addr, port, username, password, delay, selected, enabled,
 				node_protocol_type, vmess_version, vmess_uuid, vmess_alter_id, vmess_security, vmess_network,
 				vmess_type, vmess_host, vmess_path, vmess_tls, ss_method, ss_plugin, ss_plugin_opts,
-				ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param, raw_config, created_at, updated_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param,
+				vless_uuid, vless_flow, vless_encryption, vless_security, vless_network, vless_header_type,
+				vless_host, vless_path, vless_sni, vless_fingerprint, vless_alpn, vless_allow_insecure,
+				vless_public_key, vless_short_id, vless_spider_x, vmess_sni, vmess_allow_insecure, trojan_password, trojan_sni, trojan_alpn, trojan_allow_insecure,
+				trojan_network, trojan_host, trojan_path, upstream_id, raw_config, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+				?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			server.ID, subscriptionID, server.Name, server.Addr, server.Port,
 			server.Username, server.Password, server.Delay,
 			boolToInt(server.Selected), boolToInt(server.Enabled),
@@ -431,6 +976,13 @@ func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
 			server.VMessSecurity, server.VMessNetwork, server.VMessType, server.VMessHost,
 			server.VMessPath, server.VMessTLS, server.SSMethod, server.SSPlugin, server.SSPluginOpts,
 			server.SSRObfs, server.SSRObfsParam, server.SSRProtocol, server.SSRProtocolParam,
+			server.VLESSUUID, server.VLESSFlow, server.VLESSEncryption, server.VLESSSecurity,
+			server.VLESSNetwork, server.VLESSHeaderType, server.VLESSHost, server.VLESSPath,
+			server.VLESSSNI, server.VLESSFingerprint, server.VLESSAlpn, boolToInt(server.VLESSAllowInsecure),
+			server.VLESSPublicKey, server.VLESSShortID, server.VLESSSpiderX,
+			server.VMessSNI, boolToInt(server.VMessAllowInsecure), server.TrojanPassword, server.TrojanSNI,
+			server.TrojanAlpn, boolToInt(server.TrojanAllowInsecure), server.TrojanNetwork, server.TrojanHost, server.TrojanPath,
+			server.UpstreamID,
 			server.RawConfig, now, now,
 		)
 		if err != nil {
@@ -446,7 +998,7 @@ func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
 			updateSubscriptionID = &existingSubscriptionID.Int64
 		}
 
-		_, err = DB.Exec(
+		_, err = db.Exec(
 			`UPDATE servers SET 
 				subscription_id = ?, name = ?, addr = ?, port = ?, username = ?, password = ?,
 				delay = ?, selected = ?, enabled = ?,
@@ -454,6 +1006,11 @@ func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
 				vmess_network = ?, vmess_type = ?, vmess_host = ?, vmess_path = ?, vmess_tls = ?,
 				ss_method = ?, ss_plugin = ?, ss_plugin_opts = ?,
 				ssr_obfs = ?, ssr_obfs_param = ?, ssr_protocol = ?, ssr_protocol_param = ?,
+				vless_uuid = ?, vless_flow = ?, vless_encryption = ?, vless_security = ?, vless_network = ?,
+				vless_header_type = ?, vless_host = ?, vless_path = ?, vless_sni = ?, vless_fingerprint = ?,
+				vless_alpn = ?, vless_allow_insecure = ?, vless_public_key = ?, vless_short_id = ?, vless_spider_x = ?,
+				vmess_sni = ?, vmess_allow_insecure = ?, trojan_password = ?, trojan_sni = ?, trojan_alpn = ?,
+				trojan_allow_insecure = ?, trojan_network = ?, trojan_host = ?, trojan_path = ?,
 				raw_config = ?, updated_at = ?
 			 WHERE id = ?`,
 			updateSubscriptionID, server.Name, server.Addr, server.Port,
@@ -463,6 +1020,12 @@ func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
 			server.VMessSecurity, server.VMessNetwork, server.VMessType, server.VMessHost,
 			server.VMessPath, server.VMessTLS, server.SSMethod, server.SSPlugin, server.SSPluginOpts,
 			server.SSRObfs, server.SSRObfsParam, server.SSRProtocol, server.SSRProtocolParam,
+			server.VLESSUUID, server.VLESSFlow, server.VLESSEncryption, server.VLESSSecurity,
+			server.VLESSNetwork, server.VLESSHeaderType, server.VLESSHost, server.VLESSPath,
+			server.VLESSSNI, server.VLESSFingerprint, server.VLESSAlpn, boolToInt(server.VLESSAllowInsecure),
+			server.VLESSPublicKey, server.VLESSShortID, server.VLESSSpiderX,
+			server.VMessSNI, boolToInt(server.VMessAllowInsecure), server.TrojanPassword, server.TrojanSNI,
+			server.TrojanAlpn, boolToInt(server.TrojanAllowInsecure), server.TrojanNetwork, server.TrojanHost, server.TrojanPath,
 			server.RawConfig, now, server.ID,
 		)
 		if err != nil {
@@ -480,13 +1043,18 @@ func AddOrUpdateServer(server config.Server, subscriptionID *int64) error {
 // 返回：服务器实例和错误（如果未找到或发生错误）
 func GetServer(id string) (*config.Server, error) {
 	var server config.Server
-	var selected, enabled int
+	var selected, enabled, vlessAllowInsecure, vmessAllowInsecure, trojanAllowInsecure int
 
 	err := DB.QueryRow(
 		`SELECT id, name, addr, port, username, password, delay, selected, enabled,
 			node_protocol_type, vmess_version, vmess_uuid, vmess_alter_id, vmess_security, vmess_network,
 			vmess_type, vmess_host, vmess_path, vmess_tls, ss_method, ss_plugin, ss_plugin_opts,
-			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param, raw_config
+			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param,
+			vless_uuid, vless_flow, vless_encryption, vless_security, vless_network, vless_header_type,
+			vless_host, vless_path, vless_sni, vless_fingerprint, vless_alpn, vless_allow_insecure,
+			vless_public_key, vless_short_id, vless_spider_x,
+			vmess_sni, vmess_allow_insecure, trojan_password, trojan_sni, trojan_alpn, trojan_allow_insecure,
+			trojan_network, trojan_host, trojan_path, upstream_id, speed_mbps, raw_config
 		 FROM servers WHERE id = ?`,
 		id,
 	).Scan(&server.ID, &server.Name, &server.Addr, &server.Port,
@@ -496,6 +1064,13 @@ func GetServer(id string) (*config.Server, error) {
 		&server.VMessSecurity, &server.VMessNetwork, &server.VMessType, &server.VMessHost,
 		&server.VMessPath, &server.VMessTLS, &server.SSMethod, &server.SSPlugin, &server.SSPluginOpts,
 		&server.SSRObfs, &server.SSRObfsParam, &server.SSRProtocol, &server.SSRProtocolParam,
+		&server.VLESSUUID, &server.VLESSFlow, &server.VLESSEncryption, &server.VLESSSecurity,
+		&server.VLESSNetwork, &server.VLESSHeaderType, &server.VLESSHost, &server.VLESSPath,
+		&server.VLESSSNI, &server.VLESSFingerprint, &server.VLESSAlpn, &vlessAllowInsecure,
+		&server.VLESSPublicKey, &server.VLESSShortID, &server.VLESSSpiderX,
+		&server.VMessSNI, &vmessAllowInsecure, &server.TrojanPassword, &server.TrojanSNI,
+		&server.TrojanAlpn, &trojanAllowInsecure, &server.TrojanNetwork, &server.TrojanHost, &server.TrojanPath,
+		&server.UpstreamID, &server.SpeedMbps,
 		&server.RawConfig)
 
 	if err == sql.ErrNoRows {
@@ -507,6 +1082,9 @@ func GetServer(id string) (*config.Server, error) {
 
 	server.Selected = intToBool(selected)
 	server.Enabled = intToBool(enabled)
+	server.VLESSAllowInsecure = intToBool(vlessAllowInsecure)
+	server.VMessAllowInsecure = intToBool(vmessAllowInsecure)
+	server.TrojanAllowInsecure = intToBool(trojanAllowInsecure)
 	
 	// 如果 ProtocolType 为空，设置默认值
 	if server.ProtocolType == "" {
@@ -523,7 +1101,12 @@ func GetAllServers() ([]config.Server, error) {
 		`SELECT id, name, addr, port, username, password, delay, selected, enabled,
 			node_protocol_type, vmess_version, vmess_uuid, vmess_alter_id, vmess_security, vmess_network,
 			vmess_type, vmess_host, vmess_path, vmess_tls, ss_method, ss_plugin, ss_plugin_opts,
-			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param, raw_config
+			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param,
+			vless_uuid, vless_flow, vless_encryption, vless_security, vless_network, vless_header_type,
+			vless_host, vless_path, vless_sni, vless_fingerprint, vless_alpn, vless_allow_insecure,
+			vless_public_key, vless_short_id, vless_spider_x,
+			vmess_sni, vmess_allow_insecure, trojan_password, trojan_sni, trojan_alpn, trojan_allow_insecure,
+			trojan_network, trojan_host, trojan_path, upstream_id, speed_mbps, raw_config
 		 FROM servers ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -534,7 +1117,7 @@ func GetAllServers() ([]config.Server, error) {
 	var servers []config.Server
 	for rows.Next() {
 		var server config.Server
-		var selected, enabled int
+		var selected, enabled, vlessAllowInsecure, vmessAllowInsecure, trojanAllowInsecure int
 
 		if err := rows.Scan(&server.ID, &server.Name, &server.Addr, &server.Port,
 			&server.Username, &server.Password, &server.Delay,
@@ -543,12 +1126,22 @@ func GetAllServers() ([]config.Server, error) {
 			&server.VMessSecurity, &server.VMessNetwork, &server.VMessType, &server.VMessHost,
 			&server.VMessPath, &server.VMessTLS, &server.SSMethod, &server.SSPlugin, &server.SSPluginOpts,
 			&server.SSRObfs, &server.SSRObfsParam, &server.SSRProtocol, &server.SSRProtocolParam,
+			&server.VLESSUUID, &server.VLESSFlow, &server.VLESSEncryption, &server.VLESSSecurity,
+			&server.VLESSNetwork, &server.VLESSHeaderType, &server.VLESSHost, &server.VLESSPath,
+			&server.VLESSSNI, &server.VLESSFingerprint, &server.VLESSAlpn, &vlessAllowInsecure,
+			&server.VLESSPublicKey, &server.VLESSShortID, &server.VLESSSpiderX,
+			&server.VMessSNI, &vmessAllowInsecure, &server.TrojanPassword, &server.TrojanSNI,
+			&server.TrojanAlpn, &trojanAllowInsecure, &server.TrojanNetwork, &server.TrojanHost, &server.TrojanPath,
+			&server.UpstreamID, &server.SpeedMbps,
 			&server.RawConfig); err != nil {
 			return nil, fmt.Errorf("扫描服务器数据失败: %w", err)
 		}
 
 		server.Selected = intToBool(selected)
 		server.Enabled = intToBool(enabled)
+		server.VLESSAllowInsecure = intToBool(vlessAllowInsecure)
+		server.VMessAllowInsecure = intToBool(vmessAllowInsecure)
+		server.TrojanAllowInsecure = intToBool(trojanAllowInsecure)
 		
 		// 如果 ProtocolType 为空，设置默认值
 		if server.ProtocolType == "" {
@@ -565,6 +1158,30 @@ func GetAllServers() ([]config.Server, error) {
 	return servers, nil
 }
 
+// GetServerSubscriptionIDs 获取每个服务器所属的订阅 ID，手动添加的服务器为 0。
+// 返回：服务器 ID 到订阅 ID 的映射和错误（如果有）
+func GetServerSubscriptionIDs() (map[string]int64, error) {
+	rows, err := DB.Query("SELECT id, subscription_id FROM servers")
+	if err != nil {
+		return nil, fmt.Errorf("查询服务器订阅失败: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var subscriptionID sql.NullInt64
+		if err := rows.Scan(&id, &subscriptionID); err != nil {
+			return nil, fmt.Errorf("扫描服务器数据失败: %w", err)
+		}
+		ids[id] = subscriptionID.Int64
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历服务器数据失败: %w", err)
+	}
+	return ids, nil
+}
+
 // GetServersBySubscriptionID 获取指定订阅关联的所有服务器。
 // 参数：
 //   - subscriptionID: 订阅 ID
@@ -575,7 +1192,12 @@ func GetServersBySubscriptionID(subscriptionID int64) ([]config.Server, error) {
 		`SELECT id, name, addr, port, username, password, delay, selected, enabled,
 			node_protocol_type, vmess_version, vmess_uuid, vmess_alter_id, vmess_security, vmess_network,
 			vmess_type, vmess_host, vmess_path, vmess_tls, ss_method, ss_plugin, ss_plugin_opts,
-			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param, raw_config
+			ssr_obfs, ssr_obfs_param, ssr_protocol, ssr_protocol_param,
+			vless_uuid, vless_flow, vless_encryption, vless_security, vless_network, vless_header_type,
+			vless_host, vless_path, vless_sni, vless_fingerprint, vless_alpn, vless_allow_insecure,
+			vless_public_key, vless_short_id, vless_spider_x,
+			vmess_sni, vmess_allow_insecure, trojan_password, trojan_sni, trojan_alpn, trojan_allow_insecure,
+			trojan_network, trojan_host, trojan_path, upstream_id, speed_mbps, raw_config
 		 FROM servers WHERE subscription_id = ? ORDER BY created_at DESC`,
 		subscriptionID,
 	)
@@ -587,7 +1209,7 @@ func GetServersBySubscriptionID(subscriptionID int64) ([]config.Server, error) {
 	var servers []config.Server
 	for rows.Next() {
 		var server config.Server
-		var selected, enabled int
+		var selected, enabled, vlessAllowInsecure, vmessAllowInsecure, trojanAllowInsecure int
 
 		if err := rows.Scan(&server.ID, &server.Name, &server.Addr, &server.Port,
 			&server.Username, &server.Password, &server.Delay,
@@ -596,12 +1218,22 @@ func GetServersBySubscriptionID(subscriptionID int64) ([]config.Server, error) {
 			&server.VMessSecurity, &server.VMessNetwork, &server.VMessType, &server.VMessHost,
 			&server.VMessPath, &server.VMessTLS, &server.SSMethod, &server.SSPlugin, &server.SSPluginOpts,
 			&server.SSRObfs, &server.SSRObfsParam, &server.SSRProtocol, &server.SSRProtocolParam,
+			&server.VLESSUUID, &server.VLESSFlow, &server.VLESSEncryption, &server.VLESSSecurity,
+			&server.VLESSNetwork, &server.VLESSHeaderType, &server.VLESSHost, &server.VLESSPath,
+			&server.VLESSSNI, &server.VLESSFingerprint, &server.VLESSAlpn, &vlessAllowInsecure,
+			&server.VLESSPublicKey, &server.VLESSShortID, &server.VLESSSpiderX,
+			&server.VMessSNI, &vmessAllowInsecure, &server.TrojanPassword, &server.TrojanSNI,
+			&server.TrojanAlpn, &trojanAllowInsecure, &server.TrojanNetwork, &server.TrojanHost, &server.TrojanPath,
+			&server.UpstreamID, &server.SpeedMbps,
 			&server.RawConfig); err != nil {
 			return nil, fmt.Errorf("扫描服务器数据失败: %w", err)
 		}
 
 		server.Selected = intToBool(selected)
 		server.Enabled = intToBool(enabled)
+		server.VLESSAllowInsecure = intToBool(vlessAllowInsecure)
+		server.VMessAllowInsecure = intToBool(vmessAllowInsecure)
+		server.TrojanAllowInsecure = intToBool(trojanAllowInsecure)
 		
 		// 如果 ProtocolType 为空，设置默认值
 		if server.ProtocolType == "" {
@@ -635,16 +1267,183 @@ func UpdateServerDelay(id string, delay int) error {
 	return nil
 }
 
+// UpdateServerSpeed 更新服务器的下载速度测试结果。
+// 参数：
+//   - id: 服务器 ID
+//   - mbps: 下载速度（Mbps），测试失败时为 -1
+//
+// 返回：错误（如果有）
+func UpdateServerSpeed(id string, mbps float64) error {
+	_, err := DB.Exec(
+		"UPDATE servers SET speed_mbps = ?, updated_at = ? WHERE id = ?",
+		mbps, time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("更新服务器下载速度失败: %w", err)
+	}
+	return nil
+}
+
+// SelectServer 将指定服务器设为唯一选中的服务器。
+// 参数：
+//   - id: 服务器 ID
+//
+// 返回：错误（如果有）
+func SelectServer(id string) error {
+	_, err := DB.Exec("UPDATE servers SET selected = CASE WHEN id = ? THEN 1 ELSE 0 END", id)
+	if err != nil {
+		return fmt.Errorf("更新选中服务器失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateServerUpstream 更新服务器的前置节点（链式代理）。
+// 前置节点由用户设置，订阅刷新时不会被覆盖。
+// 参数：
+//   - id: 服务器 ID
+//   - upstreamID: 前置节点 ID，为空表示直接连接
+func UpdateServerUpstream(id, upstreamID string) error {
+	_, err := DB.Exec(
+		"UPDATE servers SET upstream_id = ?, updated_at = ? WHERE id = ?",
+		upstreamID, time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("更新服务器前置节点失败: %w", err)
+	}
+	return nil
+}
+
 // DeleteServer 删除指定的服务器。
 // 参数：
 //   - id: 要删除的服务器 ID
 //
 // 返回：错误（如果有）
 func DeleteServer(id string) error {
-	_, err := DB.Exec("DELETE FROM servers WHERE id = ?", id)
+	return deleteServer(DB, id)
+}
+
+// deleteServer 在 db（数据库或事务）中删除服务器及其关联数据，逻辑见 DeleteServer
+func deleteServer(db execer, id string) error {
+	_, err := db.Exec("DELETE FROM servers WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("删除服务器失败: %w", err)
 	}
+	// 以该服务器为前置节点的服务器改为直接连接
+	if _, err := db.Exec("UPDATE servers SET upstream_id = '' WHERE upstream_id = ?", id); err != nil {
+		return fmt.Errorf("清除前置节点引用失败: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM latency_samples WHERE server_id = ?", id); err != nil {
+		return fmt.Errorf("删除延迟采样失败: %w", err)
+	}
+	return nil
+}
+
+// RenameServerID 将服务器 ID 从 oldID 改为 newID，同时更新前置节点引用和延迟采样。
+// 如果 newID 已存在（同一节点的重复记录），则合并到已有记录：转移引用和采样、保留选中状态后删除旧记录。
+// 参数：
+//   - oldID: 原服务器 ID
+//   - newID: 新服务器 ID
+//
+// 返回：错误（如果有）
+func RenameServerID(oldID, newID string) error {
+	if oldID == newID {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM servers WHERE id = ?", newID).Scan(&exists); err != nil {
+		return fmt.Errorf("查询服务器失败: %w", err)
+	}
+
+	if exists > 0 {
+		if _, err := tx.Exec(
+			"UPDATE servers SET selected = 1 WHERE id = ? AND EXISTS (SELECT 1 FROM servers WHERE id = ? AND selected = 1)",
+			newID, oldID,
+		); err != nil {
+			return fmt.Errorf("合并选中状态失败: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM servers WHERE id = ?", oldID); err != nil {
+			return fmt.Errorf("删除重复服务器失败: %w", err)
+		}
+	} else if _, err := tx.Exec("UPDATE servers SET id = ? WHERE id = ?", newID, oldID); err != nil {
+		return fmt.Errorf("更新服务器 ID 失败: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE servers SET upstream_id = ? WHERE upstream_id = ?", newID, oldID); err != nil {
+		return fmt.Errorf("更新前置节点引用失败: %w", err)
+	}
+	// 合并后可能出现以自身为前置节点的记录
+	if _, err := tx.Exec("UPDATE servers SET upstream_id = '' WHERE upstream_id = id"); err != nil {
+		return fmt.Errorf("清除前置节点引用失败: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE latency_samples SET server_id = ? WHERE server_id = ?", newID, oldID); err != nil {
+		return fmt.Errorf("更新延迟采样失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// ReplaceSubscriptionServers 在一个事务中用 servers 替换订阅下的服务器：
+// 添加或更新列表中的服务器，删除订阅下不在列表中的服务器（连同前置节点引用和延迟采样）。
+// 任何一步失败时整体回滚，订阅原有的服务器保持不变。
+// 参数：
+//   - subscriptionID: 订阅 ID
+//   - servers: 订阅最新的服务器列表
+//
+// 返回：错误（如果有）
+func ReplaceSubscriptionServers(subscriptionID int64, servers []config.Server) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	keep := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if err := addOrUpdateServer(tx, server, &subscriptionID); err != nil {
+			return err
+		}
+		keep[server.ID] = true
+	}
+
+	rows, err := tx.Query("SELECT id FROM servers WHERE subscription_id = ?", subscriptionID)
+	if err != nil {
+		return fmt.Errorf("查询订阅服务器失败: %w", err)
+	}
+	var stale []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("扫描服务器数据失败: %w", err)
+		}
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("遍历服务器数据失败: %w", err)
+	}
+
+	for _, id := range stale {
+		if err := deleteServer(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
 	return nil
 }
 
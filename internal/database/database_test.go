@@ -2,7 +2,9 @@ package database
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"myproxy.com/p/internal/config"
 )
@@ -106,3 +108,468 @@ func TestDatabase(t *testing.T) {
 		t.Errorf("服务器数量不正确，期望: 1, 实际: %d", len(allServers))
 	}
 }
+
+func TestServerUpstream(t *testing.T) {
+	dbPath := "./test_upstream.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	relay := config.Server{ID: "relay", Name: "中转", Addr: "1.1.1.1", Port: 1080, Enabled: true}
+	landing := config.Server{ID: "landing", Name: "落地", Addr: "2.2.2.2", Port: 1080, Enabled: true, UpstreamID: "relay"}
+	for _, s := range []config.Server{relay, landing} {
+		if err := AddOrUpdateServer(s, nil); err != nil {
+			t.Fatalf("添加服务器失败: %v", err)
+		}
+	}
+
+	got, err := GetServer("landing")
+	if err != nil {
+		t.Fatalf("获取服务器失败: %v", err)
+	}
+	if got.UpstreamID != "relay" {
+		t.Errorf("前置节点不正确，期望: relay, 实际: %s", got.UpstreamID)
+	}
+
+	// 普通更新（如订阅刷新）不覆盖用户设置的前置节点
+	landing.UpstreamID = ""
+	landing.Name = "落地-新"
+	if err := AddOrUpdateServer(landing, nil); err != nil {
+		t.Fatalf("更新服务器失败: %v", err)
+	}
+	if got, _ := GetServer("landing"); got.UpstreamID != "relay" || got.Name != "落地-新" {
+		t.Errorf("更新后前置节点应保留，实际: %+v", got)
+	}
+
+	// 删除前置节点后，引用它的服务器改为直接连接
+	if err := DeleteServer("relay"); err != nil {
+		t.Fatalf("删除服务器失败: %v", err)
+	}
+	if got, _ := GetServer("landing"); got.UpstreamID != "" {
+		t.Errorf("删除前置节点后引用应清除，实际: %s", got.UpstreamID)
+	}
+
+	if err := UpdateServerUpstream("landing", "other"); err != nil {
+		t.Fatalf("更新前置节点失败: %v", err)
+	}
+	all, err := GetAllServers()
+	if err != nil || len(all) != 1 || all[0].UpstreamID != "other" {
+		t.Errorf("获取所有服务器时前置节点不正确: %+v, %v", all, err)
+	}
+}
+
+func TestServerTransportFields(t *testing.T) {
+	dbPath := "./test_transport.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	trojan := config.Server{
+		ID: "trojan", Name: "trojan", Addr: "t.example.com", Port: 443, Enabled: true, ProtocolType: "trojan",
+		Password: "pass", TrojanPassword: "pass", TrojanSNI: "sni.example.com", TrojanAlpn: "h2",
+		TrojanAllowInsecure: true, TrojanNetwork: "ws", TrojanHost: "cdn.example.com", TrojanPath: "/ws",
+	}
+	vmess := config.Server{
+		ID: "vmess", Name: "vmess", Addr: "v.example.com", Port: 443, Enabled: true, ProtocolType: "vmess",
+		VMessUUID: "uuid", VMessTLS: "tls", VMessSNI: "sni.example.com", VMessAllowInsecure: true,
+	}
+	for _, s := range []config.Server{trojan, vmess} {
+		if err := AddOrUpdateServer(s, nil); err != nil {
+			t.Fatalf("添加服务器失败: %v", err)
+		}
+	}
+
+	got, err := GetServer("trojan")
+	if err != nil {
+		t.Fatalf("获取服务器失败: %v", err)
+	}
+	if got.TrojanPassword != "pass" || got.TrojanSNI != "sni.example.com" || got.TrojanAlpn != "h2" || !got.TrojanAllowInsecure ||
+		got.TrojanNetwork != "ws" || got.TrojanHost != "cdn.example.com" || got.TrojanPath != "/ws" {
+		t.Errorf("Trojan 字段不正确: %+v", got)
+	}
+
+	// 更新同样保存这些字段
+	vmess.VMessSNI = "new.example.com"
+	if err := AddOrUpdateServer(vmess, nil); err != nil {
+		t.Fatalf("更新服务器失败: %v", err)
+	}
+	got, err = GetServer("vmess")
+	if err != nil {
+		t.Fatalf("获取服务器失败: %v", err)
+	}
+	if got.VMessSNI != "new.example.com" || !got.VMessAllowInsecure {
+		t.Errorf("VMess 字段不正确: %+v", got)
+	}
+}
+
+func TestSubscriptionSchedule(t *testing.T) {
+	dbPath := "./test_schedule.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	sub, err := AddOrUpdateSubscription("https://example.com/sub", "订阅")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+
+	if err := SetSubscriptionInterval(sub.ID, 6*time.Hour); err != nil {
+		t.Fatalf("设置更新间隔失败: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	schedule := SubscriptionSchedule{
+		LastFailureAt: now,
+		LastError:     "timeout",
+		Failures:      2,
+		NextUpdateAt:  now.Add(4 * time.Minute),
+	}
+	if err := UpdateSubscriptionSchedule(sub.ID, schedule); err != nil {
+		t.Fatalf("保存更新计划失败: %v", err)
+	}
+
+	got, err := GetSubscriptionByID(sub.ID)
+	if err != nil || got == nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	schedule.Interval = 6 * time.Hour
+	if got.Schedule != schedule {
+		t.Errorf("更新计划 = %+v, want %+v", got.Schedule, schedule)
+	}
+
+	// 修改间隔后清空下次更新时间
+	if err := SetSubscriptionInterval(sub.ID, 0); err != nil {
+		t.Fatalf("设置更新间隔失败: %v", err)
+	}
+	if err := UpdateSubscriptionByID(sub.ID, "https://example.com/new", "新标签"); err != nil {
+		t.Fatalf("更新订阅失败: %v", err)
+	}
+	got, err = GetSubscriptionByID(sub.ID)
+	if err != nil || got == nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	if got.Schedule.Interval != 0 || !got.Schedule.NextUpdateAt.IsZero() || got.Schedule.Failures != 2 {
+		t.Errorf("更新计划 = %+v", got.Schedule)
+	}
+	if got.URL != "https://example.com/new" || got.Label != "新标签" {
+		t.Errorf("订阅 = %+v", got)
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	dbPath := "./test_filter.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	sub, err := AddOrUpdateSubscription("https://example.com/sub", "订阅")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	if !sub.Filter.IsZero() {
+		t.Errorf("新订阅的过滤规则 = %+v, want 空", sub.Filter)
+	}
+
+	filter := SubscriptionFilter{
+		Exclude:         "剩余流量|官网",
+		IncludeProtocol: "^(vless|trojan)$",
+		Renames:         []RenameRule{{Pattern: `^\[(\w+)\]\s*`, Replace: "$1 "}},
+	}
+	if err := SetSubscriptionFilter(sub.ID, filter); err != nil {
+		t.Fatalf("设置过滤规则失败: %v", err)
+	}
+	got, err := GetSubscriptionByID(sub.ID)
+	if err != nil || got == nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	if !reflect.DeepEqual(got.Filter, filter) {
+		t.Errorf("过滤规则 = %+v, want %+v", got.Filter, filter)
+	}
+
+	// 零值清除规则
+	if err := SetSubscriptionFilter(sub.ID, SubscriptionFilter{}); err != nil {
+		t.Fatalf("清除过滤规则失败: %v", err)
+	}
+	got, _ = GetSubscriptionByID(sub.ID)
+	if !got.Filter.IsZero() {
+		t.Errorf("清除后过滤规则 = %+v", got.Filter)
+	}
+}
+
+func TestSubscriptionFetchOptions(t *testing.T) {
+	dbPath := "./test_fetch_options.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	sub, err := AddOrUpdateSubscription("https://example.com/sub", "订阅")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	if !sub.FetchOptions.IsZero() {
+		t.Errorf("新订阅的请求设置 = %+v, want 空", sub.FetchOptions)
+	}
+
+	options := SubscriptionFetchOptions{
+		Headers:   map[string]string{"X-Device": "desktop"},
+		UserAgent: "clash.meta",
+		AuthType:  AuthBearer,
+		Token:     "secret",
+		Mirrors:   []string{"https://mirror.example.com/sub"},
+		UseProxy:  true,
+	}
+	if err := SetSubscriptionFetchOptions(sub.ID, options); err != nil {
+		t.Fatalf("设置请求设置失败: %v", err)
+	}
+	got, err := GetSubscriptionByURL(sub.URL)
+	if err != nil || got == nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	if !reflect.DeepEqual(got.FetchOptions, options) {
+		t.Errorf("请求设置 = %+v, want %+v", got.FetchOptions, options)
+	}
+
+	if err := SetSubscriptionFetchOptions(sub.ID, SubscriptionFetchOptions{}); err != nil {
+		t.Fatalf("清除请求设置失败: %v", err)
+	}
+	got, _ = GetSubscriptionByID(sub.ID)
+	if !got.FetchOptions.IsZero() {
+		t.Errorf("清除后请求设置 = %+v", got.FetchOptions)
+	}
+}
+
+func TestSubscriptionParseReport(t *testing.T) {
+	dbPath := "./test_parse_report.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	sub, err := AddOrUpdateSubscription("https://example.com/sub", "订阅")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	if !sub.ParseReport.ParsedAt.IsZero() {
+		t.Errorf("新订阅的解析报告 = %+v, want 空", sub.ParseReport)
+	}
+
+	report := ParseReport{
+		Format:   "链接",
+		Total:    3,
+		Accepted: 2,
+		Rejected: []RejectedEntry{{Line: 2, Content: "hysteria2://***@a:1", Parser: "（无）", Error: "不支持的协议"}},
+		ParsedAt: time.Now().Truncate(time.Second),
+	}
+	if err := SetSubscriptionParseReport(sub.ID, report); err != nil {
+		t.Fatalf("保存解析报告失败: %v", err)
+	}
+	got, _ := GetSubscriptionByID(sub.ID)
+	if got.ParseReport.Summary() != "链接：共 3 条，成功 2 条，失败 1 条" ||
+		!reflect.DeepEqual(got.ParseReport.Rejected, report.Rejected) || !got.ParseReport.ParsedAt.Equal(report.ParsedAt) {
+		t.Errorf("解析报告 = %+v, want %+v", got.ParseReport, report)
+	}
+}
+
+func TestSubscriptionCache(t *testing.T) {
+	dbPath := "./test_cache.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	sub, err := AddOrUpdateSubscription("https://example.com/sub", "订阅")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	cache, err := GetSubscriptionCache(sub.ID)
+	if err != nil || cache == nil || cache.Body != "" || !sub.FetchedAt.IsZero() {
+		t.Fatalf("新订阅的缓存 = %+v, %v", cache, err)
+	}
+
+	want := SubscriptionCache{
+		Body:         "socks5://1.1.1.1:1080",
+		FetchedAt:    time.Now().Truncate(time.Second),
+		ETag:         `"v1"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+	}
+	if err := SaveSubscriptionCache(sub.ID, want); err != nil {
+		t.Fatalf("保存缓存失败: %v", err)
+	}
+	cache, err = GetSubscriptionCache(sub.ID)
+	if err != nil || cache == nil || *cache != want {
+		t.Errorf("缓存 = %+v, %v, want %+v", cache, err, want)
+	}
+	got, _ := GetSubscriptionByID(sub.ID)
+	if !got.FetchedAt.Equal(want.FetchedAt) {
+		t.Errorf("FetchedAt = %v, want %v", got.FetchedAt, want.FetchedAt)
+	}
+
+	// 只修改标签时保留缓存，修改 URL 时清空
+	if err := UpdateSubscriptionByID(sub.ID, sub.URL, "新标签"); err != nil {
+		t.Fatalf("更新订阅失败: %v", err)
+	}
+	if cache, _ := GetSubscriptionCache(sub.ID); cache.Body != want.Body {
+		t.Errorf("修改标签后缓存 = %+v", cache)
+	}
+	if err := UpdateSubscriptionByID(sub.ID, "https://example.com/other", "新标签"); err != nil {
+		t.Fatalf("更新订阅失败: %v", err)
+	}
+	if cache, _ := GetSubscriptionCache(sub.ID); *cache != (SubscriptionCache{}) {
+		t.Errorf("修改 URL 后缓存 = %+v", cache)
+	}
+
+	if cache, err := GetSubscriptionCache(sub.ID + 100); err != nil || cache != nil {
+		t.Errorf("不存在的订阅缓存 = %+v, %v", cache, err)
+	}
+}
+
+func TestLatencySamples(t *testing.T) {
+	dbPath := "./test_latency.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		// a: 5 条，最旧的一条已过期；b: 1 条失败
+		sample := LatencySample{ServerID: "a", TestedAt: now.Add(-time.Duration(i) * time.Hour), Delay: 100 + i, Success: true}
+		if i == 4 {
+			sample.TestedAt = now.Add(-48 * time.Hour)
+		}
+		if err := AddLatencySample(sample); err != nil {
+			t.Fatalf("记录延迟采样失败: %v", err)
+		}
+	}
+	if err := AddLatencySample(LatencySample{ServerID: "b", Delay: -1, Reason: "timeout"}); err != nil {
+		t.Fatalf("记录延迟采样失败: %v", err)
+	}
+
+	samples, err := GetLatencySamples("a", 3, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("查询延迟采样失败: %v", err)
+	}
+	if len(samples) != 3 || samples[0].Delay != 100 || samples[2].Delay != 102 {
+		t.Errorf("延迟采样不正确: %+v", samples)
+	}
+
+	all, err := GetRecentLatencySamples(2, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("查询延迟采样失败: %v", err)
+	}
+	if len(all["a"]) != 2 || len(all["b"]) != 1 || all["b"][0].Success || all["b"][0].Reason != "timeout" {
+		t.Errorf("分组延迟采样不正确: %+v", all)
+	}
+
+	// 清理过期采样，并且每个服务器最多保留 2 条
+	deleted, err := PruneLatencySamples(now.Add(-24*time.Hour), 2)
+	if err != nil {
+		t.Fatalf("清理延迟采样失败: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("删除的采样数 = %d, want 3", deleted)
+	}
+
+	// 删除服务器时一并删除其采样
+	if err := DeleteServer("b"); err != nil {
+		t.Fatalf("删除服务器失败: %v", err)
+	}
+	if samples, _ := GetLatencySamples("b", 10, time.Time{}); len(samples) != 0 {
+		t.Errorf("删除服务器后采样未清除: %+v", samples)
+	}
+}
+
+func TestAppSettings(t *testing.T) {
+	dbPath := "./test_app_settings.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	// 没有保存过设置
+	if cfg, _, err := LoadAppSettings(); err != nil || cfg != nil {
+		t.Fatalf("LoadAppSettings() = %+v, %v, want nil", cfg, err)
+	}
+
+	want := config.DefaultConfig()
+	want.Servers = nil
+	want.AutoProxyPort = 7890
+	want.InboundAccounts = []config.InboundAccount{{User: "u", Pass: "p"}}
+	want.AllowedSources = []string{"192.168.0.0/16"}
+	want.FailoverEnabled = true
+	want.PingTestURL = "https://example.com/204"
+	if err := SaveAppSettings(want); err != nil {
+		t.Fatalf("SaveAppSettings() error = %v", err)
+	}
+	got, invalid, err := LoadAppSettings()
+	if err != nil || len(invalid) != 0 {
+		t.Fatalf("LoadAppSettings() error = %v, invalid = %v", err, invalid)
+	}
+	got.Servers = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadAppSettings() = %+v, want %+v", got, want)
+	}
+
+	// 旧版本未保存的端口和路由模式沿用旧默认值，无法解析的值被忽略
+	if _, err := DB.Exec("DELETE FROM app_config WHERE key IN ('autoProxyPort', 'routingMode')"); err != nil {
+		t.Fatalf("删除配置失败: %v", err)
+	}
+	if err := SetAppConfig("pingTimeout", "abc"); err != nil {
+		t.Fatalf("SetAppConfig() error = %v", err)
+	}
+	got, invalid, err = LoadAppSettings()
+	if err != nil {
+		t.Fatalf("LoadAppSettings() error = %v", err)
+	}
+	if got.AutoProxyPort != legacyProxyPort || got.RoutingMode != config.RoutingModeGlobal {
+		t.Errorf("AutoProxyPort = %d, RoutingMode = %q, want %d, %q", got.AutoProxyPort, got.RoutingMode, legacyProxyPort, config.RoutingModeGlobal)
+	}
+	if _, ok := invalid["pingTimeout"]; !ok || got.PingTimeout != config.DefaultConfig().PingTimeout {
+		t.Errorf("pingTimeout = %d, invalid = %v", got.PingTimeout, invalid)
+	}
+}
+
+func TestAddServers(t *testing.T) {
+	dbPath := "./test_add_servers.db"
+	defer os.Remove(dbPath)
+
+	if err := InitDB(dbPath); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer CloseDB()
+
+	servers := []config.Server{
+		{ID: "a", Name: "a", Addr: "1.1.1.1", Port: 1080, ProtocolType: "socks5", Enabled: true},
+		{ID: "b", Name: "b", Addr: "2.2.2.2", Port: 1080, ProtocolType: "socks5", Enabled: true},
+	}
+	if err := AddServers(servers, nil); err != nil {
+		t.Fatalf("AddServers() error = %v", err)
+	}
+	for _, s := range servers {
+		if got, err := GetServer(s.ID); err != nil || got.Addr != s.Addr {
+			t.Errorf("GetServer(%s) = %+v, %v", s.ID, got, err)
+		}
+	}
+}
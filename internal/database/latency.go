@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// LatencySample 表示一次延迟测试的结果。
+type LatencySample struct {
+	ServerID string    `json:"server_id"`
+	TestedAt time.Time `json:"tested_at"`
+	Delay    int       `json:"delay"`   // 延迟（毫秒），失败时为 -1
+	Success  bool      `json:"success"` // 是否测试成功
+	Reason   string    `json:"reason"`  // 失败原因
+}
+
+// AddLatencySample 记录一次延迟测试结果。
+// 参数：
+//   - sample: 测试结果，TestedAt 为零值时使用当前时间
+//
+// 返回：错误（如果有）
+func AddLatencySample(sample LatencySample) error {
+	if sample.TestedAt.IsZero() {
+		sample.TestedAt = time.Now()
+	}
+	_, err := DB.Exec(
+		"INSERT INTO latency_samples (server_id, tested_at, delay, success, reason) VALUES (?, ?, ?, ?, ?)",
+		sample.ServerID, sample.TestedAt.UnixMilli(), sample.Delay, boolToInt(sample.Success), sample.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("记录延迟采样失败: %w", err)
+	}
+	return nil
+}
+
+// GetLatencySamples 获取指定服务器最近的延迟采样（按时间从新到旧）。
+// 参数：
+//   - serverID: 服务器 ID
+//   - limit: 最多返回的采样数
+//   - since: 只返回该时间之后的采样
+//
+// 返回：采样列表和错误（如果有）
+func GetLatencySamples(serverID string, limit int, since time.Time) ([]LatencySample, error) {
+	rows, err := DB.Query(
+		`SELECT server_id, tested_at, delay, success, reason FROM latency_samples
+		 WHERE server_id = ? AND tested_at >= ?
+		 ORDER BY tested_at DESC, id DESC LIMIT ?`,
+		serverID, since.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询延迟采样失败: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []LatencySample
+	for rows.Next() {
+		sample, err := scanLatencySample(rows)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// GetRecentLatencySamples 获取所有服务器最近的延迟采样，按服务器 ID 分组（每组按时间从新到旧）。
+// 参数：
+//   - limit: 每个服务器最多返回的采样数
+//   - since: 只返回该时间之后的采样
+//
+// 返回：服务器 ID 到采样列表的映射和错误（如果有）
+func GetRecentLatencySamples(limit int, since time.Time) (map[string][]LatencySample, error) {
+	rows, err := DB.Query(
+		`SELECT server_id, tested_at, delay, success, reason FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY server_id ORDER BY tested_at DESC, id DESC) AS rn
+			FROM latency_samples WHERE tested_at >= ?
+		 ) WHERE rn <= ? ORDER BY server_id, tested_at DESC, id DESC`,
+		since.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询延迟采样失败: %w", err)
+	}
+	defer rows.Close()
+
+	samples := make(map[string][]LatencySample)
+	for rows.Next() {
+		sample, err := scanLatencySample(rows)
+		if err != nil {
+			return nil, err
+		}
+		samples[sample.ServerID] = append(samples[sample.ServerID], sample)
+	}
+	return samples, rows.Err()
+}
+
+// PruneLatencySamples 按保留策略清理延迟采样：删除早于 before 的采样，
+// 并且每个服务器只保留最近的 keep 条。
+// 返回：删除的采样数和错误（如果有）
+func PruneLatencySamples(before time.Time, keep int) (int64, error) {
+	result, err := DB.Exec("DELETE FROM latency_samples WHERE tested_at < ?", before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("清理过期延迟采样失败: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	if keep > 0 {
+		result, err = DB.Exec(
+			`DELETE FROM latency_samples WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY server_id ORDER BY tested_at DESC, id DESC) AS rn
+					FROM latency_samples
+				) WHERE rn > ?
+			)`,
+			keep,
+		)
+		if err != nil {
+			return deleted, fmt.Errorf("清理多余延迟采样失败: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// rowScanner 抽象 *sql.Row 和 *sql.Rows 的 Scan 方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLatencySample 读取一行延迟采样
+func scanLatencySample(row rowScanner) (LatencySample, error) {
+	var sample LatencySample
+	var testedAt int64
+	var success int
+	if err := row.Scan(&sample.ServerID, &testedAt, &sample.Delay, &success, &sample.Reason); err != nil {
+		return sample, fmt.Errorf("读取延迟采样失败: %w", err)
+	}
+	sample.TestedAt = time.UnixMilli(testedAt)
+	sample.Success = intToBool(success)
+	return sample, nil
+}
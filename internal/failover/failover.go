@@ -0,0 +1,229 @@
+package failover
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/server"
+)
+
+// Prober 可探测出站连通性的代理实例（由 xray.XrayInstance 实现）
+type Prober interface {
+	IsRunning() bool
+	ProbeOutbound(ctx context.Context, tag, probeURL string) (time.Duration, error)
+}
+
+// SwitchFunc 切换到指定服务器，由调用方负责原地替换出站或重启代理
+type SwitchFunc func(server *config.Server) error
+
+// Options 健康检查参数
+type Options struct {
+	Interval  time.Duration // 探测间隔
+	Threshold int           // 连续失败多少次后切换
+	Cooldown  time.Duration // 两次切换之间的最小间隔
+	ProbeURL  string        // 探测地址，为空时使用 xray 默认探测地址
+	Timeout   time.Duration // 单次探测超时
+}
+
+// OptionsFromConfig 根据应用配置生成健康检查参数
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		Interval:  time.Duration(cfg.FailoverInterval) * time.Second,
+		Threshold: cfg.FailoverThreshold,
+		Cooldown:  time.Duration(cfg.FailoverCooldown) * time.Second,
+	}
+}
+
+// Monitor 当前节点健康监控器。
+// 定期通过运行中的实例探测 "proxy" 出站，连续失败达到阈值后切换到延迟最低的其他启用节点。
+type Monitor struct {
+	serverManager *server.ServerManager
+	logger        *logging.Logger
+	getProber     func() Prober
+	switchTo      SwitchFunc
+	opts          Options
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	failures   int       // 当前连续失败次数
+	lastSwitch time.Time // 上次自动切换时间
+}
+
+// NewMonitor 创建健康监控器
+// 参数：
+//   - serverManager: 服务器管理器，用于获取当前节点和备选节点
+//   - logger: 日志记录器（为 nil 时不记录日志）
+//   - getProber: 返回当前运行的代理实例，代理未运行时返回 nil
+//   - switchTo: 切换节点回调
+//   - opts: 健康检查参数
+func NewMonitor(serverManager *server.ServerManager, logger *logging.Logger, getProber func() Prober, switchTo SwitchFunc, opts Options) *Monitor {
+	// 未设置的参数使用默认值
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 3
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Monitor{
+		serverManager: serverManager,
+		logger:        logger,
+		getProber:     getProber,
+		switchTo:      switchTo,
+		opts:          opts,
+	}
+}
+
+// Start 启动后台健康检查，重复调用时先停止之前的检查
+func (m *Monitor) Start() {
+	m.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.cancel = cancel
+	m.failures = 0
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(m.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Stop 停止后台健康检查
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
+
+// Check 执行一次健康检查，必要时切换节点。
+// 返回：本次是否发生了节点切换
+func (m *Monitor) Check(ctx context.Context) bool {
+	prober := m.getProber()
+	if prober == nil || !prober.IsRunning() {
+		m.mu.Lock()
+		m.failures = 0
+		m.mu.Unlock()
+		return false
+	}
+
+	current, err := m.serverManager.GetSelectedServer()
+	if err != nil {
+		return false
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+	_, probeErr := prober.ProbeOutbound(probeCtx, "proxy", m.opts.ProbeURL)
+	cancel()
+
+	m.mu.Lock()
+	if probeErr == nil {
+		m.failures = 0
+		m.mu.Unlock()
+		return false
+	}
+
+	m.failures++
+	failures := m.failures
+	lastSwitch := m.lastSwitch
+	m.mu.Unlock()
+
+	m.warn("节点 %s 健康检查失败 (%d/%d): %v", current.Name, failures, m.opts.Threshold, probeErr)
+	if failures < m.opts.Threshold {
+		return false
+	}
+
+	// 冷却期内不再切换，避免节点来回抖动
+	if !lastSwitch.IsZero() && time.Since(lastSwitch) < m.opts.Cooldown {
+		m.warn("距离上次自动切换不足 %v，暂不切换节点", m.opts.Cooldown)
+		return false
+	}
+
+	next := PickNextServer(m.serverManager.ListServers(), current.ID)
+	if next == nil {
+		m.error("节点 %s 不可用，且没有其他可用的启用节点", current.Name)
+		return false
+	}
+
+	// 切换回调可能需要等待 UI 线程，调用时不持有锁
+	if err := m.switchTo(next); err != nil {
+		m.error("自动切换到节点 %s 失败: %v", next.Name, err)
+		return false
+	}
+
+	m.mu.Lock()
+	m.failures = 0
+	m.lastSwitch = time.Now()
+	m.mu.Unlock()
+
+	m.warn("节点 %s 连续 %d 次不可用，已自动切换到 %s", current.Name, failures, next.Name)
+	return true
+}
+
+// PickNextServer 从服务器列表中选出除当前节点外最优的启用节点。
+// 优先选择最近测速成功且延迟最低的节点，其次是未测速的节点，最后是测速超时的节点。
+func PickNextServer(servers []config.Server, currentID string) *config.Server {
+	candidates := make([]config.Server, 0, len(servers))
+	for _, s := range servers {
+		if s.Enabled && s.ID != currentID {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// 延迟排序权重：>0 按延迟升序，0（未测速）次之，<0（超时）最后
+	rank := func(delay int) int {
+		switch {
+		case delay > 0:
+			return 0
+		case delay == 0:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := rank(candidates[i].Delay), rank(candidates[j].Delay)
+		if ri != rj {
+			return ri < rj
+		}
+		return candidates[i].Delay < candidates[j].Delay
+	})
+
+	next := candidates[0]
+	return &next
+}
+
+// warn 记录警告日志
+func (m *Monitor) warn(format string, args ...interface{}) {
+	if m.logger != nil {
+		m.logger.Warn(format, args...)
+	}
+}
+
+// error 记录错误日志
+func (m *Monitor) error(format string, args ...interface{}) {
+	if m.logger != nil {
+		m.logger.Error(format, args...)
+	}
+}
@@ -0,0 +1,156 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+// fakeProber 测试用探测器，按 fail 字段返回成功或失败
+type fakeProber struct {
+	fail  bool
+	calls int
+}
+
+func (p *fakeProber) IsRunning() bool { return true }
+
+func (p *fakeProber) ProbeOutbound(ctx context.Context, tag, probeURL string) (time.Duration, error) {
+	p.calls++
+	if p.fail {
+		return 0, errors.New("connection refused")
+	}
+	return 10 * time.Millisecond, nil
+}
+
+func newTestManager() (*config.Config, *server.ServerManager) {
+	cfg := config.DefaultConfig()
+	cfg.Servers = []config.Server{
+		{ID: "a", Name: "A", Enabled: true, Delay: 50},
+		{ID: "b", Name: "B", Enabled: true, Delay: -1},
+		{ID: "c", Name: "C", Enabled: true, Delay: 30},
+		{ID: "d", Name: "D", Enabled: false, Delay: 10},
+	}
+	cfg.SelectedServerID = "a"
+	return cfg, server.NewServerManager(cfg)
+}
+
+func TestPickNextServer(t *testing.T) {
+	servers := []config.Server{
+		{ID: "cur", Enabled: true, Delay: 5},
+		{ID: "timeout", Enabled: true, Delay: -1},
+		{ID: "untested", Enabled: true, Delay: 0},
+		{ID: "slow", Enabled: true, Delay: 200},
+		{ID: "fast", Enabled: true, Delay: 80},
+		{ID: "disabled", Enabled: false, Delay: 1},
+	}
+
+	next := PickNextServer(servers, "cur")
+	if next == nil || next.ID != "fast" {
+		t.Fatalf("期望选择 fast，实际: %+v", next)
+	}
+
+	next = PickNextServer(servers[:3], "cur")
+	if next == nil || next.ID != "untested" {
+		t.Fatalf("期望选择 untested，实际: %+v", next)
+	}
+
+	if next := PickNextServer(servers[:1], "cur"); next != nil {
+		t.Fatalf("没有备选节点时应返回 nil，实际: %+v", next)
+	}
+}
+
+func TestMonitorCheck(t *testing.T) {
+	cfg, sm := newTestManager()
+	prober := &fakeProber{fail: true}
+	var switched []string
+	m := NewMonitor(sm, nil, func() Prober { return prober }, func(s *config.Server) error {
+		switched = append(switched, s.ID)
+		return cfg.SelectServer(s.ID)
+	}, Options{Threshold: 2, Cooldown: time.Hour})
+
+	ctx := context.Background()
+	if m.Check(ctx) {
+		t.Fatal("未达到失败阈值时不应切换")
+	}
+	if !m.Check(ctx) {
+		t.Fatal("达到失败阈值时应切换")
+	}
+	if len(switched) != 1 || switched[0] != "c" {
+		t.Fatalf("期望切换到 c，实际: %v", switched)
+	}
+
+	// 冷却期内即使连续失败也不再切换
+	m.Check(ctx)
+	if m.Check(ctx) {
+		t.Fatal("冷却期内不应再次切换")
+	}
+
+	// 探测成功后失败计数清零
+	prober.fail = false
+	m.Check(ctx)
+	if m.failures != 0 {
+		t.Fatalf("探测成功后失败计数应清零，实际: %d", m.failures)
+	}
+}
+
+func TestMonitorCheckNotRunning(t *testing.T) {
+	_, sm := newTestManager()
+	m := NewMonitor(sm, nil, func() Prober { return nil }, func(s *config.Server) error {
+		t.Fatal("代理未运行时不应切换")
+		return nil
+	}, Options{Threshold: 1})
+
+	if m.Check(context.Background()) {
+		t.Fatal("代理未运行时不应切换")
+	}
+}
+
+func TestMonitorSwitchError(t *testing.T) {
+	_, sm := newTestManager()
+	m := NewMonitor(sm, nil, func() Prober { return &fakeProber{fail: true} }, func(s *config.Server) error {
+		return errors.New("switch failed")
+	}, Options{Threshold: 1})
+
+	if m.Check(context.Background()) {
+		t.Fatal("切换失败时不应返回 true")
+	}
+	if !m.lastSwitch.IsZero() {
+		t.Fatal("切换失败时不应进入冷却期")
+	}
+}
+
+func TestMonitorCheckConcurrentUpdates(t *testing.T) {
+	// 健康检查与测速并发更新服务器时不应产生数据竞争（配合 -race 运行）
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+	defer database.CloseDB()
+
+	cfg, sm := newTestManager()
+	for _, s := range cfg.Servers {
+		if err := database.AddOrUpdateServer(s, nil); err != nil {
+			t.Fatalf("AddOrUpdateServer() error = %v", err)
+		}
+	}
+	m := NewMonitor(sm, nil, func() Prober { return &fakeProber{fail: true} }, func(s *config.Server) error {
+		return sm.SelectServer(s.ID)
+	}, Options{Threshold: 1})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			sm.UpdateServerDelay("c", i)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		m.Check(context.Background())
+	}
+	<-done
+}
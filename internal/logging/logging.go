@@ -279,6 +279,11 @@ func (l *Logger) InfoWithType(logType LogType, format string, args ...interface{
 	l.log(LevelInfo, logType, format, args...)
 }
 
+// Warn 记录警告日志（默认应用日志）
+func (l *Logger) Warn(format string, args ...interface{}) {
+	l.log(LevelWarn, LogTypeApp, format, args...)
+}
+
 // Error 记录错误日志（默认应用日志）
 func (l *Logger) Error(format string, args ...interface{}) {
 	l.log(LevelError, LogTypeApp, format, args...)
@@ -1,35 +1,170 @@
 package ping
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
 	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/logging"
 	"myproxy.com/p/internal/server"
+	"myproxy.com/p/internal/xray"
 )
 
+// 测速失败原因，可通过 errors.Is 区分
+var (
+	ErrTimeout   = errors.New("测速超时")   // 在超时时间内没有收到响应
+	ErrHandshake = errors.New("节点握手失败") // 连接被拒绝或中断（协议、认证或 TLS 配置不正确）
+)
+
+// DefaultTimeout 单次测速的默认超时时间
+const DefaultTimeout = 5 * time.Second
+
 // PingManager 延迟测试管理器
 type PingManager struct {
 	serverManager *server.ServerManager
+
+	mu      sync.RWMutex
+	mode    string        // 测速模式: config.PingModeTCP / config.PingModeURL
+	testURL string        // URL 测速的目标地址
+	timeout time.Duration // 单次测速超时
+
+	historySize   int           // 统计使用的最近采样数（同时是每个服务器保留的采样数）
+	historyWindow time.Duration // 统计使用的时间范围（同时是采样的保留时长）
+
+	speedURL      string        // 下载测速的文件地址
+	speedMaxBytes int64         // 下载测速的数据量上限
+	speedDuration time.Duration // 下载测速的时长上限
+
+	logger *logging.Logger // 日志记录器（可为 nil），用于记录延迟历史写入失败
 }
 
+// 延迟历史默认值
+const (
+	DefaultHistorySize   = 20
+	DefaultHistoryWindow = 24 * time.Hour
+)
+
 // NewPingManager 创建新的延迟测试管理器
 func NewPingManager(serverManager *server.ServerManager) *PingManager {
 	return &PingManager{
 		serverManager: serverManager,
+		mode:          config.PingModeTCP,
+		testURL:       xray.DefaultProbeURL,
+		timeout:       DefaultTimeout,
+		historySize:   DefaultHistorySize,
+		historyWindow: DefaultHistoryWindow,
+		speedURL:      DefaultSpeedTestURL,
+		speedMaxBytes: DefaultSpeedTestBytes,
+		speedDuration: DefaultSpeedTestDuration,
+	}
+}
+
+// SetMode 设置测速模式，为空时使用 TCP 测速
+func (pm *PingManager) SetMode(mode string) {
+	if mode == "" {
+		mode = config.PingModeTCP
 	}
+	pm.mu.Lock()
+	pm.mode = mode
+	pm.mu.Unlock()
 }
 
-// TestServerDelay 测试单个服务器延迟
+// GetMode 获取当前测速模式
+func (pm *PingManager) GetMode() string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.mode
+}
+
+// SetTestURL 设置 URL 测速的目标地址，为空时使用默认地址
+func (pm *PingManager) SetTestURL(testURL string) {
+	if testURL == "" {
+		testURL = xray.DefaultProbeURL
+	}
+	pm.mu.Lock()
+	pm.testURL = testURL
+	pm.mu.Unlock()
+}
+
+// SetTimeout 设置单次测速超时，小于等于 0 时使用默认值
+func (pm *PingManager) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	pm.mu.Lock()
+	pm.timeout = timeout
+	pm.mu.Unlock()
+}
+
+// SetHistory 设置延迟统计和保留策略：统计最近 size 次、window 时间内的采样，
+// 超出范围的采样在清理时删除。参数小于等于 0 时使用默认值。
+func (pm *PingManager) SetHistory(size int, window time.Duration) {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if window <= 0 {
+		window = DefaultHistoryWindow
+	}
+	pm.mu.Lock()
+	pm.historySize = size
+	pm.historyWindow = window
+	pm.mu.Unlock()
+}
+
+// SetLogger 设置日志记录器
+func (pm *PingManager) SetLogger(logger *logging.Logger) {
+	pm.mu.Lock()
+	pm.logger = logger
+	pm.mu.Unlock()
+}
+
+// TestServerDelay 测试单个服务器延迟（按当前测速模式），并记录到延迟历史
 func (pm *PingManager) TestServerDelay(server config.Server) (int, error) {
-	// 使用TCP连接测试延迟
-	addr := fmt.Sprintf("%s:%d", server.Addr, server.Port)
+	return pm.TestServerDelayContext(context.Background(), server)
+}
+
+// TestServerDelayContext 测试单个服务器延迟（按当前测速模式），并记录到延迟历史。
+// ctx 取消时立即返回，被取消中断的结果不记录。单次测速同时受 SetTimeout 设置的超时限制。
+func (pm *PingManager) TestServerDelayContext(ctx context.Context, server config.Server) (int, error) {
+	pm.mu.RLock()
+	mode, testURL, timeout := pm.mode, pm.testURL, pm.timeout
+	pm.mu.RUnlock()
+
+	testCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var delay int
+	var err error
+	if mode == config.PingModeURL {
+		delay, err = pm.TestServerURL(testCtx, server, testURL)
+	} else {
+		delay, err = pm.TestServerTCP(testCtx, server)
+	}
+
+	// 被取消中断的测试结果不可信，不计入历史（超时仍记为失败）
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		pm.recordSample(server.ID, delay, err)
+	}
+	return delay, err
+}
+
+// TestServerTCP 测试与服务器建立 TCP 连接的延迟
+func (pm *PingManager) TestServerTCP(ctx context.Context, server config.Server) (int, error) {
+	addr := net.JoinHostPort(server.Addr, strconv.Itoa(server.Port))
 	start := time.Now()
 
 	// 尝试建立TCP连接
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return -1, fmt.Errorf("连接服务器失败: %w", err)
 	}
@@ -40,39 +175,265 @@ func (pm *PingManager) TestServerDelay(server config.Server) (int, error) {
 	return delay, nil
 }
 
-// TestAllServersDelay 测试所有服务器延迟
-func (pm *PingManager) TestAllServersDelay() map[string]int {
-	// 获取所有服务器
-	servers := pm.serverManager.ListServers()
-	results := make(map[string]int)
-	var wg sync.WaitGroup
-	var mu sync.Mutex
+// TestServerURL 经由节点访问测试地址，返回请求耗时（毫秒）。
+// 测速时为节点创建临时 xray 实例（本地随机端口的 SOCKS5 入站 + 节点出站），
+// 因此能验证协议、认证和 TLS 配置是否真正可用。
+// 超时返回 ErrTimeout，连接被拒绝或中断返回 ErrHandshake。
+func (pm *PingManager) TestServerURL(ctx context.Context, server config.Server, testURL string) (int, error) {
+	if testURL == "" {
+		testURL = xray.DefaultProbeURL
+	}
+
+	transport, stop, err := pm.startTestProxy(server)
+	if err != nil {
+		return -1, err
+	}
+	defer stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testURL, nil)
+	if err != nil {
+		return -1, fmt.Errorf("创建测速请求失败: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return -1, classifyError(ctx, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	delay := int(time.Since(start).Milliseconds())
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return -1, fmt.Errorf("测试地址返回异常状态码: %d", resp.StatusCode)
+	}
+	return delay, nil
+}
 
-	// 并发测试每个服务器
-	for _, s := range servers {
-		if !s.Enabled {
-			continue
+// startTestProxy 为服务器启动一个临时 xray 实例（节点设置了前置节点时同样经过前置节点），
+// 返回经由该实例访问外部的 HTTP Transport。使用完毕后必须调用 stop 释放实例。
+func (pm *PingManager) startTestProxy(server config.Server) (transport *http.Transport, stop func(), err error) {
+	// 节点设置了前置节点时，测速同样经过前置节点
+	var upstreams []config.Server
+	if server.UpstreamID != "" && pm.serverManager != nil {
+		chain, err := pm.serverManager.ResolveChain(server.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("解析前置节点失败: %w", err)
 		}
+		for _, hop := range chain {
+			upstreams = append(upstreams, *hop)
+		}
+	}
 
+	port, err := xray.FindFreePort(config.DefaultListenAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := xray.CreateURLTestConfig(port, &server, upstreams)
+	if err != nil {
+		return nil, nil, err
+	}
+	instance, err := xray.NewEphemeralInstance(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建测速实例失败: %w", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Stop()
+		return nil, nil, fmt.Errorf("启动测速实例失败: %w", err)
+	}
+
+	proxyURL := &url.URL{Scheme: "socks5", Host: net.JoinHostPort(config.DefaultListenAddr, strconv.Itoa(port))}
+	transport = &http.Transport{
+		Proxy:             http.ProxyURL(proxyURL),
+		DisableKeepAlives: true,
+	}
+
+	stop = func() {
+		transport.CloseIdleConnections()
+		instance.Stop()
+	}
+	return transport, stop, nil
+}
+
+// classifyError 将请求错误归类为超时或握手失败
+func classifyError(ctx context.Context, err error) error {
+	var netErr net.Error
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrHandshake, err)
+}
+
+// Result 单个服务器的测速结果
+type Result struct {
+	Server config.Server // 被测试的服务器
+	Delay  int           // 延迟（毫秒），失败时为 -1
+	Err    error         // 失败原因，成功时为 nil
+}
+
+// BatchOptions 批量测速参数
+type BatchOptions struct {
+	Concurrency int           // 同时测试的服务器数量，小于等于 0 时使用 DefaultConcurrency
+	Timeout     time.Duration // 单个服务器的超时，小于等于 0 时使用 SetTimeout 设置的值
+}
+
+// DefaultConcurrency 批量测速的默认并发数
+const DefaultConcurrency = 16
+
+// TestServers 以有限的并发数批量测试服务器延迟。
+// 每个服务器测试完成后立即通过返回的通道发送结果，并写入服务器管理器（失败记为 -1）；
+// 全部完成或 ctx 取消后关闭通道。取消后未开始和被中断的服务器不会发送结果。
+// 调用方需要持续读取通道直到关闭。
+func (pm *PingManager) TestServers(ctx context.Context, servers []config.Server, opts BatchOptions) <-chan Result {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if concurrency > len(servers) {
+		concurrency = len(servers)
+	}
+
+	jobs := make(chan config.Server)
+	results := make(chan Result, concurrency)
+
+	// 分发任务，ctx 取消后停止分发
+	go func() {
+		defer close(jobs)
+		for _, s := range servers {
+			select {
+			case jobs <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
-		go func(server config.Server) {
+		go func() {
 			defer wg.Done()
+			for server := range jobs {
+				delay, err := pm.testWithTimeout(ctx, server, opts.Timeout)
+
+				// 被取消中断的测试结果不可信，直接丢弃
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					delay = -1
+				}
+
+				if pm.serverManager != nil {
+					pm.serverManager.UpdateServerDelay(server.ID, delay)
+				}
 
-			delay, err := pm.TestServerDelay(server)
-			mu.Lock()
-			if err != nil {
-				results[server.ID] = -1
-			} else {
-				results[server.ID] = delay
-				// 更新服务器延迟
-				pm.serverManager.UpdateServerDelay(server.ID, delay)
+				select {
+				case results <- Result{Server: server, Delay: delay, Err: err}:
+				case <-ctx.Done():
+					return
+				}
 			}
-			mu.Unlock()
-		}(s)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		// 每轮批量测速后按保留策略清理历史
+		pm.PruneHistory()
+		close(results)
+	}()
+
+	return results
+}
+
+// testWithTimeout 测试单个服务器延迟，timeout 大于 0 时额外限制本次测试的超时
+func (pm *PingManager) testWithTimeout(ctx context.Context, server config.Server, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	return pm.TestServerDelayContext(ctx, server)
+}
 
-	// 等待所有测试完成
-	wg.Wait()
+// TestAllServersDelay 测试所有启用服务器的延迟（以默认并发数执行），返回服务器 ID 到延迟的映射
+func (pm *PingManager) TestAllServersDelay() map[string]int {
+	var servers []config.Server
+	for _, s := range pm.serverManager.ListServers() {
+		if s.Enabled {
+			servers = append(servers, s)
+		}
+	}
 
+	results := make(map[string]int)
+	for result := range pm.TestServers(context.Background(), servers, BatchOptions{}) {
+		results[result.Server.ID] = result.Delay
+	}
 	return results
 }
+
+// recordSample 记录一次测速结果到延迟历史（数据库未初始化时跳过）
+func (pm *PingManager) recordSample(serverID string, delay int, err error) {
+	if database.DB == nil {
+		return
+	}
+	sample := database.LatencySample{ServerID: serverID, Delay: delay, Success: err == nil}
+	if err != nil {
+		sample.Delay = -1
+		sample.Reason = err.Error()
+	}
+	if err := database.AddLatencySample(sample); err != nil {
+		pm.mu.RLock()
+		logger := pm.logger
+		pm.mu.RUnlock()
+		if logger != nil {
+			logger.Error("记录延迟历史失败: %v", err)
+		}
+	}
+}
+
+// historyRange 返回当前的统计采样数和起始时间
+func (pm *PingManager) historyRange() (int, time.Time) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.historySize, time.Now().Add(-pm.historyWindow)
+}
+
+// GetServerStats 获取单个服务器的延迟统计
+func (pm *PingManager) GetServerStats(serverID string) (Stats, error) {
+	size, since := pm.historyRange()
+	samples, err := database.GetLatencySamples(serverID, size, since)
+	if err != nil {
+		return Stats{}, err
+	}
+	return ComputeStats(samples), nil
+}
+
+// GetAllStats 获取所有有采样的服务器的延迟统计，返回服务器 ID 到统计结果的映射
+func (pm *PingManager) GetAllStats() (map[string]Stats, error) {
+	size, since := pm.historyRange()
+	samples, err := database.GetRecentLatencySamples(size, since)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]Stats, len(samples))
+	for id, serverSamples := range samples {
+		stats[id] = ComputeStats(serverSamples)
+	}
+	return stats, nil
+}
+
+// PruneHistory 按保留策略清理延迟历史（数据库未初始化时跳过）
+// 返回：删除的采样数和错误（如果有）
+func (pm *PingManager) PruneHistory() (int64, error) {
+	if database.DB == nil {
+		return 0, nil
+	}
+	size, since := pm.historyRange()
+	return database.PruneLatencySamples(since, size)
+}
@@ -0,0 +1,225 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+	"myproxy.com/p/internal/xray"
+)
+
+// startSocksNode 启动一个本地 SOCKS5 代理作为测试节点（直连模式，可选认证）
+func startSocksNode(t *testing.T, accounts []config.InboundAccount) int {
+	t.Helper()
+	port, err := xray.FindFreePort(config.DefaultListenAddr)
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	dummy := &config.Server{Addr: "127.0.0.1", Port: 1, ProtocolType: "socks5"}
+	data, err := xray.CreateXrayConfigWithOptions(port, dummy, xray.ConfigOptions{
+		RoutingMode: config.RoutingModeDirect,
+		Accounts:    accounts,
+	})
+	if err != nil {
+		t.Fatalf("CreateXrayConfigWithOptions() error = %v", err)
+	}
+	xi, err := xray.NewXrayInstanceFromJSON(data)
+	if err != nil {
+		t.Fatalf("NewXrayInstanceFromJSON() error = %v", err)
+	}
+	if err := xi.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { xi.Stop() })
+	return port
+}
+
+// startListener 启动一个 TCP 监听，每个连接交给 handle 处理
+func startListener(t *testing.T, handle func(net.Conn)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func newTestPingManager() *PingManager {
+	return NewPingManager(server.NewServerManager(config.DefaultConfig()))
+}
+
+func TestServerTCP(t *testing.T) {
+	port := startListener(t, func(conn net.Conn) { conn.Close() })
+	pm := newTestPingManager()
+
+	if _, err := pm.TestServerDelay(config.Server{Addr: "127.0.0.1", Port: port}); err != nil {
+		t.Errorf("TCP 测速失败: %v", err)
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	pm := newTestPingManager()
+	pm.SetMode(config.PingModeURL)
+	pm.SetTestURL(target.URL)
+	pm.SetTimeout(3 * time.Second)
+
+	// 正常节点：经由节点访问测试地址成功
+	port := startSocksNode(t, nil)
+	node := config.Server{Addr: "127.0.0.1", Port: port, ProtocolType: "socks5"}
+	if delay, err := pm.TestServerDelay(node); err != nil || delay < 0 {
+		t.Errorf("URL 测速 = %d, %v, want success", delay, err)
+	}
+
+	// 认证错误：TCP 可以连通，但握手失败
+	authPort := startSocksNode(t, []config.InboundAccount{{User: "user", Pass: "secret"}})
+	badAuth := config.Server{Addr: "127.0.0.1", Port: authPort, ProtocolType: "socks5", Username: "user", Password: "wrong"}
+	if _, err := pm.TestServerTCP(context.Background(), badAuth); err != nil {
+		t.Fatalf("TCP 测速失败: %v", err)
+	}
+	if _, err := pm.TestServerDelay(badAuth); !errors.Is(err, ErrHandshake) {
+		t.Errorf("认证错误 error = %v, want ErrHandshake", err)
+	}
+
+	// 节点接受连接但不响应：超时
+	silentPort := startListener(t, func(conn net.Conn) {
+		time.Sleep(5 * time.Second)
+		conn.Close()
+	})
+	silent := config.Server{Addr: "127.0.0.1", Port: silentPort, ProtocolType: "socks5"}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := pm.TestServerURL(ctx, silent, target.URL); !errors.Is(err, ErrTimeout) {
+		t.Errorf("无响应节点 error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestServers(t *testing.T) {
+	openPort := startListener(t, func(conn net.Conn) { conn.Close() })
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	// 测速结果会写入数据库
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	cfg := config.DefaultConfig()
+	for i := 0; i < 20; i++ {
+		port := openPort
+		if i%5 == 0 {
+			port = closedPort
+		}
+		cfg.Servers = append(cfg.Servers, config.Server{
+			ID: fmt.Sprintf("s%d", i), Addr: "127.0.0.1", Port: port, Enabled: true,
+		})
+	}
+	pm := NewPingManager(server.NewServerManager(cfg))
+
+	// 每个服务器都返回一个结果，并写入服务器管理器
+	seen := map[string]bool{}
+	failed := 0
+	for result := range pm.TestServers(context.Background(), cfg.Servers, BatchOptions{Concurrency: 4, Timeout: time.Second}) {
+		seen[result.Server.ID] = true
+		if result.Err != nil {
+			failed++
+			if result.Delay != -1 {
+				t.Errorf("失败结果的延迟 = %d, want -1", result.Delay)
+			}
+		}
+	}
+	if len(seen) != len(cfg.Servers) || failed != 4 {
+		t.Errorf("收到 %d 个结果（失败 %d 个），want %d 个（失败 4 个）", len(seen), failed, len(cfg.Servers))
+	}
+	if s, _ := cfg.GetServer("s0"); s.Delay != -1 {
+		t.Errorf("s0 延迟 = %d, want -1", s.Delay)
+	}
+
+	// 每次测速都记录到延迟历史，失败同样记录
+	stats, err := pm.GetAllStats()
+	if err != nil {
+		t.Fatalf("GetAllStats() error = %v", err)
+	}
+	if st := stats["s0"]; st.Samples != 1 || st.SuccessRate != 0 || st.Median != -1 {
+		t.Errorf("s0 统计 = %+v, want 1 次失败", st)
+	}
+	if st, err := pm.GetServerStats("s1"); err != nil || st.Samples != 1 || st.SuccessRate != 1 || st.Median < 0 {
+		t.Errorf("s1 统计 = %+v, %v, want 1 次成功", st, err)
+	}
+
+	// 单个测速同样记录，被取消的测速不记录
+	if _, err := pm.TestServerDelayContext(context.Background(), cfg.Servers[1]); err != nil {
+		t.Fatalf("TestServerDelayContext() error = %v", err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	pm.TestServerDelayContext(canceled, cfg.Servers[1])
+	if st, err := pm.GetServerStats("s1"); err != nil || st.Samples != 2 {
+		t.Errorf("s1 统计 = %+v, %v, want 2 次采样", st, err)
+	}
+}
+
+func TestServersCancel(t *testing.T) {
+	// 节点接受连接但不响应，取消后应尽快关闭结果通道
+	silentPort := startListener(t, func(conn net.Conn) {
+		time.Sleep(5 * time.Second)
+		conn.Close()
+	})
+	var servers []config.Server
+	for i := 0; i < 10; i++ {
+		servers = append(servers, config.Server{ID: fmt.Sprintf("s%d", i), Addr: "127.0.0.1", Port: silentPort, ProtocolType: "socks5"})
+	}
+
+	pm := NewPingManager(nil)
+	pm.SetMode(config.PingModeURL)
+	pm.SetTimeout(10 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := pm.TestServers(ctx, servers, BatchOptions{Concurrency: 2})
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	done := make(chan int)
+	go func() {
+		count := 0
+		for range results {
+			count++
+		}
+		done <- count
+	}()
+	select {
+	case count := <-done:
+		if count != 0 {
+			t.Errorf("取消后收到 %d 个结果, want 0", count)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("取消后结果通道未关闭")
+	}
+}
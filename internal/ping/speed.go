@@ -0,0 +1,156 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"myproxy.com/p/internal/config"
+)
+
+// 下载测速默认值
+const (
+	DefaultSpeedTestURL      = "https://speed.cloudflare.com/__down?bytes=104857600"
+	DefaultSpeedTestBytes    = 50 << 20 // 50 MB
+	DefaultSpeedTestDuration = 10 * time.Second
+)
+
+// SpeedResult 单个服务器的下载测速结果
+type SpeedResult struct {
+	Server  config.Server
+	Mbps    float64       // 下载速度（Mbps），失败时为 -1
+	Bytes   int64         // 实际下载的字节数
+	Elapsed time.Duration // 下载耗时（从收到响应头开始计算）
+	Err     error
+}
+
+// SetSpeedTest 设置下载测速的文件地址和上限：下载达到 maxBytes 字节或持续 duration 后停止。
+// 参数为空或小于等于 0 时使用默认值。
+func (pm *PingManager) SetSpeedTest(testURL string, maxBytes int64, duration time.Duration) {
+	if testURL == "" {
+		testURL = DefaultSpeedTestURL
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpeedTestBytes
+	}
+	if duration <= 0 {
+		duration = DefaultSpeedTestDuration
+	}
+	pm.mu.Lock()
+	pm.speedURL = testURL
+	pm.speedMaxBytes = maxBytes
+	pm.speedDuration = duration
+	pm.mu.Unlock()
+}
+
+// TestServerSpeed 经由服务器下载测速文件，测量下载速度（不写入数据库）。
+// 建立连接受测速超时限制，下载过程在达到数据量或时长上限后停止；
+// 中途断开时只要已经下载到数据，仍按已下载的部分计算速度。
+func (pm *PingManager) TestServerSpeed(ctx context.Context, server config.Server) SpeedResult {
+	pm.mu.RLock()
+	testURL, maxBytes, duration, timeout := pm.speedURL, pm.speedMaxBytes, pm.speedDuration, pm.timeout
+	pm.mu.RUnlock()
+
+	result := SpeedResult{Server: server, Mbps: -1}
+
+	transport, stop, err := pm.startTestProxy(server)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer stop()
+	transport.ResponseHeaderTimeout = timeout
+
+	// 达到时长上限时通过取消请求结束下载
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, testURL, nil)
+	if err != nil {
+		result.Err = fmt.Errorf("创建下载测速请求失败: %w", err)
+		return result
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		result.Err = classifyError(ctx, err)
+		return result
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.Err = fmt.Errorf("下载测速地址返回异常状态码: %d", resp.StatusCode)
+		return result
+	}
+
+	var budgetReached atomic.Bool
+	timer := time.AfterFunc(duration, func() {
+		budgetReached.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBytes))
+	result.Elapsed = time.Since(start)
+	result.Bytes = n
+
+	// 外部取消的结果不可信
+	if ctx.Err() != nil {
+		result.Err = ctx.Err()
+		return result
+	}
+	if n == 0 {
+		if err != nil && !budgetReached.Load() {
+			result.Err = classifyError(ctx, err)
+		} else {
+			result.Err = errors.New("下载测速没有收到数据")
+		}
+		return result
+	}
+	result.Mbps = mbps(n, result.Elapsed)
+	return result
+}
+
+// TestServersSpeed 依次对服务器做下载测速，结果通过返回的通道逐个送出，
+// 全部完成或 ctx 取消后通道关闭。节点之间串行执行，避免相互争抢带宽影响结果。
+// 每个服务器的结果（失败时为 -1）都会写入数据库。
+func (pm *PingManager) TestServersSpeed(ctx context.Context, servers []config.Server) <-chan SpeedResult {
+	results := make(chan SpeedResult)
+
+	go func() {
+		defer close(results)
+		for _, server := range servers {
+			if ctx.Err() != nil {
+				return
+			}
+			result := pm.TestServerSpeed(ctx, server)
+			// 被取消中断的测试结果不可信，直接丢弃
+			if ctx.Err() != nil {
+				return
+			}
+
+			if pm.serverManager != nil {
+				pm.serverManager.UpdateServerSpeed(server.ID, result.Mbps)
+			}
+
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return results
+}
+
+// mbps 根据下载字节数和耗时计算速度（Mbps）
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	return float64(bytes) * 8 / elapsed.Seconds() / 1e6
+}
@@ -0,0 +1,103 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+// newDownloadServer 启动一个持续输出数据的 HTTP 服务，每次写入 chunk 字节后等待 interval
+func newDownloadServer(t *testing.T, chunk int, interval time.Duration) *httptest.Server {
+	t.Helper()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, chunk)
+		for {
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			if interval > 0 {
+				select {
+				case <-time.After(interval):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(target.Close)
+	return target
+}
+
+func TestServerSpeed(t *testing.T) {
+	port := startSocksNode(t, nil)
+	node := config.Server{Addr: "127.0.0.1", Port: port, ProtocolType: "socks5"}
+
+	// 达到数据量上限后停止
+	fast := newDownloadServer(t, 32<<10, 0)
+	pm := newTestPingManager()
+	pm.SetSpeedTest(fast.URL, 1<<20, 5*time.Second)
+	result := pm.TestServerSpeed(context.Background(), node)
+	if result.Err != nil || result.Bytes != 1<<20 || result.Mbps <= 0 {
+		t.Errorf("数据量上限: %+v, want 下载 1MB 且速度 > 0", result)
+	}
+
+	// 达到时长上限后停止，已下载的部分仍计算速度
+	slow := newDownloadServer(t, 1<<10, 10*time.Millisecond)
+	pm.SetSpeedTest(slow.URL, 1<<30, 300*time.Millisecond)
+	start := time.Now()
+	result = pm.TestServerSpeed(context.Background(), node)
+	if result.Err != nil || result.Bytes == 0 || result.Mbps <= 0 {
+		t.Errorf("时长上限: %+v, want 成功", result)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("时长上限未生效，耗时 %v", elapsed)
+	}
+}
+
+func TestServersSpeed(t *testing.T) {
+	port := startSocksNode(t, nil)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	cfg := config.DefaultConfig()
+	cfg.Servers = []config.Server{
+		{ID: "ok", Addr: "127.0.0.1", Port: port, ProtocolType: "socks5", Enabled: true},
+		{ID: "down", Addr: "127.0.0.1", Port: closedPort, ProtocolType: "socks5", Enabled: true},
+	}
+	pm := NewPingManager(server.NewServerManager(cfg))
+	pm.SetTimeout(2 * time.Second)
+	pm.SetSpeedTest(newDownloadServer(t, 32<<10, 0).URL, 256<<10, 5*time.Second)
+
+	// 按顺序返回每个服务器的结果，并写入服务器管理器
+	var order []string
+	for result := range pm.TestServersSpeed(context.Background(), cfg.Servers) {
+		order = append(order, result.Server.ID)
+	}
+	if len(order) != 2 || order[0] != "ok" || order[1] != "down" {
+		t.Errorf("结果顺序 = %v, want [ok down]", order)
+	}
+	if s, _ := cfg.GetServer("ok"); s.SpeedMbps <= 0 {
+		t.Errorf("ok 速度 = %v, want > 0", s.SpeedMbps)
+	}
+	if s, _ := cfg.GetServer("down"); s.SpeedMbps != -1 {
+		t.Errorf("down 速度 = %v, want -1", s.SpeedMbps)
+	}
+}
@@ -0,0 +1,75 @@
+package ping
+
+import (
+	"sort"
+	"time"
+
+	"myproxy.com/p/internal/database"
+)
+
+// Stats 服务器最近若干次测速的统计结果
+type Stats struct {
+	Samples     int       // 采样总数
+	Successes   int       // 成功次数
+	SuccessRate float64   // 成功率（0-1），无采样时为 0
+	Median      int       // 成功采样的延迟中位数（毫秒），无成功采样时为 -1
+	P95         int       // 成功采样的 95 分位延迟（毫秒），无成功采样时为 -1
+	Jitter      int       // 抖动：相邻两次成功采样延迟差的平均值（毫秒）
+	LastTested  time.Time // 最近一次测速时间
+}
+
+// ComputeStats 根据延迟采样计算统计结果，采样顺序不限
+func ComputeStats(samples []database.LatencySample) Stats {
+	stats := Stats{Samples: len(samples), Median: -1, P95: -1}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	// 按时间从旧到新排列，用于计算抖动
+	ordered := make([]database.LatencySample, len(samples))
+	copy(ordered, samples)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].TestedAt.Before(ordered[j].TestedAt)
+	})
+	stats.LastTested = ordered[len(ordered)-1].TestedAt
+
+	var delays []int
+	jitterSum, jitterCount := 0, 0
+	prev := -1
+	for _, sample := range ordered {
+		if !sample.Success {
+			continue
+		}
+		delays = append(delays, sample.Delay)
+		if prev >= 0 {
+			diff := sample.Delay - prev
+			if diff < 0 {
+				diff = -diff
+			}
+			jitterSum += diff
+			jitterCount++
+		}
+		prev = sample.Delay
+	}
+
+	stats.Successes = len(delays)
+	stats.SuccessRate = float64(stats.Successes) / float64(stats.Samples)
+	if jitterCount > 0 {
+		stats.Jitter = jitterSum / jitterCount
+	}
+	if len(delays) > 0 {
+		sort.Ints(delays)
+		stats.Median = percentile(delays, 50)
+		stats.P95 = percentile(delays, 95)
+	}
+	return stats
+}
+
+// percentile 计算已排序数据的分位数（最近秩法）
+func percentile(sorted []int, p int) int {
+	rank := (p*len(sorted) + 99) / 100 // 向上取整
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,48 @@
+package ping
+
+import (
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/database"
+)
+
+func TestComputeStats(t *testing.T) {
+	if stats := ComputeStats(nil); stats.Samples != 0 || stats.Median != -1 || stats.P95 != -1 {
+		t.Errorf("空采样统计 = %+v", stats)
+	}
+
+	now := time.Now()
+	delays := []int{100, 120, -1, 110, 300, 105, 115, -1, 125, 130}
+	var samples []database.LatencySample
+	for i, delay := range delays {
+		samples = append(samples, database.LatencySample{
+			ServerID: "a",
+			TestedAt: now.Add(time.Duration(i) * time.Second),
+			Delay:    delay,
+			Success:  delay > 0,
+		})
+	}
+
+	stats := ComputeStats(samples)
+	if stats.Samples != 10 || stats.Successes != 8 {
+		t.Errorf("采样数 = %d/%d, want 8/10", stats.Successes, stats.Samples)
+	}
+	if stats.SuccessRate != 0.8 {
+		t.Errorf("成功率 = %v, want 0.8", stats.SuccessRate)
+	}
+	// 成功延迟排序：100 105 110 115 120 125 130 300
+	if stats.Median != 115 {
+		t.Errorf("中位数 = %d, want 115", stats.Median)
+	}
+	if stats.P95 != 300 {
+		t.Errorf("P95 = %d, want 300", stats.P95)
+	}
+	// 相邻成功采样：100 120 110 300 105 115 125 130，差值之和 20+10+190+195+10+10+5=440
+	if stats.Jitter != 440/7 {
+		t.Errorf("抖动 = %d, want %d", stats.Jitter, 440/7)
+	}
+	if !stats.LastTested.Equal(samples[9].TestedAt) {
+		t.Errorf("最近测速时间 = %v, want %v", stats.LastTested, samples[9].TestedAt)
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
-	"time"
+	"strconv"
+	"strings"
+	"sync"
 
 	"myproxy.com/p/internal/config"
 	"myproxy.com/p/internal/database"
 )
 
-// ServerManager 服务器管理器
+// ServerManager 服务器管理器。
+// 方法可在后台 goroutine（测速、故障转移）中并发调用，返回的服务器均为副本。
 type ServerManager struct {
+	mu     sync.RWMutex // 保护 config 中的服务器列表和选中状态
 	config *config.Config
 }
 
@@ -30,6 +34,8 @@ func (sm *ServerManager) LoadServersFromDB() error {
 		return fmt.Errorf("加载服务器列表失败: %w", err)
 	}
 
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sm.config.Servers = servers
 	sm.config.SelectedServerID = ""
 	for _, srv := range servers {
@@ -44,6 +50,8 @@ func (sm *ServerManager) LoadServersFromDB() error {
 
 // AddServer 添加服务器
 func (sm *ServerManager) AddServer(server config.Server) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	// 先添加到内存配置
 	if err := sm.config.AddServer(server); err != nil {
 		return err
@@ -59,6 +67,8 @@ func (sm *ServerManager) AddServer(server config.Server) error {
 
 // RemoveServer 删除服务器
 func (sm *ServerManager) RemoveServer(id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	// 先从内存配置删除
 	if err := sm.config.RemoveServer(id); err != nil {
 		return err
@@ -72,45 +82,77 @@ func (sm *ServerManager) RemoveServer(id string) error {
 	return nil
 }
 
-// GetServer 获取服务器
+// GetServer 获取服务器（副本）
 func (sm *ServerManager) GetServer(id string) (*config.Server, error) {
-	return sm.config.GetServer(id)
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	server, err := sm.config.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *server
+	return &copied, nil
 }
 
 // ListServers 获取当前选中订阅的服务器列表
 func (sm *ServerManager) ListServers() []config.Server {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 	// 如果未选择订阅或选择了全部订阅（ID为0），返回所有服务器
 	if sm.config.SelectedSubscriptionID == 0 {
-		return sm.config.Servers
+		return sm.copyServers()
 	}
 	
 	// 否则返回指定订阅下的服务器
 	servers, err := sm.GetServersBySubscriptionID(sm.config.SelectedSubscriptionID)
 	if err != nil {
 		// 如果获取失败，返回所有服务器作为后备
-		return sm.config.Servers
+		return sm.copyServers()
 	}
 	
 	return servers
 }
 
-// SelectServer 选择服务器
+// copyServers 返回内存服务器列表的副本，调用方需持有 sm.mu
+func (sm *ServerManager) copyServers() []config.Server {
+	servers := make([]config.Server, len(sm.config.Servers))
+	copy(servers, sm.config.Servers)
+	return servers
+}
+
+// SelectServer 选择服务器，选中状态同时保存到数据库
 func (sm *ServerManager) SelectServer(id string) error {
-	return sm.config.SelectServer(id)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if err := sm.config.SelectServer(id); err != nil {
+		return err
+	}
+
+	if err := database.SelectServer(id); err != nil {
+		return fmt.Errorf("保存选中服务器失败: %w", err)
+	}
+
+	return nil
 }
 
 // GetSelectedServer 获取当前选中的服务器
 func (sm *ServerManager) GetSelectedServer() (*config.Server, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 	return sm.config.GetSelectedServer()
 }
 
 // GetSelectedSubscriptionID 获取当前选中的订阅ID
 func (sm *ServerManager) GetSelectedSubscriptionID() int64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 	return sm.config.SelectedSubscriptionID
 }
 
 // SetSelectedSubscriptionID 设置当前选中的订阅ID
 func (sm *ServerManager) SetSelectedSubscriptionID(subscriptionID int64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sm.config.SelectedSubscriptionID = subscriptionID
 }
 
@@ -127,9 +169,13 @@ func (sm *ServerManager) GetServersBySubscriptionID(subscriptionID int64) ([]con
 
 // UpdateServer 更新服务器信息
 func (sm *ServerManager) UpdateServer(server config.Server) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	// 先更新内存配置
 	for i, s := range sm.config.Servers {
 		if s.ID == server.ID {
+			// 前置节点由 SetServerUpstream 单独维护，更新服务器信息时保留
+			server.UpstreamID = s.UpstreamID
 			sm.config.Servers[i] = server
 			// 如果更新的是选中的服务器，确保选中状态正确
 			if server.ID == sm.config.SelectedServerID {
@@ -151,6 +197,8 @@ func (sm *ServerManager) UpdateServer(server config.Server) error {
 
 // UpdateServerDelay 更新服务器延迟
 func (sm *ServerManager) UpdateServerDelay(id string, delay int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	// 先更新内存配置
 	for i, s := range sm.config.Servers {
 		if s.ID == id {
@@ -168,10 +216,163 @@ func (sm *ServerManager) UpdateServerDelay(id string, delay int) error {
 	return fmt.Errorf("服务器不存在: %s", id)
 }
 
-// GenerateServerID 生成服务器唯一ID
-func GenerateServerID(addr string, port int, username string) string {
-	// 使用地址、端口和用户名生成唯一ID
-	data := fmt.Sprintf("%s:%d:%s:%d", addr, port, username, time.Now().UnixNano())
-	hash := md5.Sum([]byte(data))
+// UpdateServerSpeed 更新服务器下载速度（Mbps）
+func (sm *ServerManager) UpdateServerSpeed(id string, mbps float64) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for i, s := range sm.config.Servers {
+		if s.ID == id {
+			sm.config.Servers[i].SpeedMbps = mbps
+
+			if err := database.UpdateServerSpeed(id, mbps); err != nil {
+				return fmt.Errorf("更新服务器下载速度到数据库失败: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("服务器不存在: %s", id)
+}
+
+// SetServerUpstream 设置服务器的前置节点（链式代理），upstreamID 为空表示直接连接。
+// 前置节点不存在或会形成循环引用时返回错误。
+func (sm *ServerManager) SetServerUpstream(id, upstreamID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	target, err := sm.config.GetServer(id)
+	if err != nil {
+		return err
+	}
+
+	if upstreamID != "" {
+		// 在副本上校验，避免无效的链写入配置
+		servers := make([]config.Server, len(sm.config.Servers))
+		copy(servers, sm.config.Servers)
+		for i := range servers {
+			if servers[i].ID == id {
+				servers[i].UpstreamID = upstreamID
+			}
+		}
+		if _, err := config.ResolveChain(servers, id); err != nil {
+			return err
+		}
+	}
+
+	if err := database.UpdateServerUpstream(id, upstreamID); err != nil {
+		return err
+	}
+	target.UpstreamID = upstreamID
+	return nil
+}
+
+// ResolveChain 解析服务器的前置节点链（见 config.ResolveChain），返回的节点为副本
+func (sm *ServerManager) ResolveChain(id string) ([]*config.Server, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return config.ResolveChain(sm.copyServers(), id)
+}
+
+// GenerateServerID 根据服务器连接参数的指纹生成手动服务器的唯一ID（见 GenerateSubscriptionServerID）
+func GenerateServerID(server *config.Server) string {
+	return GenerateSubscriptionServerID(server, 0)
+}
+
+// GenerateSubscriptionServerID 根据所属订阅和服务器连接参数的指纹生成唯一ID，subscriptionID 为 0 表示手动服务器。
+// 同一节点的 ID 在多次订阅刷新之间保持不变，节点名称等不影响连接的字段变化时 ID 也不变；
+// 同一节点出现在不同订阅（或同时被手动导入）时各自是独立的记录。
+func GenerateSubscriptionServerID(server *config.Server, subscriptionID int64) string {
+	fingerprint := Fingerprint(server)
+	if subscriptionID != 0 {
+		fingerprint = "sub:" + strconv.FormatInt(subscriptionID, 10) + "|" + fingerprint
+	}
+	hash := md5.Sum([]byte(fingerprint))
 	return hex.EncodeToString(hash[:])
 }
+
+// Fingerprint 返回服务器连接参数的规范化描述，只包含协议、地址、端口、认证信息和传输层参数。
+// 名称、延迟、选中状态、前置节点等字段不参与计算。
+func Fingerprint(server *config.Server) string {
+	protocol := strings.ToLower(server.ProtocolType)
+	if protocol == "" {
+		protocol = "socks5"
+	}
+	fields := []string{protocol, strings.ToLower(strings.TrimSpace(server.Addr)), strconv.Itoa(server.Port)}
+
+	switch protocol {
+	case "vmess":
+		fields = append(fields, server.VMessUUID, strconv.Itoa(server.VMessAlterID),
+			fingerprintNetwork(server.VMessNetwork), server.VMessType, server.VMessHost, server.VMessPath,
+			server.VMessTLS, server.VMessSNI)
+	case "vless":
+		fields = append(fields, server.VLESSUUID, server.VLESSFlow, server.VLESSSecurity,
+			fingerprintNetwork(server.VLESSNetwork), server.VLESSHeaderType, server.VLESSHost, server.VLESSPath,
+			server.VLESSSNI, server.VLESSPublicKey, server.VLESSShortID)
+	case "ss":
+		fields = append(fields, server.SSMethod, server.Password, server.SSPlugin, server.SSPluginOpts)
+	case "ssr":
+		fields = append(fields, server.SSMethod, server.Password,
+			server.SSRProtocol, server.SSRProtocolParam, server.SSRObfs, server.SSRObfsParam)
+	case "trojan":
+		password := server.TrojanPassword
+		if password == "" {
+			password = server.Password
+		}
+		fields = append(fields, password, fingerprintNetwork(server.TrojanNetwork),
+			server.TrojanHost, server.TrojanPath, server.TrojanSNI)
+	default:
+		fields = append(fields, server.Username, server.Password)
+	}
+
+	return strings.Join(fields, "|")
+}
+
+// 服务器 ID 生成规则版本
+const (
+	serverIDSchemeKey = "serverIDScheme"           // 记录规则版本的应用配置键
+	serverIDScheme    = "subscription-fingerprint" // 当前规则：所属订阅 + 连接参数指纹
+)
+
+// MigrateServerIDs 将数据库中按旧规则（混入时间戳或未区分订阅）生成的服务器 ID 按所属订阅和连接参数指纹重新生成，
+// 前置节点引用和延迟历史随之迁移，同一订阅内重复的节点合并为一条。只在首次运行时执行。
+// 返回：重新生成 ID 的服务器数量和错误（如果有）
+func MigrateServerIDs() (int, error) {
+	if scheme, err := database.GetAppConfigWithDefault(serverIDSchemeKey, ""); err == nil && scheme == serverIDScheme {
+		return 0, nil
+	}
+
+	servers, err := database.GetAllServers()
+	if err != nil {
+		return 0, fmt.Errorf("加载服务器列表失败: %w", err)
+	}
+	subscriptionIDs, err := database.GetServerSubscriptionIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range servers {
+		newID := GenerateSubscriptionServerID(&servers[i], subscriptionIDs[servers[i].ID])
+		if newID == servers[i].ID {
+			continue
+		}
+		if err := database.RenameServerID(servers[i].ID, newID); err != nil {
+			return count, fmt.Errorf("迁移服务器 %s 的 ID 失败: %w", servers[i].Name, err)
+		}
+		count++
+	}
+
+	if err := database.SetAppConfig(serverIDSchemeKey, serverIDScheme); err != nil {
+		return count, fmt.Errorf("保存服务器 ID 规则失败: %w", err)
+	}
+	return count, nil
+}
+
+// fingerprintNetwork 规范化传输协议，未设置时视为 tcp
+func fingerprintNetwork(network string) string {
+	network = strings.ToLower(network)
+	if network == "" {
+		return "tcp"
+	}
+	return network
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+)
+
+func TestGenerateServerID(t *testing.T) {
+	base := config.Server{
+		Name: "香港 01", Addr: "HK.example.com", Port: 443, ProtocolType: "trojan",
+		Password: "pass", TrojanPassword: "pass", TrojanSNI: "sni.example.com",
+	}
+	id := GenerateServerID(&base)
+	if id == "" || GenerateServerID(&base) != id {
+		t.Fatalf("同一节点的 ID 应保持不变")
+	}
+
+	// 名称、延迟、选中状态以及地址大小写、默认传输协议不影响 ID
+	same := base
+	same.Name = "香港 01 | 新名称"
+	same.Addr = "hk.example.com"
+	same.Delay = 120
+	same.Selected = true
+	same.UpstreamID = "other"
+	same.TrojanNetwork = "tcp"
+	if GenerateServerID(&same) != id {
+		t.Errorf("不影响连接的字段改变后 ID 不应变化")
+	}
+
+	// 连接参数不同时 ID 不同
+	for name, modify := range map[string]func(s *config.Server){
+		"port":     func(s *config.Server) { s.Port = 8443 },
+		"password": func(s *config.Server) { s.TrojanPassword = "other" },
+		"network":  func(s *config.Server) { s.TrojanNetwork = "ws" },
+		"protocol": func(s *config.Server) { s.ProtocolType = "socks5" },
+	} {
+		changed := base
+		modify(&changed)
+		if GenerateServerID(&changed) == id {
+			t.Errorf("%s 改变后 ID 应变化", name)
+		}
+	}
+}
+
+func TestMigrateServerIDs(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	node := config.Server{ID: "old-a", Name: "A", Addr: "a.example.com", Port: 1080, Enabled: true, ProtocolType: "socks5", Selected: true}
+	dup := node
+	dup.ID, dup.Name, dup.Selected = "old-a2", "A 重复", false
+	chained := config.Server{ID: "old-b", Name: "B", Addr: "b.example.com", Port: 1080, Enabled: true, ProtocolType: "socks5", UpstreamID: "old-a2"}
+	for _, s := range []config.Server{node, dup, chained} {
+		if err := database.AddOrUpdateServer(s, nil); err != nil {
+			t.Fatalf("添加服务器失败: %v", err)
+		}
+	}
+	// 订阅中的同一节点单独保存，不与手动节点合并
+	sub, err := database.AddOrUpdateSubscription("https://example.com/sub", "")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	subNode := node
+	subNode.ID, subNode.Selected = "old-s", false
+	if err := database.AddOrUpdateServer(subNode, &sub.ID); err != nil {
+		t.Fatalf("添加服务器失败: %v", err)
+	}
+	if err := database.AddLatencySample(database.LatencySample{ServerID: "old-a2", Delay: 80, Success: true}); err != nil {
+		t.Fatalf("添加延迟采样失败: %v", err)
+	}
+
+	n, err := MigrateServerIDs()
+	if err != nil {
+		t.Fatalf("MigrateServerIDs() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("MigrateServerIDs() = %d, want 4", n)
+	}
+
+	servers, err := database.GetAllServers()
+	if err != nil {
+		t.Fatalf("获取服务器失败: %v", err)
+	}
+	if len(servers) != 3 {
+		t.Fatalf("重复节点应合并，剩余 %d 个", len(servers))
+	}
+	if subServers, err := database.GetServersBySubscriptionID(sub.ID); err != nil || len(subServers) != 1 ||
+		subServers[0].ID != GenerateSubscriptionServerID(&node, sub.ID) {
+		t.Errorf("订阅节点 = %+v, err = %v", subServers, err)
+	}
+
+	newA, newB := GenerateServerID(&node), GenerateServerID(&chained)
+	a, err := database.GetServer(newA)
+	if err != nil || !a.Selected {
+		t.Errorf("迁移后的节点 A = %+v, err = %v", a, err)
+	}
+	b, err := database.GetServer(newB)
+	if err != nil || b.UpstreamID != newA {
+		t.Errorf("前置节点引用未迁移: %+v, err = %v", b, err)
+	}
+	samples, err := database.GetLatencySamples(newA, 10, time.Time{})
+	if err != nil || len(samples) != 1 {
+		t.Errorf("延迟采样未迁移: %v, err = %v", samples, err)
+	}
+
+	// 只执行一次
+	if n, err := MigrateServerIDs(); n != 0 || err != nil {
+		t.Errorf("再次迁移 = %d, %v", n, err)
+	}
+}
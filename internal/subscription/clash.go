@@ -0,0 +1,336 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+// clashProxiesRegex 匹配 Clash 配置中顶层的 proxies 段
+var clashProxiesRegex = regexp.MustCompile(`(?m)^proxies\s*:`)
+
+// ClashParser Clash YAML 订阅解析器，解析 proxies 段中的节点
+type ClashParser struct{}
+
+// clashInt 兼容以字符串形式书写的整数（如 port: "443"）
+type clashInt int
+
+// UnmarshalYAML 实现 yaml.Unmarshaler
+func (i *clashInt) UnmarshalYAML(value *yaml.Node) error {
+	n, err := strconv.Atoi(strings.TrimSpace(value.Value))
+	if err != nil {
+		return fmt.Errorf("无效的整数: %s", value.Value)
+	}
+	*i = clashInt(n)
+	return nil
+}
+
+// clashProxy Clash proxies 段中的单个节点
+type clashProxy struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Server   string   `yaml:"server"`
+	Port     clashInt `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+
+	// Shadowsocks
+	Cipher     string                 `yaml:"cipher"`
+	Plugin     string                 `yaml:"plugin"`
+	PluginOpts map[string]interface{} `yaml:"plugin-opts"`
+
+	// VMess / VLESS
+	UUID              string   `yaml:"uuid"`
+	AlterID           clashInt `yaml:"alterId"`
+	Flow              string   `yaml:"flow"`
+	ClientFingerprint string   `yaml:"client-fingerprint"`
+
+	// 传输层与 TLS
+	Network        string   `yaml:"network"`
+	TLS            bool     `yaml:"tls"`
+	ServerName     string   `yaml:"servername"`
+	SNI            string   `yaml:"sni"`
+	SkipCertVerify bool     `yaml:"skip-cert-verify"`
+	ALPN           []string `yaml:"alpn"`
+
+	WSOpts struct {
+		Path    string            `yaml:"path"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"ws-opts"`
+	HTTPOpts struct {
+		Path    []string            `yaml:"path"`
+		Headers map[string][]string `yaml:"headers"`
+	} `yaml:"http-opts"`
+	GRPCOpts struct {
+		ServiceName string `yaml:"grpc-service-name"`
+	} `yaml:"grpc-opts"`
+	RealityOpts struct {
+		PublicKey string `yaml:"public-key"`
+		ShortID   string `yaml:"short-id"`
+	} `yaml:"reality-opts"`
+}
+
+// CanParse 判断内容是否为包含 proxies 段的 Clash 配置
+func (p *ClashParser) CanParse(content string) bool {
+	return clashProxiesRegex.MatchString(content)
+}
+
+// ParseAll 解析 Clash 配置中的全部节点。
+// 不支持的节点类型或字段不完整的节点会被跳过，一个节点都解析不出来时返回错误。
+func (p *ClashParser) ParseAll(content string) ([]config.Server, error) {
+	return p.parseAll(content, nil)
+}
+
+// parseAll 解析 Clash 配置中的全部节点，并把跳过的节点记录到 report（可为 nil）
+func (p *ClashParser) parseAll(content string, report *database.ParseReport) ([]config.Server, error) {
+	var doc struct {
+		Proxies []yaml.Node `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("解析 Clash 配置失败: %w", err)
+	}
+
+	var servers []config.Server
+	for i := range doc.Proxies {
+		s, err := p.parseProxy(&doc.Proxies[i])
+		if err != nil {
+			var entry struct {
+				Name   string `yaml:"name"`
+				Type   string `yaml:"type"`
+				Server string `yaml:"server"`
+				Port   int    `yaml:"port"`
+			}
+			doc.Proxies[i].Decode(&entry)
+			recordRejected(report, doc.Proxies[i].Line, entrySummary(entry.Name, entry.Type, entry.Server, entry.Port), parserName(p), err)
+			continue
+		}
+		recordAccepted(report)
+		servers = append(servers, *s)
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("Clash 配置中没有可用的节点")
+	}
+	return servers, nil
+}
+
+// parseProxy 解析单个 Clash 节点
+func (p *ClashParser) parseProxy(node *yaml.Node) (*config.Server, error) {
+	var proxy clashProxy
+	if err := node.Decode(&proxy); err != nil {
+		return nil, err
+	}
+	if proxy.Server == "" || proxy.Port <= 0 || proxy.Port > 65535 {
+		return nil, fmt.Errorf("invalid Clash proxy: missing server or port")
+	}
+
+	// 原始配置转换为 JSON 保存
+	var raw map[string]interface{}
+	node.Decode(&raw)
+	rawConfig, _ := json.Marshal(raw)
+
+	addr := proxy.Server
+	port := int(proxy.Port)
+	s := &config.Server{
+		Name:      proxy.Name,
+		Addr:      addr,
+		Port:      port,
+		Enabled:   true,
+		RawConfig: string(rawConfig),
+	}
+
+	switch strings.ToLower(proxy.Type) {
+	case "ss":
+		if proxy.Cipher == "" || proxy.Password == "" {
+			return nil, fmt.Errorf("invalid Clash ss proxy: missing cipher or password")
+		}
+		s.ProtocolType = "ss"
+		s.Username = proxy.Password // SS使用密码作为标识
+		s.Password = proxy.Password
+		s.SSMethod = proxy.Cipher
+		s.SSPlugin, s.SSPluginOpts = clashPluginOpts(proxy.Plugin, proxy.PluginOpts)
+
+	case "vmess":
+		if proxy.UUID == "" {
+			return nil, fmt.Errorf("invalid Clash vmess proxy: missing uuid")
+		}
+		network, host, path, headerType, err := clashTransport(&proxy)
+		if err != nil {
+			return nil, err
+		}
+		s.ProtocolType = "vmess"
+		s.Username = proxy.UUID
+		s.VMessUUID = proxy.UUID
+		s.VMessAlterID = int(proxy.AlterID)
+		s.VMessSecurity = proxy.Cipher
+		s.VMessNetwork = network
+		s.VMessType = headerType
+		s.VMessHost = host
+		s.VMessPath = path
+		if proxy.TLS {
+			s.VMessTLS = "tls"
+		}
+		s.VMessSNI = proxy.ServerName
+		s.VMessAllowInsecure = proxy.SkipCertVerify
+
+	case "vless":
+		if proxy.UUID == "" {
+			return nil, fmt.Errorf("invalid Clash vless proxy: missing uuid")
+		}
+		network, host, path, headerType, err := clashTransport(&proxy)
+		if err != nil {
+			return nil, err
+		}
+		security := "none"
+		if proxy.RealityOpts.PublicKey != "" {
+			security = "reality"
+		} else if proxy.TLS {
+			security = "tls"
+		}
+		s.ProtocolType = "vless"
+		s.Username = proxy.UUID
+		s.VLESSUUID = proxy.UUID
+		s.VLESSFlow = proxy.Flow
+		s.VLESSEncryption = "none"
+		s.VLESSSecurity = security
+		s.VLESSNetwork = network
+		s.VLESSHeaderType = headerType
+		s.VLESSHost = host
+		s.VLESSPath = path
+		s.VLESSSNI = proxy.ServerName
+		s.VLESSFingerprint = proxy.ClientFingerprint
+		s.VLESSAlpn = strings.Join(proxy.ALPN, ",")
+		s.VLESSAllowInsecure = proxy.SkipCertVerify
+		s.VLESSPublicKey = proxy.RealityOpts.PublicKey
+		s.VLESSShortID = proxy.RealityOpts.ShortID
+
+	case "trojan":
+		if proxy.Password == "" {
+			return nil, fmt.Errorf("invalid Clash trojan proxy: missing password")
+		}
+		network, host, path, _, err := clashTransport(&proxy)
+		if err != nil {
+			return nil, err
+		}
+		if network == "tcp" {
+			network = ""
+		}
+		s.ProtocolType = "trojan"
+		s.Username = proxy.Password // Trojan使用密码作为标识
+		s.Password = proxy.Password
+		s.TrojanPassword = proxy.Password
+		s.TrojanSNI = proxy.SNI
+		s.TrojanAlpn = strings.Join(proxy.ALPN, ",")
+		s.TrojanAllowInsecure = proxy.SkipCertVerify
+		s.TrojanNetwork = network
+		s.TrojanHost = host
+		s.TrojanPath = path
+
+	case "socks5":
+		s.ProtocolType = "socks5"
+		s.Username = proxy.Username
+		s.Password = proxy.Password
+
+	case "http":
+		if proxy.TLS {
+			return nil, fmt.Errorf("unsupported Clash http proxy: HTTPS 代理暂不支持")
+		}
+		s.ProtocolType = "http"
+		s.Username = proxy.Username
+		s.Password = proxy.Password
+
+	default:
+		return nil, fmt.Errorf("unsupported Clash proxy type: %s", proxy.Type)
+	}
+
+	// 如果名称为空，使用地址:端口作为名称
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
+	}
+	s.ID = server.GenerateServerID(s)
+
+	return s, nil
+}
+
+// clashTransport 将 Clash 的 network 和 *-opts 转换为传输协议、伪装域名、路径和伪装类型。
+// Clash 的 http 网络是 TCP 上的 HTTP 伪装；h2 对应的 HTTP/2 传输已被 xray-core 移除，返回错误。
+func clashTransport(proxy *clashProxy) (network, host, path, headerType string, err error) {
+	switch strings.ToLower(proxy.Network) {
+	case "ws":
+		return "ws", headerValue(proxy.WSOpts.Headers, "Host"), proxy.WSOpts.Path, "", nil
+	case "h2":
+		return "", "", "", "", fmt.Errorf("unsupported Clash transport: h2")
+	case "http":
+		if hosts := proxy.HTTPOpts.Headers["Host"]; len(hosts) > 0 {
+			host = hosts[0]
+		}
+		if len(proxy.HTTPOpts.Path) > 0 {
+			path = proxy.HTTPOpts.Path[0]
+		}
+		return "tcp", host, path, "http", nil
+	case "grpc":
+		return "grpc", "", proxy.GRPCOpts.ServiceName, "", nil
+	default:
+		return "tcp", "", "", "", nil
+	}
+}
+
+// headerValue 不区分大小写地获取请求头
+func headerValue(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// clashPluginOpts 将 Clash 的 Shadowsocks 插件配置转换为 SIP003 插件名和选项字符串
+func clashPluginOpts(plugin string, opts map[string]interface{}) (string, string) {
+	if plugin == "" {
+		return "", ""
+	}
+
+	// obfs 插件在 SIP003 中为 obfs-local，选项名也不同
+	if plugin == "obfs" {
+		var parts []string
+		if mode, ok := opts["mode"]; ok {
+			parts = append(parts, fmt.Sprintf("obfs=%v", mode))
+		}
+		if host, ok := opts["host"]; ok {
+			parts = append(parts, fmt.Sprintf("obfs-host=%v", host))
+		}
+		return "obfs-local", strings.Join(parts, ";")
+	}
+
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		switch v := opts[k].(type) {
+		case bool:
+			// 布尔选项只保留为 true 的键名，如 tls
+			if v {
+				parts = append(parts, k)
+			}
+		case map[string]interface{}, []interface{}:
+			// 嵌套选项无法用 SIP003 表示，忽略
+		default:
+			parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	return plugin, strings.Join(parts, ";")
+}
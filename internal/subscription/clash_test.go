@@ -0,0 +1,164 @@
+package subscription
+
+import (
+	"strings"
+	"testing"
+
+	"myproxy.com/p/internal/config"
+)
+
+const clashConfig = `port: 7890
+mode: rule
+proxies:
+  - name: "ss-obfs"
+    type: ss
+    server: ss.example.com
+    port: 8388
+    cipher: aes-128-gcm
+    password: sspass
+    plugin: obfs
+    plugin-opts:
+      mode: http
+      host: bing.com
+  - name: vmess-ws
+    type: vmess
+    server: vmess.example.com
+    port: "443"
+    uuid: 11111111-1111-1111-1111-111111111111
+    alterId: 0
+    cipher: auto
+    tls: true
+    servername: sni.example.com
+    skip-cert-verify: true
+    network: ws
+    ws-opts:
+      path: /ws
+      headers:
+        Host: cdn.example.com
+  - {name: vmess-h2, type: vmess, server: 1.2.3.5, port: 443, uuid: 44444444-4444-4444-4444-444444444444, alterId: 0, cipher: auto, tls: true, network: h2, h2-opts: {host: [h2.example.com], path: /h2}}
+  - {name: vmess-http, type: vmess, server: 1.2.3.4, port: 80, uuid: 22222222-2222-2222-2222-222222222222, alterId: 0, cipher: auto, network: http, http-opts: {path: [/video], headers: {Host: [a.example.com]}}}
+  - name: vless-reality
+    type: vless
+    server: vless.example.com
+    port: 443
+    uuid: 33333333-3333-3333-3333-333333333333
+    flow: xtls-rprx-vision
+    tls: true
+    servername: www.microsoft.com
+    client-fingerprint: chrome
+    reality-opts:
+      public-key: pbk
+      short-id: sid
+  - name: trojan-grpc
+    type: trojan
+    server: trojan.example.com
+    port: 443
+    password: trojanpass
+    sni: t.example.com
+    alpn: [h2, http/1.1]
+    network: grpc
+    grpc-opts:
+      grpc-service-name: svc
+  - {name: socks, type: socks5, server: 10.0.0.1, port: 1080, username: u, password: p}
+  - {name: http, type: http, server: 10.0.0.2, port: 8080}
+  - {name: hy2, type: hysteria2, server: 10.0.0.3, port: 443, password: x}
+  - {name: broken, type: vmess, server: 10.0.0.4}
+proxy-groups:
+  - name: auto
+    type: url-test
+    proxies: [ss-obfs]
+`
+
+func TestClashParser(t *testing.T) {
+	parser := &ClashParser{}
+	if !parser.CanParse(clashConfig) {
+		t.Fatal("CanParse() = false, want true")
+	}
+	if parser.CanParse("vmess://abc\nss://def") {
+		t.Error("CanParse() 对链接列表返回 true")
+	}
+
+	servers, err := parser.ParseAll(clashConfig)
+	if err != nil {
+		t.Fatalf("ParseAll() error = %v", err)
+	}
+
+	// 不支持的类型、传输方式（HTTP/2）和字段不完整的节点被跳过
+	byName := map[string]config.Server{}
+	for _, s := range servers {
+		if s.ID == "" {
+			t.Errorf("%s: ID 为空", s.Name)
+		}
+		byName[s.Name] = s
+	}
+	if len(servers) != 7 {
+		t.Fatalf("解析出 %d 个节点, want 7", len(servers))
+	}
+
+	ss := byName["ss-obfs"]
+	if ss.ProtocolType != "ss" || ss.SSMethod != "aes-128-gcm" || ss.Password != "sspass" || ss.Username != "sspass" ||
+		ss.SSPlugin != "obfs-local" || ss.SSPluginOpts != "obfs=http;obfs-host=bing.com" {
+		t.Errorf("ss = %+v", ss)
+	}
+
+	vmess := byName["vmess-ws"]
+	if vmess.Port != 443 || vmess.VMessNetwork != "ws" || vmess.VMessHost != "cdn.example.com" || vmess.VMessPath != "/ws" ||
+		vmess.VMessTLS != "tls" || vmess.VMessSNI != "sni.example.com" || !vmess.VMessAllowInsecure {
+		t.Errorf("vmess-ws = %+v", vmess)
+	}
+
+	vmessHTTP := byName["vmess-http"]
+	if vmessHTTP.VMessNetwork != "tcp" || vmessHTTP.VMessType != "http" || vmessHTTP.VMessHost != "a.example.com" || vmessHTTP.VMessPath != "/video" {
+		t.Errorf("vmess-http = %+v", vmessHTTP)
+	}
+
+	vless := byName["vless-reality"]
+	if vless.VLESSSecurity != "reality" || vless.VLESSPublicKey != "pbk" || vless.VLESSShortID != "sid" ||
+		vless.VLESSSNI != "www.microsoft.com" || vless.VLESSFingerprint != "chrome" || vless.VLESSFlow != "xtls-rprx-vision" {
+		t.Errorf("vless-reality = %+v", vless)
+	}
+
+	trojan := byName["trojan-grpc"]
+	if trojan.Password != "trojanpass" || trojan.TrojanSNI != "t.example.com" || trojan.TrojanAlpn != "h2,http/1.1" ||
+		trojan.TrojanNetwork != "grpc" || trojan.TrojanPath != "svc" {
+		t.Errorf("trojan-grpc = %+v", trojan)
+	}
+
+	if s := byName["socks"]; s.ProtocolType != "socks5" || s.Username != "u" || s.Password != "p" {
+		t.Errorf("socks = %+v", s)
+	}
+	if s := byName["http"]; s.ProtocolType != "http" || s.Addr != "10.0.0.2" || s.Port != 8080 {
+		t.Errorf("http = %+v", s)
+	}
+}
+
+func TestParseSubscriptionClash(t *testing.T) {
+	// Clash 配置通过订阅解析入口注册的格式解析器处理
+	sm := &SubscriptionManager{formatParsers: []SubscriptionParser{&ClashParser{}}}
+	servers, err := sm.parseSubscription(clashConfig)
+	if err != nil {
+		t.Fatalf("parseSubscription() error = %v", err)
+	}
+	if len(servers) != 7 {
+		t.Errorf("解析出 %d 个节点, want 7", len(servers))
+	}
+
+	// 跳过的 HTTP/2 节点记录在解析报告中
+	_, report, err := sm.parseWithReport(clashConfig)
+	if err != nil {
+		t.Fatalf("parseWithReport() error = %v", err)
+	}
+	var h2Rejected bool
+	for _, r := range report.Rejected {
+		if strings.HasPrefix(r.Content, "vmess-h2 ") && strings.Contains(r.Error, "h2") {
+			h2Rejected = true
+		}
+	}
+	if !h2Rejected {
+		t.Errorf("报告中缺少 vmess-h2: %+v", report.Rejected)
+	}
+
+	if _, err := sm.parseSubscription("proxies:\n  - {name: hy2, type: hysteria2, server: a, port: 1}\n"); err == nil {
+		t.Error("没有可用节点时应返回错误")
+	}
+}
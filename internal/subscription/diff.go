@@ -0,0 +1,97 @@
+package subscription
+
+import (
+	"fmt"
+	"strings"
+
+	"myproxy.com/p/internal/config"
+)
+
+// SubscriptionDiff 订阅更新前后服务器列表的变化
+type SubscriptionDiff struct {
+	Added    []config.Server // 新增的服务器
+	Removed  []config.Server // 订阅中已不存在、被删除的服务器
+	Modified []config.Server // ID 不变但名称或其他参数有变化的服务器（更新后的内容）
+	Total    int             // 更新后订阅的服务器总数
+}
+
+// Empty 返回服务器列表是否没有任何变化
+func (d *SubscriptionDiff) Empty() bool {
+	return d == nil || len(d.Added)+len(d.Removed)+len(d.Modified) == 0
+}
+
+// Summary 返回一行变化摘要，如 "共 12 个节点：新增 2，删除 1，变更 3"
+func (d *SubscriptionDiff) Summary() string {
+	if d == nil {
+		return ""
+	}
+	if d.Empty() {
+		return fmt.Sprintf("共 %d 个节点，无变化", d.Total)
+	}
+	return fmt.Sprintf("共 %d 个节点：新增 %d，删除 %d，变更 %d", d.Total, len(d.Added), len(d.Removed), len(d.Modified))
+}
+
+// Details 返回按新增、删除、变更分组列出节点名称的多行文本，每组最多列出 limit 个（limit <= 0 表示不限制）
+func (d *SubscriptionDiff) Details(limit int) string {
+	if d == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(d.Summary())
+	for _, group := range []struct {
+		title   string
+		servers []config.Server
+	}{
+		{"新增", d.Added},
+		{"删除", d.Removed},
+		{"变更", d.Modified},
+	} {
+		if len(group.servers) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n%s（%d）:", group.title, len(group.servers))
+		for i, s := range group.servers {
+			if limit > 0 && i >= limit {
+				fmt.Fprintf(&b, "\n  … 另有 %d 个", len(group.servers)-limit)
+				break
+			}
+			b.WriteString("\n  " + s.Name)
+		}
+	}
+	return b.String()
+}
+
+// diffServers 比较订阅更新前后的服务器列表。
+// updated 中的服务器应已通过 keepServerState 保留本地数据，因此只有订阅提供的内容变化才算变更。
+func diffServers(previous, updated []config.Server) *SubscriptionDiff {
+	diff := &SubscriptionDiff{Total: len(updated)}
+
+	old := make(map[string]config.Server, len(previous))
+	for _, s := range previous {
+		old[s.ID] = s
+	}
+
+	seen := make(map[string]bool, len(updated))
+	for _, s := range updated {
+		seen[s.ID] = true
+		prev, ok := old[s.ID]
+		if !ok {
+			diff.Added = append(diff.Added, s)
+			continue
+		}
+		// 原始配置的格式可能随订阅变化，不作为变更依据
+		cmp := s
+		cmp.RawConfig = prev.RawConfig
+		if cmp != prev {
+			diff.Modified = append(diff.Modified, s)
+		}
+	}
+
+	for _, s := range previous {
+		if !seen[s.ID] {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+	return diff
+}
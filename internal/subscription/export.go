@@ -0,0 +1,246 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"myproxy.com/p/internal/config"
+)
+
+// ServerFormatter 服务器分享链接生成器，是 ServerParser 的逆过程
+type ServerFormatter interface {
+	// Format 将服务器配置转换为分享链接
+	Format(s *config.Server) (string, error)
+}
+
+// shareLinkFormatters 各协议的分享链接生成器，key 为协议类型
+var shareLinkFormatters = map[string]ServerFormatter{
+	"vmess":  &VMessParser{},
+	"vless":  &VLESSParser{},
+	"ss":     &SSParser{},
+	"trojan": &TrojanParser{},
+	"socks5": &SOCKS5Parser{},
+}
+
+// ShareLink 返回服务器的分享链接，不支持的协议（如 SSR、Hysteria2）返回错误
+func ShareLink(s *config.Server) (string, error) {
+	protocol := strings.ToLower(s.ProtocolType)
+	if protocol == "" {
+		protocol = "socks5"
+	}
+	formatter, ok := shareLinkFormatters[protocol]
+	if !ok {
+		return "", fmt.Errorf("不支持导出的协议: %s", s.ProtocolType)
+	}
+	return formatter.Format(s)
+}
+
+// ExportSubscription 将服务器列表导出为 Base64 编码的订阅内容（每行一个分享链接）。
+// 不支持导出的服务器会被跳过并返回，没有可导出的服务器时返回错误。
+func ExportSubscription(servers []config.Server) (string, []config.Server, error) {
+	var links []string
+	var skipped []config.Server
+	for i := range servers {
+		link, err := ShareLink(&servers[i])
+		if err != nil {
+			skipped = append(skipped, servers[i])
+			continue
+		}
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return "", skipped, fmt.Errorf("没有可导出的服务器")
+	}
+	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))), skipped, nil
+}
+
+// EncodeQRCode 将文本生成为边长 size 像素的二维码图片
+func EncodeQRCode(text string, size int) (image.Image, error) {
+	hints := map[gozxing.EncodeHintType]interface{}{
+		gozxing.EncodeHintType_CHARACTER_SET: "UTF-8",
+	}
+	matrix, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, size, size, hints)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %w", err)
+	}
+	return matrix, nil
+}
+
+// escapeName 转义链接中的节点名称，"+" 也需转义，避免按查询参数解码时变成空格
+func escapeName(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), "+", "%2B")
+}
+
+// Format 生成 VMess 分享链接（v2rayN 格式，Base64 编码的 JSON）
+func (p *VMessParser) Format(s *config.Server) (string, error) {
+	if s.VMessUUID == "" {
+		return "", fmt.Errorf("VMess 节点缺少 UUID")
+	}
+	version := s.VMessVersion
+	if version == "" {
+		version = "2"
+	}
+	vmessConfig := struct {
+		V    string `json:"v"`
+		Ps   string `json:"ps"`
+		Add  string `json:"add"`
+		Port string `json:"port"`
+		Id   string `json:"id"`
+		Aid  string `json:"aid"`
+		Scy  string `json:"scy,omitempty"`
+		Net  string `json:"net"`
+		Type string `json:"type"`
+		Host string `json:"host"`
+		Path string `json:"path"`
+		Tls  string `json:"tls"`
+		Sni  string `json:"sni,omitempty"`
+	}{
+		V:    version,
+		Ps:   s.Name,
+		Add:  s.Addr,
+		Port: strconv.Itoa(s.Port),
+		Id:   s.VMessUUID,
+		Aid:  strconv.Itoa(s.VMessAlterID),
+		Net:  s.VMessNetwork,
+		Type: s.VMessType,
+		Host: s.VMessHost,
+		Path: s.VMessPath,
+		Tls:  s.VMessTLS,
+		Sni:  s.VMessSNI,
+	}
+	// 默认加密方式不写入链接
+	if s.VMessSecurity != "" && s.VMessSecurity != "auto" {
+		vmessConfig.Scy = s.VMessSecurity
+	}
+	data, err := json.Marshal(vmessConfig)
+	if err != nil {
+		return "", fmt.Errorf("生成 VMess 链接失败: %w", err)
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Format 生成 VLESS 分享链接
+// 格式：vless://uuid@addr:port?encryption=none&security=reality&sni=...&type=tcp#name
+func (p *VLESSParser) Format(s *config.Server) (string, error) {
+	if s.VLESSUUID == "" {
+		return "", fmt.Errorf("VLESS 节点缺少 UUID")
+	}
+	q := url.Values{}
+	setParam := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	encryption := s.VLESSEncryption
+	if encryption == "" {
+		encryption = "none"
+	}
+	q.Set("encryption", encryption)
+	setParam("security", s.VLESSSecurity)
+	setParam("type", s.VLESSNetwork)
+	setParam("flow", s.VLESSFlow)
+	setParam("headerType", s.VLESSHeaderType)
+	setParam("host", s.VLESSHost)
+	// gRPC 使用 serviceName 作为路径
+	if strings.EqualFold(s.VLESSNetwork, "grpc") {
+		setParam("serviceName", s.VLESSPath)
+	} else {
+		setParam("path", s.VLESSPath)
+	}
+	setParam("sni", s.VLESSSNI)
+	setParam("fp", s.VLESSFingerprint)
+	setParam("alpn", s.VLESSAlpn)
+	if s.VLESSAllowInsecure {
+		q.Set("allowInsecure", "1")
+	}
+	setParam("pbk", s.VLESSPublicKey)
+	setParam("sid", s.VLESSShortID)
+	setParam("spx", s.VLESSSpiderX)
+
+	u := url.URL{
+		Scheme:   "vless",
+		User:     url.User(s.VLESSUUID),
+		Host:     net.JoinHostPort(s.Addr, strconv.Itoa(s.Port)),
+		RawQuery: q.Encode(),
+		Fragment: s.Name,
+	}
+	return u.String(), nil
+}
+
+// Format 生成 SS 分享链接（SIP002 格式，method:password 使用 Base64 编码）
+// 格式：ss://base64(method:password)@addr:port?plugin=...&plugin-opts=...#name
+func (p *SSParser) Format(s *config.Server) (string, error) {
+	if s.SSMethod == "" {
+		return "", fmt.Errorf("SS 节点缺少加密方式")
+	}
+	userInfo := base64.URLEncoding.EncodeToString([]byte(s.SSMethod + ":" + s.Password))
+	link := fmt.Sprintf("ss://%s@%s", userInfo, net.JoinHostPort(s.Addr, strconv.Itoa(s.Port)))
+
+	var params []string
+	if s.SSPlugin != "" {
+		params = append(params, "plugin="+url.QueryEscape(s.SSPlugin))
+	}
+	if s.SSPluginOpts != "" {
+		params = append(params, "plugin-opts="+url.QueryEscape(s.SSPluginOpts))
+	}
+	if len(params) > 0 {
+		link += "?" + strings.Join(params, "&")
+	}
+	return link + "#" + escapeName(s.Name), nil
+}
+
+// Format 生成 Trojan 分享链接
+// 格式：trojan://password@addr:port?sni=...&alpn=...&allowInsecure=1#name
+func (p *TrojanParser) Format(s *config.Server) (string, error) {
+	password := s.TrojanPassword
+	if password == "" {
+		password = s.Password
+	}
+	if password == "" {
+		return "", fmt.Errorf("Trojan 节点缺少密码")
+	}
+	link := fmt.Sprintf("trojan://%s@%s", url.User(password).String(), net.JoinHostPort(s.Addr, strconv.Itoa(s.Port)))
+
+	var params []string
+	if s.TrojanSNI != "" {
+		params = append(params, "sni="+url.QueryEscape(s.TrojanSNI))
+	}
+	if s.TrojanAlpn != "" {
+		params = append(params, "alpn="+url.QueryEscape(s.TrojanAlpn))
+	}
+	if s.TrojanAllowInsecure {
+		params = append(params, "allowInsecure=1")
+	}
+	// 传输层参数供其他客户端使用
+	if s.TrojanNetwork != "" && s.TrojanNetwork != "tcp" {
+		params = append(params, "type="+s.TrojanNetwork)
+		if s.TrojanHost != "" {
+			params = append(params, "host="+url.QueryEscape(s.TrojanHost))
+		}
+		if s.TrojanPath != "" {
+			params = append(params, "path="+url.QueryEscape(s.TrojanPath))
+		}
+	}
+	if len(params) > 0 {
+		link += "?" + strings.Join(params, "&")
+	}
+	return link + "#" + escapeName(s.Name), nil
+}
+
+// Format 生成 SOCKS5 分享链接，链接格式不包含节点名称
+// 格式：socks5://[username:password@]addr:port
+func (p *SOCKS5Parser) Format(s *config.Server) (string, error) {
+	u := url.URL{Scheme: "socks5", Host: net.JoinHostPort(s.Addr, strconv.Itoa(s.Port))}
+	if s.Username != "" && s.Password != "" {
+		u.User = url.UserPassword(s.Username, s.Password)
+	}
+	return u.String(), nil
+}
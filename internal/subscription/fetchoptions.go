@@ -0,0 +1,104 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"myproxy.com/p/internal/database"
+)
+
+// UserAgentPresets 常用客户端的 User-Agent，部分提供商会根据 User-Agent 返回不同格式的订阅
+var UserAgentPresets = []string{
+	"clash.meta",
+	"ClashForWindows/0.20.39",
+	"sing-box",
+	"v2rayN/7.0",
+	"Shadowrocket/2.2",
+}
+
+// ErrLocalProxyUnavailable 订阅设置为通过本地代理获取，但本地代理未运行
+var ErrLocalProxyUnavailable = errors.New("本地代理未运行，无法通过代理获取订阅")
+
+// ValidateFetchOptions 检查订阅请求设置是否有效
+func ValidateFetchOptions(options database.SubscriptionFetchOptions) error {
+	for name := range options.Headers {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("请求头名称无效: %q", name)
+		}
+	}
+	switch options.AuthType {
+	case database.AuthNone:
+	case database.AuthBasic:
+		if options.Username == "" {
+			return fmt.Errorf("Basic 认证需要填写用户名")
+		}
+	case database.AuthBearer:
+		if options.Token == "" {
+			return fmt.Errorf("Bearer 认证需要填写令牌")
+		}
+	default:
+		return fmt.Errorf("不支持的认证方式: %s", options.AuthType)
+	}
+	for _, mirror := range options.Mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("备用地址无效: %s", mirror)
+		}
+	}
+	return nil
+}
+
+// newFetchRequest 按订阅请求设置创建 GET 请求
+func newFetchRequest(rawURL string, options database.SubscriptionFetchOptions) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建订阅请求失败: %w", err)
+	}
+	for name, value := range options.Headers {
+		req.Header.Set(name, value)
+	}
+	if options.UserAgent != "" {
+		req.Header.Set("User-Agent", options.UserAgent)
+	}
+	switch options.AuthType {
+	case database.AuthBasic:
+		req.SetBasicAuth(options.Username, options.Password)
+	case database.AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+options.Token)
+	}
+	return req, nil
+}
+
+// fetchURLs 返回按顺序尝试的地址：订阅地址在前，之后是去重后的备用地址
+func fetchURLs(rawURL string, options database.SubscriptionFetchOptions) []string {
+	urls := []string{rawURL}
+	seen := map[string]bool{rawURL: true}
+	for _, mirror := range options.Mirrors {
+		if mirror != "" && !seen[mirror] {
+			seen[mirror] = true
+			urls = append(urls, mirror)
+		}
+	}
+	return urls
+}
+
+// clientFor 返回获取订阅使用的 HTTP 客户端，设置为通过本地代理获取时使用指向本地代理的客户端
+func (sm *SubscriptionManager) clientFor(options database.SubscriptionFetchOptions) (*http.Client, error) {
+	if !options.UseProxy {
+		return sm.client, nil
+	}
+	var proxyURL *url.URL
+	if sm.localProxy != nil {
+		proxyURL = sm.localProxy()
+	}
+	if proxyURL == nil {
+		return nil, ErrLocalProxyUnavailable
+	}
+	return &http.Client{
+		Timeout:   sm.client.Timeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	}, nil
+}
@@ -0,0 +1,157 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+func TestValidateFetchOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options database.SubscriptionFetchOptions
+		wantErr bool
+	}{
+		{"空设置", database.SubscriptionFetchOptions{}, false},
+		{"请求头", database.SubscriptionFetchOptions{Headers: map[string]string{"X-Token": "1"}}, false},
+		{"请求头名称含空格", database.SubscriptionFetchOptions{Headers: map[string]string{"X Token": "1"}}, true},
+		{"Basic 缺少用户名", database.SubscriptionFetchOptions{AuthType: database.AuthBasic, Password: "p"}, true},
+		{"Bearer", database.SubscriptionFetchOptions{AuthType: database.AuthBearer, Token: "t"}, false},
+		{"Bearer 缺少令牌", database.SubscriptionFetchOptions{AuthType: database.AuthBearer}, true},
+		{"未知认证方式", database.SubscriptionFetchOptions{AuthType: "digest"}, true},
+		{"备用地址", database.SubscriptionFetchOptions{Mirrors: []string{"https://mirror.example.com/sub"}}, false},
+		{"备用地址无效", database.SubscriptionFetchOptions{Mirrors: []string{"mirror.example.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFetchOptions(tt.options); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFetchOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchWithOptions(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "socks5://1.1.1.1:1080\n"
+	var got *http.Request
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err == nil {
+		t.Fatal("未认证时 UpdateSubscription() 应返回错误")
+	}
+
+	options := database.SubscriptionFetchOptions{
+		Headers:   map[string]string{"X-Device": "desktop"},
+		UserAgent: "clash.meta",
+		AuthType:  database.AuthBearer,
+		Token:     "secret",
+	}
+	sub, err := database.AddOrUpdateSubscription(provider.URL, "test")
+	if err != nil {
+		t.Fatalf("添加订阅失败: %v", err)
+	}
+	if err := database.SetSubscriptionFetchOptions(sub.ID, options); err != nil {
+		t.Fatalf("设置请求设置失败: %v", err)
+	}
+	if _, err := sm.FetchSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("FetchSubscription() error = %v", err)
+	}
+	if got.UserAgent() != "clash.meta" || got.Header.Get("X-Device") != "desktop" {
+		t.Errorf("请求头 = %v", got.Header)
+	}
+
+	// 之后的更新同样使用保存的请求设置
+	got = nil
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	if got == nil || got.UserAgent() != "clash.meta" {
+		t.Errorf("更新时未使用保存的请求设置")
+	}
+
+	// Basic 认证
+	req, _ := newFetchRequest(provider.URL, database.SubscriptionFetchOptions{AuthType: database.AuthBasic, Username: "u", Password: "p"})
+	if user, pass, ok := req.BasicAuth(); !ok || user != "u" || pass != "p" {
+		t.Errorf("BasicAuth() = %q, %q, %v", user, pass, ok)
+	}
+}
+
+func TestFetchMirrorsAndProxy(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "socks5://1.1.1.1:1080\n"
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer mirror.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+
+	// 订阅地址失败时使用备用地址
+	servers, _, err := sm.fetch(broken.URL, database.SubscriptionFetchOptions{Mirrors: []string{mirror.URL}})
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("fetch() = %d, %v", len(servers), err)
+	}
+	if _, _, err := sm.fetch(broken.URL, database.SubscriptionFetchOptions{Mirrors: []string{broken.URL + "/other"}}); err == nil {
+		t.Error("全部地址失败时应返回错误")
+	}
+
+	// 本地代理未运行
+	viaProxy := database.SubscriptionFetchOptions{UseProxy: true}
+	if _, _, err := sm.fetch(mirror.URL, viaProxy); !errors.Is(err, ErrLocalProxyUnavailable) {
+		t.Errorf("fetch() error = %v, want ErrLocalProxyUnavailable", err)
+	}
+
+	// 通过本地代理获取（用 HTTP 代理模拟）
+	var proxied, proxyAuth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		w.Write([]byte(content))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+	sm.SetLocalProxy(func() *url.URL { return proxyURL })
+
+	target := "http://provider.invalid/sub"
+	if _, _, err := sm.fetch(target, viaProxy); err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+	if proxied != target {
+		t.Errorf("代理收到的请求 = %q, want %q", proxied, target)
+	}
+	// 本地入站启用认证时使用代理地址中的账户
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")); proxyAuth != want {
+		t.Errorf("Proxy-Authorization = %q, want %q", proxyAuth, want)
+	}
+}
@@ -0,0 +1,125 @@
+package subscription
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+)
+
+// FilterResult 应用过滤与重命名规则的结果
+type FilterResult struct {
+	Kept          []config.Server   // 保留的节点（已重命名）
+	Dropped       []config.Server   // 被过滤掉的节点（原名称）
+	OriginalNames map[string]string // 被重命名节点的 ID → 原名称
+}
+
+// nodeFilter 编译后的过滤与重命名规则
+type nodeFilter struct {
+	include, exclude                 *regexp.Regexp
+	includeProtocol, excludeProtocol *regexp.Regexp
+	renames                          []compiledRename
+}
+
+// compiledRename 编译后的重命名规则
+type compiledRename struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// ValidateFilter 检查过滤与重命名规则中的正则表达式是否有效
+func ValidateFilter(filter database.SubscriptionFilter) error {
+	_, err := compileFilter(filter)
+	return err
+}
+
+// ApplyFilter 对订阅解析出的节点应用过滤与重命名规则。
+// 先按原名称和协议类型过滤，再对保留的节点按顺序应用重命名规则；重命名不影响节点 ID。
+func ApplyFilter(servers []config.Server, filter database.SubscriptionFilter) (*FilterResult, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FilterResult{OriginalNames: make(map[string]string)}
+	for _, s := range servers {
+		if !f.keep(&s) {
+			result.Dropped = append(result.Dropped, s)
+			continue
+		}
+		if name := f.rename(s.Name); name != s.Name {
+			result.OriginalNames[s.ID] = s.Name
+			s.Name = name
+		}
+		result.Kept = append(result.Kept, s)
+	}
+	return result, nil
+}
+
+// compileFilter 编译过滤与重命名规则，空模式不编译
+func compileFilter(filter database.SubscriptionFilter) (*nodeFilter, error) {
+	f := &nodeFilter{}
+	for _, p := range []struct {
+		title   string
+		pattern string
+		re      **regexp.Regexp
+	}{
+		{"保留名称", filter.Include, &f.include},
+		{"排除名称", filter.Exclude, &f.exclude},
+		{"保留协议", filter.IncludeProtocol, &f.includeProtocol},
+		{"排除协议", filter.ExcludeProtocol, &f.excludeProtocol},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s规则无效: %w", p.title, err)
+		}
+		*p.re = re
+	}
+
+	for i, r := range filter.Renames {
+		if r.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条重命名规则无效: %w", i+1, err)
+		}
+		f.renames = append(f.renames, compiledRename{pattern: re, replace: r.Replace})
+	}
+	return f, nil
+}
+
+// keep 判断节点是否通过过滤
+func (f *nodeFilter) keep(s *config.Server) bool {
+	if f.include != nil && !f.include.MatchString(s.Name) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(s.Name) {
+		return false
+	}
+	if f.includeProtocol != nil && !f.includeProtocol.MatchString(s.ProtocolType) {
+		return false
+	}
+	if f.excludeProtocol != nil && f.excludeProtocol.MatchString(s.ProtocolType) {
+		return false
+	}
+	return true
+}
+
+// rename 按顺序应用重命名规则并去除首尾空白，结果为空时保留原名称
+func (f *nodeFilter) rename(name string) string {
+	renamed := name
+	for _, r := range f.renames {
+		renamed = r.pattern.ReplaceAllString(renamed, r.replace)
+	}
+	renamed = strings.TrimSpace(renamed)
+	if renamed == "" {
+		return name
+	}
+	return renamed
+}
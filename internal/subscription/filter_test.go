@@ -0,0 +1,133 @@
+package subscription
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+func TestApplyFilter(t *testing.T) {
+	servers := []config.Server{
+		{ID: "1", Name: "剩余流量：100GB", ProtocolType: "ss"},
+		{ID: "2", Name: "官网 example.com", ProtocolType: "ss"},
+		{ID: "3", Name: "[HK] 香港 01", ProtocolType: "vless"},
+		{ID: "4", Name: "[JP] 日本 01", ProtocolType: "trojan"},
+		{ID: "5", Name: "[US] 美国 01", ProtocolType: "vmess"},
+	}
+	filter := database.SubscriptionFilter{
+		Exclude:         "剩余流量|官网",
+		ExcludeProtocol: "^vmess$",
+		Renames: []database.RenameRule{
+			{Pattern: `^\[(\w+)\]`, Replace: "$1 -"},
+			{Pattern: `\s+01$`, Replace: ""},
+		},
+	}
+
+	result, err := ApplyFilter(servers, filter)
+	if err != nil {
+		t.Fatalf("ApplyFilter() error = %v", err)
+	}
+	var kept []string
+	for _, s := range result.Kept {
+		kept = append(kept, s.Name)
+	}
+	if len(kept) != 2 || kept[0] != "HK - 香港" || kept[1] != "JP - 日本" {
+		t.Errorf("保留节点 = %q", kept)
+	}
+	if len(result.Dropped) != 3 || result.Dropped[2].Name != "[US] 美国 01" {
+		t.Errorf("过滤节点 = %+v", result.Dropped)
+	}
+	if result.OriginalNames["3"] != "[HK] 香港 01" {
+		t.Errorf("OriginalNames = %v", result.OriginalNames)
+	}
+
+	// include 只保留匹配的节点
+	result, _ = ApplyFilter(servers, database.SubscriptionFilter{Include: "香港|日本", IncludeProtocol: "vless"})
+	if len(result.Kept) != 1 || result.Kept[0].ID != "3" {
+		t.Errorf("Include 保留节点 = %+v", result.Kept)
+	}
+
+	// 重命名结果为空时保留原名称
+	result, _ = ApplyFilter(servers[:1], database.SubscriptionFilter{Renames: []database.RenameRule{{Pattern: ".*"}}})
+	if result.Kept[0].Name != "剩余流量：100GB" {
+		t.Errorf("重命名为空时名称 = %q", result.Kept[0].Name)
+	}
+
+	if _, err := ApplyFilter(servers, database.SubscriptionFilter{Renames: []database.RenameRule{{Pattern: "("}}}); err == nil {
+		t.Error("无效的重命名规则应返回错误")
+	}
+	if err := ValidateFilter(database.SubscriptionFilter{Exclude: "[a-"}); err == nil {
+		t.Error("无效的排除规则应返回错误")
+	}
+}
+
+func TestUpdateSubscriptionAppliesFilter(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "trojan://pass@1.1.1.1:443#Traffic-Left\ntrojan://pass@2.2.2.2:443#HK-01\ntrojan://pass@3.3.3.3:443#JP-01\n"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	sub, _ := database.GetSubscriptionByURL(provider.URL)
+
+	filter := database.SubscriptionFilter{
+		Exclude: "Traffic",
+		Renames: []database.RenameRule{{Pattern: "-01$", Replace: " 节点"}},
+	}
+	preview, err := sm.PreviewFilter(provider.URL, database.SubscriptionFetchOptions{}, filter)
+	if err != nil {
+		t.Fatalf("PreviewFilter() error = %v", err)
+	}
+	if len(preview.Kept) != 2 || len(preview.Dropped) != 1 {
+		t.Errorf("预览保留 %d 个、过滤 %d 个, want 2、1", len(preview.Kept), len(preview.Dropped))
+	}
+	// 预览不修改数据库
+	if n, _ := database.GetServerCountBySubscriptionID(sub.ID); n != 3 {
+		t.Errorf("预览后订阅下有 %d 个服务器, want 3", n)
+	}
+
+	if err := database.SetSubscriptionFilter(sub.ID, filter); err != nil {
+		t.Fatalf("设置过滤规则失败: %v", err)
+	}
+	diff, err := sm.UpdateSubscription(provider.URL, "test")
+	if err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	// 重命名不改变节点 ID，只算变更
+	if len(diff.Added) != 0 || len(diff.Removed) != 1 || len(diff.Modified) != 2 {
+		t.Errorf("diff = %s", diff.Summary())
+	}
+	servers, _ := database.GetServersBySubscriptionID(sub.ID)
+	names := map[string]bool{}
+	for _, s := range servers {
+		names[s.Name] = true
+	}
+	if len(servers) != 2 || !names["HK 节点"] || !names["JP 节点"] {
+		t.Errorf("过滤后的服务器 = %v", names)
+	}
+
+	// 规则排除全部节点时不清空订阅
+	if err := database.SetSubscriptionFilter(sub.ID, database.SubscriptionFilter{Include: "不存在"}); err != nil {
+		t.Fatalf("设置过滤规则失败: %v", err)
+	}
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err == nil {
+		t.Error("全部节点被过滤时应返回错误")
+	}
+	if n, _ := database.GetServerCountBySubscriptionID(sub.ID); n != 2 {
+		t.Errorf("订阅下有 %d 个服务器, want 2", n)
+	}
+}
@@ -0,0 +1,176 @@
+package subscription
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+)
+
+// maxImportFileSize 导入文件的大小上限（字节）
+const maxImportFileSize = 10 << 20
+
+// ImportResult 导入服务器的结果
+type ImportResult struct {
+	Added    []config.Server       // 新增的手动服务器
+	Existing []config.Server       // 已存在而跳过的手动服务器
+	Report   *database.ParseReport // 导入内容的解析报告
+}
+
+// Summary 返回导入结果的简短描述，如 "新增 2 个节点，1 个已存在"
+func (r *ImportResult) Summary() string {
+	summary := fmt.Sprintf("新增 %d 个节点", len(r.Added))
+	if len(r.Existing) > 0 {
+		summary += fmt.Sprintf("，%d 个已存在", len(r.Existing))
+	}
+	if r.Report != nil && r.Report.Failed() > 0 {
+		summary += fmt.Sprintf("，%d 条无法解析", r.Report.Failed())
+	}
+	return summary
+}
+
+// ImportText 从文本导入服务器，保存为手动服务器（不属于任何订阅）。
+// 文本可以是聊天中复制的内容，每行中第一个受支持的分享链接之前的文字会被忽略；
+// 不含分享链接时按订阅内容解析（Base64、Clash YAML、sing-box、SIP008 等）。
+func (sm *SubscriptionManager) ImportText(text string) (*ImportResult, error) {
+	content := text
+	if links := sm.extractShareLinks(text); len(links) > 0 {
+		content = strings.Join(links, "\n")
+	}
+
+	parsed, report, err := sm.parseWithReport(strings.TrimSpace(content))
+	if err != nil {
+		if isSubscriptionURL(text) {
+			return nil, fmt.Errorf("内容是订阅地址，请在订阅管理中添加: %s", strings.TrimSpace(text))
+		}
+		return nil, fmt.Errorf("解析导入内容失败: %w", err)
+	}
+	return sm.importServers(parsed, report)
+}
+
+// ImportFile 从本地文件导入服务器：PNG/JPEG 图片按二维码识别，其他文件按订阅内容解析
+func (sm *SubscriptionManager) ImportFile(path string) (*ImportResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取导入文件失败: %w", err)
+	}
+	if info.Size() > maxImportFileSize {
+		return nil, fmt.Errorf("导入文件过大: %d 字节", info.Size())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取导入文件失败: %w", err)
+	}
+
+	if isImage(data) {
+		return sm.ImportQRCode(bytes.NewReader(data))
+	}
+	return sm.ImportText(string(data))
+}
+
+// ImportQRCode 识别 PNG/JPEG 图片中的二维码并导入其中的服务器
+func (sm *SubscriptionManager) ImportQRCode(r io.Reader) (*ImportResult, error) {
+	text, err := DecodeQRCode(r)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ImportText(text)
+}
+
+// DecodeQRCode 识别 PNG/JPEG 图片中的二维码，返回其中的文本
+func DecodeQRCode(r io.Reader) (string, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return "", fmt.Errorf("解码图片失败: %w", err)
+	}
+	return decodeQRImage(img)
+}
+
+// decodeQRImage 识别图片中的二维码
+func decodeQRImage(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("读取图片失败: %w", err)
+	}
+	// 截图中的二维码通常不在正中，需要完整搜索
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", fmt.Errorf("未能识别图片中的二维码: %w", err)
+	}
+	return result.GetText(), nil
+}
+
+// importServers 在一个事务中将解析出的服务器保存为手动服务器，已存在的节点保持不变
+func (sm *SubscriptionManager) importServers(parsed []config.Server, report *database.ParseReport) (*ImportResult, error) {
+	result := &ImportResult{Report: report}
+	seen := make(map[string]bool, len(parsed))
+	for _, s := range parsed {
+		if seen[s.ID] {
+			continue
+		}
+		seen[s.ID] = true
+
+		if existing, err := database.GetServer(s.ID); err == nil {
+			result.Existing = append(result.Existing, *existing)
+			continue
+		}
+		result.Added = append(result.Added, s)
+	}
+	if err := database.AddServers(result.Added, nil); err != nil {
+		return nil, fmt.Errorf("保存导入的服务器失败: %w", err)
+	}
+
+	// 从数据库同步内存中的服务器列表
+	if sm.serverManager != nil && len(result.Added) > 0 {
+		if err := sm.serverManager.LoadServersFromDB(); err != nil {
+			return nil, fmt.Errorf("更新服务器到内存失败: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// extractShareLinks 从文本中提取受支持的分享链接，每行取第一个链接前缀开始的内容
+func (sm *SubscriptionManager) extractShareLinks(text string) []string {
+	var links []string
+	for _, line := range strings.Split(text, "\n") {
+		start := -1
+		for prefix := range sm.parsers {
+			if idx := strings.Index(line, prefix); idx != -1 && (start == -1 || idx < start) {
+				start = idx
+			}
+		}
+		if start != -1 {
+			links = append(links, strings.TrimSpace(line[start:]))
+		}
+	}
+	return links
+}
+
+// isSubscriptionURL 判断文本是否为单个 http(s) 订阅地址
+func isSubscriptionURL(text string) bool {
+	text = strings.TrimSpace(text)
+	return !strings.ContainsAny(text, " \n") &&
+		(strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://"))
+}
+
+// isImage 判断数据是否为 PNG 或 JPEG 图片
+func isImage(data []byte) bool {
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package subscription
+
+import (
+	"database/sql"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+func TestImportText(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	text := "新节点：trojan://pass@1.1.1.1:443#日本 01\n" +
+		"备用 vless://11111111-2222-3333-4444-555555555555@2.2.2.2:443?security=tls#HK\n" +
+		"有问题再联系"
+	result, err := sm.ImportText(text)
+	if err != nil {
+		t.Fatalf("ImportText() error = %v", err)
+	}
+	if len(result.Added) != 2 || len(result.Existing) != 0 {
+		t.Fatalf("ImportText() = %s", result.Summary())
+	}
+	if result.Added[0].Name != "日本 01" {
+		t.Errorf("节点名称 = %q", result.Added[0].Name)
+	}
+
+	// 导入的节点不属于任何订阅
+	var subscriptionID sql.NullInt64
+	if err := database.DB.QueryRow("SELECT subscription_id FROM servers WHERE id = ?", result.Added[0].ID).Scan(&subscriptionID); err != nil {
+		t.Fatalf("查询服务器失败: %v", err)
+	}
+	if subscriptionID.Valid {
+		t.Errorf("subscription_id = %d, want NULL", subscriptionID.Int64)
+	}
+
+	// 重复导入时跳过已存在的节点
+	result, err = sm.ImportText("trojan://pass@1.1.1.1:443#日本 01")
+	if err != nil || len(result.Added) != 0 || len(result.Existing) != 1 {
+		t.Errorf("重复导入 = %+v, %v", result, err)
+	}
+
+	if _, err := sm.ImportText("https://example.com/sub"); err == nil {
+		t.Error("导入订阅地址应返回错误")
+	}
+	if _, err := sm.ImportText("没有节点"); err == nil {
+		t.Error("导入无效内容应返回错误")
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	dir := t.TempDir()
+
+	// Clash 配置文件
+	yamlPath := filepath.Join(dir, "clash.yaml")
+	if err := os.WriteFile(yamlPath, []byte(clashConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := sm.ImportFile(yamlPath)
+	if err != nil || len(result.Added) == 0 {
+		t.Fatalf("ImportFile(yaml) = %+v, %v", result, err)
+	}
+
+	// 二维码截图
+	link := "trojan://qr@5.5.5.5:443#二维码"
+	matrix, err := qrcode.NewQRCodeWriter().Encode(link, gozxing.BarcodeFormat_QR_CODE, 300, 300, nil)
+	if err != nil {
+		t.Fatalf("生成二维码失败: %v", err)
+	}
+	pngPath := filepath.Join(dir, "qr.png")
+	f, err := os.Create(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, matrix); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	result, err = sm.ImportFile(pngPath)
+	if err != nil || len(result.Added) != 1 || result.Added[0].Name != "二维码" {
+		t.Fatalf("ImportFile(png) = %+v, %v", result, err)
+	}
+	if _, err := sm.serverManager.GetServer(result.Added[0].ID); err != nil {
+		t.Errorf("导入后内存中的服务器列表未更新: %v", err)
+	}
+}
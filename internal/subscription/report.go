@@ -0,0 +1,145 @@
+package subscription
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+)
+
+// 解析报告的记录上限
+const (
+	MaxReportedRejections = 100 // 最多记录的失败条目数
+	maxReportedContent    = 160 // 单个条目内容的最大长度（字符）
+)
+
+// redactedText 替换敏感信息的占位符
+const redactedText = "***"
+
+// secretQueryParams 链接中需要隐藏取值的查询参数（小写）
+var secretQueryParams = map[string]bool{
+	"password":      true,
+	"passwd":        true,
+	"pass":          true,
+	"pwd":           true,
+	"uuid":          true,
+	"id":            true,
+	"key":           true,
+	"token":         true,
+	"auth":          true,
+	"psk":           true,
+	"secret":        true,
+	"obfs-password": true,
+}
+
+// reportingParser 可以在解析时记录被跳过条目的整体订阅格式解析器
+type reportingParser interface {
+	parseAll(content string, report *database.ParseReport) ([]config.Server, error)
+}
+
+// recordAccepted 记录一个解析成功的条目，report 为 nil 时不记录
+func recordAccepted(report *database.ParseReport) {
+	if report == nil {
+		return
+	}
+	report.Total++
+	report.Accepted++
+}
+
+// recordRejected 记录一个解析失败的条目，content 应已隐藏敏感信息，report 为 nil 时不记录
+func recordRejected(report *database.ParseReport, line int, content, parser string, err error) {
+	if report == nil {
+		return
+	}
+	report.Total++
+	if len(report.Rejected) >= MaxReportedRejections {
+		return
+	}
+	report.Rejected = append(report.Rejected, database.RejectedEntry{
+		Line:    line,
+		Content: truncateContent(content),
+		Parser:  parser,
+		Error:   err.Error(),
+	})
+}
+
+// parserName 返回解析器的类型名称，如 "VMessParser"
+func parserName(parser interface{}) string {
+	name := fmt.Sprintf("%T", parser)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// formatName 返回整体订阅格式解析器对应的格式名称，如 "Clash"
+func formatName(parser SubscriptionParser) string {
+	return strings.TrimSuffix(parserName(parser), "Parser")
+}
+
+// entrySummary 生成结构化订阅中单个节点的摘要（名称、类型和地址），不包含密码等字段
+func entrySummary(name, typ, addr string, port int) string {
+	summary := fmt.Sprintf("%s:%d", addr, port)
+	if typ != "" {
+		summary = typ + " " + summary
+	}
+	if name != "" {
+		summary = fmt.Sprintf("%s (%s)", name, summary)
+	}
+	return summary
+}
+
+// redactLine 隐藏订阅行中的密码、UUID 等敏感信息，保留协议、地址、端口和节点名称。
+// 无法识别结构的链接（如 Base64 编码的 vmess://）只保留协议和节点名称。
+func redactLine(line string) string {
+	scheme, rest, ok := strings.Cut(line, "://")
+	if !ok {
+		// 简单格式 "地址:端口 用户名 密码" 只保留地址
+		fields := strings.Fields(line)
+		for i := 1; i < len(fields); i++ {
+			fields[i] = redactedText
+		}
+		return strings.Join(fields, " ")
+	}
+
+	u, err := url.Parse(line)
+	if err != nil || u.Hostname() == "" || u.Port() == "" {
+		body, fragment, _ := strings.Cut(rest, "#")
+		redacted := fmt.Sprintf("%s://[已隐藏 %d 字符]", scheme, len(body))
+		if fragment != "" {
+			redacted += "#" + fragment
+		}
+		return redacted
+	}
+
+	hasUser := u.User != nil
+	u.User = nil
+	if u.RawQuery != "" {
+		// 逐个替换参数值，保持参数顺序
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			if key, _, ok := strings.Cut(param, "="); ok && secretQueryParams[strings.ToLower(key)] {
+				params[i] = key + "=" + redactedText
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+	redacted := u.String()
+	if hasUser {
+		// 用户信息（密码、UUID 等）整体隐藏；不经过 url.User 以免占位符被转义
+		redacted = strings.Replace(redacted, "://", "://"+redactedText+"@", 1)
+	}
+	// 节点名称保持可读
+	if name, err := url.PathUnescape(u.EscapedFragment()); err == nil && name != "" {
+		redacted = strings.TrimSuffix(redacted, "#"+u.EscapedFragment()) + "#" + name
+	}
+	return redacted
+}
+
+// truncateContent 截断过长的条目内容
+func truncateContent(content string) string {
+	runes := []rune(content)
+	if len(runes) <= maxReportedContent {
+		return content
+	}
+	return string(runes[:maxReportedContent]) + "…"
+}
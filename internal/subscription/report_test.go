@@ -0,0 +1,112 @@
+package subscription
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+func TestRedactLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"trojan://secretpass@t.example.com:443?sni=a.com&password=p2#日本 01", "trojan://***@t.example.com:443?sni=a.com&password=***#日本 01"},
+		{"vless://11111111-2222@v.example.com:443?security=reality&pbk=key#HK", "vless://***@v.example.com:443?security=reality&pbk=key#HK"},
+		{"socks5://1.2.3.4:1080", "socks5://1.2.3.4:1080"},
+		{"vmess://eyJhZGQiOiJhIiwiaWQiOiJzZWNyZXQifQ==", "vmess://[已隐藏 36 字符]"},
+		{"ss://YWVzLTI1Ni1nY206cGFzcw#节点", "ss://[已隐藏 22 字符]#节点"},
+		{"1.2.3.4:1080 user pass", "1.2.3.4:1080 *** ***"},
+	}
+	for _, tt := range tests {
+		if got := redactLine(tt.line); got != tt.want {
+			t.Errorf("redactLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseWithReport(t *testing.T) {
+	sm := &SubscriptionManager{
+		parsers:       map[string]ServerParser{"trojan://": &TrojanParser{}},
+		formatParsers: []SubscriptionParser{&SingBoxParser{}},
+	}
+
+	content := strings.Join([]string{
+		"trojan://pass@1.1.1.1:443#ok",
+		"",
+		"hysteria2://secret@2.2.2.2:443#hy2",
+		"trojan://pass@3.3.3.3:port#broken",
+		"STATUS=剩余流量 10GB",
+	}, "\n")
+	servers, report, err := sm.parseWithReport(content)
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("parseWithReport() = %d, %v", len(servers), err)
+	}
+	if report.Format != "链接" || report.Total != 4 || report.Accepted != 1 || len(report.Rejected) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	hy2 := report.Rejected[0]
+	if hy2.Line != 3 || hy2.Parser != "（无）" || !strings.Contains(hy2.Error, "hysteria2://") || strings.Contains(hy2.Content, "secret") {
+		t.Errorf("hysteria2 行 = %+v", hy2)
+	}
+	if broken := report.Rejected[1]; broken.Line != 4 || broken.Parser != "TrojanParser" {
+		t.Errorf("trojan 行 = %+v", broken)
+	}
+	if status := report.Rejected[2]; status.Parser != "SimpleParser" {
+		t.Errorf("STATUS 行 = %+v", status)
+	}
+
+	// 整体格式：sing-box 的非代理出站不计入报告
+	_, report, err = sm.parseWithReport(singBoxConfig)
+	if err != nil {
+		t.Fatalf("parseWithReport(sing-box) error = %v", err)
+	}
+	if report.Format != "SingBox" || report.Failed() != 2 || report.Rejected[0].Content != "vmess-h2 (vmess vmess.example.com:443)" ||
+		report.Rejected[1].Content != "hy2 (hysteria2 10.0.0.3:443)" {
+		t.Errorf("sing-box report = %+v", report)
+	}
+
+	// 全部失败时仍返回报告
+	_, report, err = sm.parseWithReport("<html>502 Bad Gateway</html>")
+	if err == nil || report == nil || report.Failed() != 1 {
+		t.Errorf("parseWithReport(html) = %+v, %v", report, err)
+	}
+}
+
+func TestUpdateSubscriptionSavesParseReport(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "trojan://pass@1.1.1.1:443#ok\nhysteria2://secret@2.2.2.2:443#hy2\n"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	sub, _ := database.GetSubscriptionByURL(provider.URL)
+	if sub.ParseReport.Accepted != 1 || sub.ParseReport.Failed() != 1 || sub.ParseReport.ParsedAt.IsZero() {
+		t.Errorf("解析报告 = %+v", sub.ParseReport)
+	}
+
+	// 解析失败时同样保存报告
+	content = "hysteria2://secret@2.2.2.2:443#hy2\n"
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err == nil {
+		t.Fatal("UpdateSubscription() 应返回错误")
+	}
+	sub, _ = database.GetSubscriptionByURL(provider.URL)
+	if sub.ParseReport.Accepted != 0 || sub.ParseReport.Failed() != 1 {
+		t.Errorf("解析失败后的报告 = %+v", sub.ParseReport)
+	}
+}
@@ -0,0 +1,183 @@
+package subscription
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/logging"
+)
+
+// 订阅自动更新参数
+const (
+	SchedulerCheckInterval = time.Minute      // 检查是否有到期订阅的周期
+	SchedulerStagger       = 10 * time.Second // 多个订阅同时到期时，相邻两次更新之间的间隔
+	RetryBaseDelay         = time.Minute      // 更新失败后首次重试的延迟，之后每次翻倍
+	MaxRetryDelay          = time.Hour        // 重试延迟上限
+)
+
+// Scheduler 订阅自动更新调度器。
+// 定期检查设置了更新间隔的订阅，到期后逐个调用 UpdateSubscription 更新，失败时按指数退避重试。
+type Scheduler struct {
+	logger   *logging.Logger
+	refresh  func(sub *database.Subscription) (*SubscriptionDiff, error)
+	onUpdate func(sub *database.Subscription, diff *SubscriptionDiff, err error)
+	stagger  time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewScheduler 创建订阅自动更新调度器
+// 参数：
+//   - sm: 订阅管理器，用于执行更新（更新结果由 UpdateSubscription 记录）
+//   - logger: 日志记录器（可为 nil）
+//   - onUpdate: 每次自动更新完成后的回调（可为 nil），在调度器的 goroutine 中调用，失败时 diff 为 nil
+func NewScheduler(sm *SubscriptionManager, logger *logging.Logger, onUpdate func(sub *database.Subscription, diff *SubscriptionDiff, err error)) *Scheduler {
+	return &Scheduler{
+		logger: logger,
+		refresh: func(sub *database.Subscription) (*SubscriptionDiff, error) {
+			return sm.UpdateSubscription(sub.URL, sub.Label)
+		},
+		onUpdate: onUpdate,
+		stagger:  SchedulerStagger,
+	}
+}
+
+// Start 启动后台调度，重复调用时先停止之前的调度。
+// 启动后等待一个检查周期再进行首次检查，避免应用启动时集中发起网络请求。
+func (s *Scheduler) Start() {
+	s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(SchedulerCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RunDue(ctx)
+			}
+		}
+	}()
+}
+
+// Stop 停止后台调度，正在进行的更新会在完成后退出
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// RunDue 依次更新所有已到期的订阅，相邻两次更新之间间隔 stagger。
+// 返回：本次执行更新的订阅数量
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	subscriptions, err := database.GetAllSubscriptions()
+	if err != nil {
+		s.error("获取订阅列表失败: %v", err)
+		return 0
+	}
+
+	count := 0
+	for _, sub := range subscriptions {
+		due, ok := dueAt(sub.Schedule, time.Now())
+		if !ok || due.After(time.Now()) {
+			continue
+		}
+
+		// 错开多个订阅的更新
+		if count > 0 && s.stagger > 0 {
+			select {
+			case <-ctx.Done():
+				return count
+			case <-time.After(s.stagger):
+			}
+		}
+		if ctx.Err() != nil {
+			return count
+		}
+
+		diff, err := s.refresh(sub)
+		count++
+		if err != nil {
+			s.warn("订阅 %s 自动更新失败（第 %d 次）: %v", sub.DisplayName(), sub.Schedule.Failures+1, err)
+		} else if s.logger != nil {
+			s.logger.InfoWithType(logging.LogTypeApp, "订阅 %s 已自动更新，%s", sub.DisplayName(), diff.Summary())
+		}
+		if s.onUpdate != nil {
+			s.onUpdate(sub, diff, err)
+		}
+	}
+	return count
+}
+
+// dueAt 返回订阅下次自动更新的时间，未设置更新间隔时返回 false。
+// 尚未安排时以上次成功时间加间隔计算，从未成功过则立即到期。
+func dueAt(schedule database.SubscriptionSchedule, now time.Time) (time.Time, bool) {
+	if schedule.Interval <= 0 {
+		return time.Time{}, false
+	}
+	if !schedule.NextUpdateAt.IsZero() {
+		return schedule.NextUpdateAt, true
+	}
+	if !schedule.LastSuccessAt.IsZero() {
+		return schedule.LastSuccessAt.Add(schedule.Interval), true
+	}
+	return now, true
+}
+
+// nextSchedule 根据本次更新结果计算新的更新计划。
+// 成功后按更新间隔安排下次更新；失败后按指数退避安排重试，未设置更新间隔时不安排。
+func nextSchedule(schedule database.SubscriptionSchedule, err error, now time.Time) database.SubscriptionSchedule {
+	schedule.NextUpdateAt = time.Time{}
+	if err == nil {
+		schedule.LastSuccessAt = now
+		schedule.LastError = ""
+		schedule.Failures = 0
+		if schedule.Interval > 0 {
+			schedule.NextUpdateAt = now.Add(schedule.Interval)
+		}
+		return schedule
+	}
+
+	schedule.LastFailureAt = now
+	schedule.LastError = err.Error()
+	schedule.Failures++
+	if schedule.Interval > 0 {
+		schedule.NextUpdateAt = now.Add(retryDelay(schedule.Failures, schedule.Interval))
+	}
+	return schedule
+}
+
+// retryDelay 返回第 failures 次连续失败后的重试延迟，不超过 MaxRetryDelay 和更新间隔
+func retryDelay(failures int, interval time.Duration) time.Duration {
+	delay := RetryBaseDelay
+	for i := 1; i < failures && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRetryDelay, interval)
+}
+
+// warn 记录警告日志，未设置日志记录器时不输出
+func (s *Scheduler) warn(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Warn(format, args...)
+	}
+}
+
+// error 记录错误日志，未设置日志记录器时不输出
+func (s *Scheduler) error(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(format, args...)
+	}
+}
@@ -0,0 +1,121 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/database"
+)
+
+func TestRetryDelay(t *testing.T) {
+	interval := 24 * time.Hour
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, w := range want {
+		if got := retryDelay(i+1, interval); got != w {
+			t.Errorf("retryDelay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	if got := retryDelay(20, interval); got != MaxRetryDelay {
+		t.Errorf("retryDelay(20) = %v, want %v", got, MaxRetryDelay)
+	}
+	// 重试延迟不超过更新间隔
+	if got := retryDelay(10, 30*time.Minute); got != 30*time.Minute {
+		t.Errorf("retryDelay(10, 30m) = %v", got)
+	}
+}
+
+func TestNextSchedule(t *testing.T) {
+	now := time.Now()
+	schedule := database.SubscriptionSchedule{Interval: 6 * time.Hour}
+
+	schedule = nextSchedule(schedule, errors.New("timeout"), now)
+	schedule = nextSchedule(schedule, errors.New("timeout"), now)
+	if schedule.Failures != 2 || schedule.LastError != "timeout" || !schedule.LastFailureAt.Equal(now) ||
+		!schedule.NextUpdateAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("失败后的更新计划 = %+v", schedule)
+	}
+
+	schedule = nextSchedule(schedule, nil, now)
+	if schedule.Failures != 0 || schedule.LastError != "" || !schedule.LastSuccessAt.Equal(now) ||
+		!schedule.NextUpdateAt.Equal(now.Add(6*time.Hour)) || schedule.LastFailureAt.IsZero() {
+		t.Errorf("成功后的更新计划 = %+v", schedule)
+	}
+
+	// 未设置更新间隔时只记录结果，不安排下次更新
+	manual := nextSchedule(database.SubscriptionSchedule{}, errors.New("timeout"), now)
+	if manual.Failures != 1 || !manual.NextUpdateAt.IsZero() {
+		t.Errorf("手动更新的更新计划 = %+v", manual)
+	}
+	if _, ok := dueAt(manual, now); ok {
+		t.Error("未设置更新间隔的订阅不应到期")
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	add := func(url string, interval time.Duration) *database.Subscription {
+		sub, err := database.AddOrUpdateSubscription(url, url)
+		if err != nil {
+			t.Fatalf("添加订阅失败: %v", err)
+		}
+		if err := database.SetSubscriptionInterval(sub.ID, interval); err != nil {
+			t.Fatalf("设置更新间隔失败: %v", err)
+		}
+		return sub
+	}
+	ok := add("https://ok.example.com", time.Hour)
+	bad := add("https://bad.example.com", time.Hour)
+	add("https://manual.example.com", 0)
+
+	sm := &SubscriptionManager{}
+	var refreshed []string
+	var updated int
+	s := NewScheduler(sm, nil, func(sub *database.Subscription, diff *SubscriptionDiff, err error) { updated++ })
+	s.stagger = 0
+	s.refresh = func(sub *database.Subscription) (*SubscriptionDiff, error) {
+		refreshed = append(refreshed, sub.URL)
+		var err error
+		if sub.ID == bad.ID {
+			err = errors.New("connection refused")
+		}
+		sm.recordUpdate(sub.URL, err)
+		return &SubscriptionDiff{}, err
+	}
+
+	// 从未更新过的订阅立即到期，未设置间隔的订阅不会自动更新
+	if n := s.RunDue(context.Background()); n != 2 || len(refreshed) != 2 || updated != 2 {
+		t.Fatalf("RunDue() = %d, refreshed = %v", n, refreshed)
+	}
+
+	got, _ := database.GetSubscriptionByID(ok.ID)
+	if got.Schedule.LastSuccessAt.IsZero() || got.Schedule.Failures != 0 ||
+		time.Until(got.Schedule.NextUpdateAt) < 59*time.Minute {
+		t.Errorf("成功订阅的更新计划 = %+v", got.Schedule)
+	}
+	got, _ = database.GetSubscriptionByID(bad.ID)
+	if got.Schedule.Failures != 1 || got.Schedule.LastError != "connection refused" ||
+		time.Until(got.Schedule.NextUpdateAt) > RetryBaseDelay {
+		t.Errorf("失败订阅的更新计划 = %+v", got.Schedule)
+	}
+
+	// 都已安排到未来，再次检查时不更新
+	refreshed = nil
+	if n := s.RunDue(context.Background()); n != 0 {
+		t.Errorf("RunDue() = %d, refreshed = %v", n, refreshed)
+	}
+
+	// 已取消时不再更新
+	database.UpdateSubscriptionSchedule(bad.ID, database.SubscriptionSchedule{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n := s.RunDue(ctx); n != 0 {
+		t.Errorf("取消后 RunDue() = %d", n)
+	}
+}
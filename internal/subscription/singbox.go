@@ -0,0 +1,288 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+// SingBoxParser sing-box 配置订阅解析器，解析 outbounds 数组中的代理节点
+type SingBoxParser struct{}
+
+// singBoxNonProxyTypes sing-box 中不代表代理节点的出站类型
+var singBoxNonProxyTypes = map[string]bool{
+	"selector": true,
+	"urltest":  true,
+	"direct":   true,
+	"block":    true,
+	"dns":      true,
+}
+
+// singBoxTLS sing-box 出站的 TLS 配置
+type singBoxTLS struct {
+	Enabled    bool     `json:"enabled"`
+	ServerName string   `json:"server_name"`
+	Insecure   bool     `json:"insecure"`
+	ALPN       []string `json:"alpn"`
+	UTLS       struct {
+		Fingerprint string `json:"fingerprint"`
+	} `json:"utls"`
+	Reality struct {
+		Enabled   bool   `json:"enabled"`
+		PublicKey string `json:"public_key"`
+		ShortID   string `json:"short_id"`
+	} `json:"reality"`
+}
+
+// singBoxTransport sing-box 出站的传输层配置
+type singBoxTransport struct {
+	Type        string            `json:"type"`
+	Path        string            `json:"path"`
+	Host        json.RawMessage   `json:"host"` // http 传输为字符串数组，httpupgrade 为字符串
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"service_name"`
+}
+
+// singBoxOutbound sing-box 的单个出站
+type singBoxOutbound struct {
+	Type       string            `json:"type"`
+	Tag        string            `json:"tag"`
+	Server     string            `json:"server"`
+	ServerPort int               `json:"server_port"`
+	Username   string            `json:"username"`
+	Password   string            `json:"password"`
+	Method     string            `json:"method"`
+	Plugin     string            `json:"plugin"`
+	PluginOpts string            `json:"plugin_opts"`
+	UUID       string            `json:"uuid"`
+	AlterID    int               `json:"alter_id"`
+	Security   string            `json:"security"`
+	Flow       string            `json:"flow"`
+	TLS        *singBoxTLS       `json:"tls"`
+	Transport  *singBoxTransport `json:"transport"`
+}
+
+// CanParse 判断内容是否为包含 outbounds 数组的 sing-box 配置
+func (p *SingBoxParser) CanParse(content string) bool {
+	var doc struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+	}
+	return json.Unmarshal([]byte(content), &doc) == nil && len(doc.Outbounds) > 0
+}
+
+// ParseAll 解析 sing-box 配置中的代理出站。
+// selector、urltest、direct 等非代理出站以及不支持的协议会被跳过。
+func (p *SingBoxParser) ParseAll(content string) ([]config.Server, error) {
+	return p.parseAll(content, nil)
+}
+
+// parseAll 解析 sing-box 配置中的代理出站，并把跳过的代理出站记录到 report（可为 nil）。
+// 非代理出站不算作解析失败，不计入报告。
+func (p *SingBoxParser) parseAll(content string, report *database.ParseReport) ([]config.Server, error) {
+	var doc struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("解析 sing-box 配置失败: %w", err)
+	}
+
+	var servers []config.Server
+	for i, raw := range doc.Outbounds {
+		s, err := p.parseOutbound(raw)
+		if err != nil {
+			var out singBoxOutbound
+			json.Unmarshal(raw, &out)
+			if !singBoxNonProxyTypes[out.Type] {
+				recordRejected(report, i+1, entrySummary(out.Tag, out.Type, out.Server, out.ServerPort), parserName(p), err)
+			}
+			continue
+		}
+		recordAccepted(report)
+		servers = append(servers, *s)
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("sing-box 配置中没有可用的节点")
+	}
+	return servers, nil
+}
+
+// parseOutbound 解析单个 sing-box 出站
+func (p *SingBoxParser) parseOutbound(raw json.RawMessage) (*config.Server, error) {
+	var out singBoxOutbound
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	if out.Server == "" || out.ServerPort <= 0 || out.ServerPort > 65535 {
+		return nil, fmt.Errorf("invalid sing-box outbound: missing server or server_port")
+	}
+
+	tls := out.TLS
+	if tls == nil {
+		tls = &singBoxTLS{}
+	}
+
+	addr, port := out.Server, out.ServerPort
+	s := &config.Server{
+		Name:      out.Tag,
+		Addr:      addr,
+		Port:      port,
+		Enabled:   true,
+		RawConfig: string(raw),
+	}
+
+	switch out.Type {
+	case "shadowsocks":
+		if out.Method == "" || out.Password == "" {
+			return nil, fmt.Errorf("invalid sing-box shadowsocks outbound: missing method or password")
+		}
+		s.ProtocolType = "ss"
+		s.Username = out.Password // SS使用密码作为标识
+		s.Password = out.Password
+		s.SSMethod = out.Method
+		s.SSPlugin = out.Plugin
+		s.SSPluginOpts = out.PluginOpts
+
+	case "vmess":
+		if out.UUID == "" {
+			return nil, fmt.Errorf("invalid sing-box vmess outbound: missing uuid")
+		}
+		network, host, path, err := singBoxTransportFields(out.Transport)
+		if err != nil {
+			return nil, err
+		}
+		// VMess 出站不支持 HTTPUpgrade 传输
+		if network == "httpupgrade" {
+			return nil, fmt.Errorf("unsupported sing-box vmess transport: httpupgrade")
+		}
+		s.ProtocolType = "vmess"
+		s.Username = out.UUID
+		s.VMessUUID = out.UUID
+		s.VMessAlterID = out.AlterID
+		s.VMessSecurity = out.Security
+		s.VMessNetwork = network
+		s.VMessHost = host
+		s.VMessPath = path
+		if tls.Enabled {
+			s.VMessTLS = "tls"
+		}
+		s.VMessSNI = tls.ServerName
+		s.VMessAllowInsecure = tls.Insecure
+
+	case "vless":
+		if out.UUID == "" {
+			return nil, fmt.Errorf("invalid sing-box vless outbound: missing uuid")
+		}
+		network, host, path, err := singBoxTransportFields(out.Transport)
+		if err != nil {
+			return nil, err
+		}
+		security := "none"
+		if tls.Reality.Enabled {
+			security = "reality"
+		} else if tls.Enabled {
+			security = "tls"
+		}
+		s.ProtocolType = "vless"
+		s.Username = out.UUID
+		s.VLESSUUID = out.UUID
+		s.VLESSFlow = out.Flow
+		s.VLESSEncryption = "none"
+		s.VLESSSecurity = security
+		s.VLESSNetwork = network
+		s.VLESSHost = host
+		s.VLESSPath = path
+		s.VLESSSNI = tls.ServerName
+		s.VLESSFingerprint = tls.UTLS.Fingerprint
+		s.VLESSAlpn = strings.Join(tls.ALPN, ",")
+		s.VLESSAllowInsecure = tls.Insecure
+		s.VLESSPublicKey = tls.Reality.PublicKey
+		s.VLESSShortID = tls.Reality.ShortID
+
+	case "trojan":
+		if out.Password == "" {
+			return nil, fmt.Errorf("invalid sing-box trojan outbound: missing password")
+		}
+		network, host, path, err := singBoxTransportFields(out.Transport)
+		if err != nil {
+			return nil, err
+		}
+		// Trojan 出站只支持 TCP、WebSocket 和 gRPC
+		switch network {
+		case "tcp":
+			network = ""
+		case "ws", "grpc":
+		default:
+			return nil, fmt.Errorf("unsupported sing-box trojan transport: %s", network)
+		}
+		s.ProtocolType = "trojan"
+		s.Username = out.Password // Trojan使用密码作为标识
+		s.Password = out.Password
+		s.TrojanPassword = out.Password
+		s.TrojanSNI = tls.ServerName
+		s.TrojanAlpn = strings.Join(tls.ALPN, ",")
+		s.TrojanAllowInsecure = tls.Insecure
+		s.TrojanNetwork = network
+		s.TrojanHost = host
+		s.TrojanPath = path
+
+	case "socks":
+		s.ProtocolType = "socks5"
+		s.Username = out.Username
+		s.Password = out.Password
+
+	case "http":
+		if tls.Enabled {
+			return nil, fmt.Errorf("unsupported sing-box http outbound: HTTPS 代理暂不支持")
+		}
+		s.ProtocolType = "http"
+		s.Username = out.Username
+		s.Password = out.Password
+
+	default:
+		return nil, fmt.Errorf("unsupported sing-box outbound type: %s", out.Type)
+	}
+
+	// 如果名称为空，使用地址:端口作为名称
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
+	}
+	s.ID = server.GenerateServerID(s)
+
+	return s, nil
+}
+
+// singBoxTransportFields 将 sing-box 传输层配置转换为传输协议、伪装域名和路径。
+// sing-box 的 http 传输对应 HTTP/2，xray-core 已移除该传输方式，不予支持；gRPC 的路径为 service_name。
+func singBoxTransportFields(t *singBoxTransport) (network, host, path string, err error) {
+	if t == nil || t.Type == "" {
+		return "tcp", "", "", nil
+	}
+
+	host = headerValue(t.Headers, "Host")
+	if len(t.Host) > 0 {
+		// host 可能是字符串或字符串数组，取第一个
+		var hosts []string
+		if json.Unmarshal(t.Host, &hosts) == nil && len(hosts) > 0 {
+			host = hosts[0]
+		} else {
+			var single string
+			if json.Unmarshal(t.Host, &single) == nil && single != "" {
+				host = single
+			}
+		}
+	}
+
+	switch t.Type {
+	case "ws", "httpupgrade":
+		return t.Type, host, t.Path, nil
+	case "grpc":
+		return "grpc", "", t.ServiceName, nil
+	default:
+		return "", "", "", fmt.Errorf("unsupported sing-box transport: %s", t.Type)
+	}
+}
@@ -0,0 +1,136 @@
+package subscription
+
+import (
+	"path/filepath"
+	"testing"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+)
+
+const singBoxConfig = `{
+  "log": {"level": "info"},
+  "outbounds": [
+    {"type": "selector", "tag": "proxy", "outbounds": ["ss", "vmess-ws"]},
+    {"type": "shadowsocks", "tag": "ss", "server": "ss.example.com", "server_port": 8388, "method": "2022-blake3-aes-128-gcm", "password": "sspass"},
+    {"type": "vmess", "tag": "vmess-ws", "server": "vmess.example.com", "server_port": 443, "uuid": "11111111-1111-1111-1111-111111111111", "security": "auto",
+     "tls": {"enabled": true, "server_name": "sni.example.com", "insecure": true},
+     "transport": {"type": "ws", "path": "/ws", "headers": {"Host": "cdn.example.com"}}},
+    {"type": "vmess", "tag": "vmess-h2", "server": "vmess.example.com", "server_port": 443, "uuid": "33333333-3333-3333-3333-333333333333",
+     "tls": {"enabled": true}, "transport": {"type": "http", "host": ["h2.example.com"], "path": "/h2"}},
+    {"type": "vless", "tag": "vless-reality", "server": "vless.example.com", "server_port": 443, "uuid": "22222222-2222-2222-2222-222222222222", "flow": "xtls-rprx-vision",
+     "tls": {"enabled": true, "server_name": "www.microsoft.com", "utls": {"enabled": true, "fingerprint": "chrome"}, "reality": {"enabled": true, "public_key": "pbk", "short_id": "sid"}}},
+    {"type": "trojan", "tag": "trojan-grpc", "server": "trojan.example.com", "server_port": 443, "password": "trojanpass",
+     "tls": {"enabled": true, "server_name": "t.example.com", "alpn": ["h2"]},
+     "transport": {"type": "grpc", "service_name": "svc"}},
+    {"type": "socks", "tag": "socks", "server": "10.0.0.1", "server_port": 1080, "username": "u", "password": "p"},
+    {"type": "http", "tag": "http", "server": "10.0.0.2", "server_port": 8080},
+    {"type": "hysteria2", "tag": "hy2", "server": "10.0.0.3", "server_port": 443, "password": "x"},
+    {"type": "direct", "tag": "direct"},
+    {"type": "block", "tag": "block"}
+  ]
+}`
+
+func TestSingBoxParser(t *testing.T) {
+	parser := &SingBoxParser{}
+	if !parser.CanParse(singBoxConfig) {
+		t.Fatal("CanParse() = false, want true")
+	}
+	if parser.CanParse(`[{"name":"a","addr":"1.1.1.1","port":1080}]`) {
+		t.Error("CanParse() 对自定义 JSON 返回 true")
+	}
+
+	servers, err := parser.ParseAll(singBoxConfig)
+	if err != nil {
+		t.Fatalf("ParseAll() error = %v", err)
+	}
+
+	// selector、direct 等非代理出站和不支持的协议、传输方式（HTTP/2）被跳过
+	byName := map[string]config.Server{}
+	for _, s := range servers {
+		byName[s.Name] = s
+	}
+	if len(servers) != 6 {
+		t.Fatalf("解析出 %d 个节点, want 6", len(servers))
+	}
+
+	if s := byName["ss"]; s.ProtocolType != "ss" || s.SSMethod != "2022-blake3-aes-128-gcm" || s.Password != "sspass" {
+		t.Errorf("ss = %+v", s)
+	}
+	if s := byName["vmess-ws"]; s.ProtocolType != "vmess" || s.VMessNetwork != "ws" || s.VMessHost != "cdn.example.com" ||
+		s.VMessPath != "/ws" || s.VMessTLS != "tls" || s.VMessSNI != "sni.example.com" || !s.VMessAllowInsecure {
+		t.Errorf("vmess-ws = %+v", s)
+	}
+	if s := byName["vless-reality"]; s.ProtocolType != "vless" || s.VLESSSecurity != "reality" || s.VLESSPublicKey != "pbk" ||
+		s.VLESSShortID != "sid" || s.VLESSFingerprint != "chrome" || s.VLESSNetwork != "tcp" {
+		t.Errorf("vless-reality = %+v", s)
+	}
+	if s := byName["trojan-grpc"]; s.ProtocolType != "trojan" || s.TrojanNetwork != "grpc" || s.TrojanPath != "svc" ||
+		s.TrojanSNI != "t.example.com" || s.TrojanAlpn != "h2" {
+		t.Errorf("trojan-grpc = %+v", s)
+	}
+	if s := byName["socks"]; s.ProtocolType != "socks5" || s.Username != "u" || s.Password != "p" {
+		t.Errorf("socks = %+v", s)
+	}
+	if s := byName["http"]; s.ProtocolType != "http" {
+		t.Errorf("http = %+v", s)
+	}
+}
+
+func TestSIP008Parser(t *testing.T) {
+	content := `{
+  "version": 1,
+  "servers": [
+    {"id": "1", "remarks": "香港", "server": "hk.example.com", "server_port": 8388, "password": "p1", "method": "aes-256-gcm", "plugin": "obfs-local", "plugin_opts": "obfs=http;obfs-host=bing.com"},
+    {"id": "2", "server": "jp.example.com", "server_port": 8389, "password": "p2", "method": "chacha20-ietf-poly1305"},
+    {"id": "3", "remarks": "broken", "server": "us.example.com", "server_port": 8390, "method": "aes-256-gcm"}
+  ],
+  "bytes_used": 1024
+}`
+	parser := &SIP008Parser{}
+	if !parser.CanParse(content) {
+		t.Fatal("CanParse() = false, want true")
+	}
+	if parser.CanParse(singBoxConfig) {
+		t.Error("CanParse() 对 sing-box 配置返回 true")
+	}
+
+	servers, err := parser.ParseAll(content)
+	if err != nil {
+		t.Fatalf("ParseAll() error = %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("解析出 %d 个服务器, want 2", len(servers))
+	}
+	if s := servers[0]; s.Name != "香港" || s.ProtocolType != "ss" || s.SSMethod != "aes-256-gcm" ||
+		s.SSPlugin != "obfs-local" || s.SSPluginOpts != "obfs=http;obfs-host=bing.com" {
+		t.Errorf("servers[0] = %+v", s)
+	}
+	if s := servers[1]; s.Name != "jp.example.com:8389" || s.Password != "p2" {
+		t.Errorf("servers[1] = %+v", s)
+	}
+}
+
+func TestParseSubscriptionFormats(t *testing.T) {
+	// NewSubscriptionManager 会从数据库加载订阅列表
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+	sm := NewSubscriptionManager(nil)
+
+	// sing-box 和 SIP008 映射为正确的协议类型，而不是全部当作 socks5
+	servers, err := sm.parseSubscription(singBoxConfig)
+	if err != nil || len(servers) != 6 {
+		t.Fatalf("sing-box: %d 个节点, err = %v", len(servers), err)
+	}
+	if servers[0].ProtocolType != "ss" {
+		t.Errorf("sing-box 第一个节点协议 = %s, want ss", servers[0].ProtocolType)
+	}
+
+	// 自定义 JSON 格式保持原有行为
+	servers, err = sm.parseSubscription(`[{"name":"a","addr":"1.1.1.1","port":1080}]`)
+	if err != nil || len(servers) != 1 || servers[0].ProtocolType != "socks5" {
+		t.Errorf("自定义 JSON: %+v, err = %v", servers, err)
+	}
+}
@@ -0,0 +1,96 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
+)
+
+// SIP008Parser SIP008 Shadowsocks JSON 订阅解析器
+// 格式：{"version": 1, "servers": [{"remarks": "...", "server": "...", "server_port": 8388, "method": "...", "password": "..."}]}
+type SIP008Parser struct{}
+
+// sip008Server SIP008 中的单个服务器
+type sip008Server struct {
+	ID         string `json:"id"`
+	Remarks    string `json:"remarks"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+	Password   string `json:"password"`
+	Method     string `json:"method"`
+	Plugin     string `json:"plugin"`
+	PluginOpts string `json:"plugin_opts"`
+}
+
+// sip008Document SIP008 订阅文档
+type sip008Document struct {
+	Version int            `json:"version"`
+	Servers []sip008Server `json:"servers"`
+}
+
+// CanParse 判断内容是否为 SIP008 格式（servers 数组中的服务器带有 method 字段）
+func (p *SIP008Parser) CanParse(content string) bool {
+	var doc sip008Document
+	if err := json.Unmarshal([]byte(content), &doc); err != nil || len(doc.Servers) == 0 {
+		return false
+	}
+	return doc.Servers[0].Method != ""
+}
+
+// ParseAll 解析 SIP008 订阅中的全部服务器，字段不完整的服务器会被跳过
+func (p *SIP008Parser) ParseAll(content string) ([]config.Server, error) {
+	return p.parseAll(content, nil)
+}
+
+// parseAll 解析 SIP008 订阅中的全部服务器，并把跳过的服务器记录到 report（可为 nil）
+func (p *SIP008Parser) parseAll(content string, report *database.ParseReport) ([]config.Server, error) {
+	var doc struct {
+		Servers []json.RawMessage `json:"servers"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("解析 SIP008 订阅失败: %w", err)
+	}
+
+	var servers []config.Server
+	for i, raw := range doc.Servers {
+		var ss sip008Server
+		if err := json.Unmarshal(raw, &ss); err != nil {
+			recordRejected(report, i+1, fmt.Sprintf("[第 %d 个服务器]", i+1), parserName(p), err)
+			continue
+		}
+		if ss.Server == "" || ss.ServerPort <= 0 || ss.ServerPort > 65535 || ss.Method == "" || ss.Password == "" {
+			recordRejected(report, i+1, entrySummary(ss.Remarks, "ss", ss.Server, ss.ServerPort), parserName(p),
+				fmt.Errorf("invalid SIP008 server: missing server, server_port, method or password"))
+			continue
+		}
+		recordAccepted(report)
+
+		s := config.Server{
+			Name:         ss.Remarks,
+			Addr:         ss.Server,
+			Port:         ss.ServerPort,
+			Username:     ss.Password, // SS使用密码作为标识
+			Password:     ss.Password,
+			Enabled:      true,
+			ProtocolType: "ss",
+			SSMethod:     ss.Method,
+			SSPlugin:     ss.Plugin,
+			SSPluginOpts: ss.PluginOpts,
+			RawConfig:    string(raw),
+		}
+		// 如果名称为空，使用地址:端口作为名称
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
+		}
+		s.ID = server.GenerateServerID(&s)
+		servers = append(servers, s)
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("SIP008 订阅中没有可用的服务器")
+	}
+	return servers, nil
+}
@@ -3,17 +3,21 @@ package subscription
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"myproxy.com/p/internal/config"
 	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/logging"
 	"myproxy.com/p/internal/server"
 )
 
@@ -23,6 +27,14 @@ type ServerParser interface {
 	Parse(content string) (*config.Server, error)
 }
 
+// SubscriptionParser 整体订阅格式解析器接口（如 Clash YAML），一次解析出全部服务器
+type SubscriptionParser interface {
+	// CanParse 判断订阅内容是否为该格式
+	CanParse(content string) bool
+	// ParseAll 解析订阅内容，返回服务器列表和错误
+	ParseAll(content string) ([]config.Server, error)
+}
+
 // VMessParser VMess协议解析器
 type VMessParser struct{}
 
@@ -48,11 +60,13 @@ func (p *VMessParser) Parse(content string) (*config.Server, error) {
 		Port string `json:"port"` // 端口（字符串类型）
 		Id   string `json:"id"`   // UUID
 		Aid  string `json:"aid"`  // AlterID（字符串类型，可能是 "0"）
+		Scy  string `json:"scy"`  // 加密方式，为空表示 auto
 		Net  string `json:"net"`  // 传输协议: tcp, kcp, ws, h2, quic, grpc
 		Type string `json:"type"` // 伪装类型: none, http, srtp, utp, wechat-video
 		Host string `json:"host"` // 伪装域名
 		Path string `json:"path"` // 路径
 		Tls  string `json:"tls"`  // TLS: "" 或 "tls"
+		Sni  string `json:"sni"`  // TLS 服务器名称
 	}
 
 	decodedStr := string(decoded)
@@ -75,12 +89,13 @@ func (p *VMessParser) Parse(content string) (*config.Server, error) {
 		}
 	}
 
-	// 生成服务器ID（使用 addr:port:uuid）
-	serverID := server.GenerateServerID(vmessConfig.Add, port, vmessConfig.Id)
+	security := vmessConfig.Scy
+	if security == "" {
+		security = "auto" // 默认加密方式
+	}
 
 	// 创建服务器配置，包含所有字段
 	s := &config.Server{
-		ID:           serverID,
 		Name:         vmessConfig.Ps,
 		Addr:         vmessConfig.Add,
 		Port:         port,
@@ -94,12 +109,13 @@ func (p *VMessParser) Parse(content string) (*config.Server, error) {
 		VMessVersion:  vmessConfig.V,
 		VMessUUID:     vmessConfig.Id,
 		VMessAlterID:  aid,
-		VMessSecurity: "auto", // 默认加密方式
+		VMessSecurity: security,
 		VMessNetwork:  vmessConfig.Net,
 		VMessType:     vmessConfig.Type,
 		VMessHost:     vmessConfig.Host,
 		VMessPath:     vmessConfig.Path,
 		VMessTLS:      vmessConfig.Tls,
+		VMessSNI:      vmessConfig.Sni,
 		// 保存原始配置 JSON
 		RawConfig: decodedStr,
 	}
@@ -109,9 +125,18 @@ func (p *VMessParser) Parse(content string) (*config.Server, error) {
 		s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
 	}
 
+	s.ID = server.GenerateServerID(s)
 	return s, nil
 }
 
+// unescapeParam 解码链接中的查询参数值，无法解码时保留原值
+func unescapeParam(value string) string {
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
 // SSConfig SS协议配置
 type SSConfig struct {
 	Cipher     string
@@ -189,8 +214,8 @@ func (p *SSParser) Parse(content string) (*config.Server, error) {
 
 	// 解析地址和端口，以及可能的参数
 	addrPort, pluginPart, _ := strings.Cut(addrPortPart, "?")
-	addr, portStr, found := strings.Cut(addrPort, ":")
-	if !found {
+	addr, portStr, err := net.SplitHostPort(addrPort)
+	if err != nil {
 		return nil, fmt.Errorf("invalid SS format: missing addr:port")
 	}
 
@@ -206,7 +231,7 @@ func (p *SSParser) Parse(content string) (*config.Server, error) {
 		for _, param := range pluginParams {
 			key, value, _ := strings.Cut(param, "=")
 			key = strings.TrimSpace(key)
-			value = strings.TrimSpace(value)
+			value = unescapeParam(strings.TrimSpace(value))
 
 			if key == "plugin" {
 				plugin = value
@@ -216,12 +241,8 @@ func (p *SSParser) Parse(content string) (*config.Server, error) {
 		}
 	}
 
-	// 生成服务器ID
-	serverID := server.GenerateServerID(addr, port, password)
-
 	// 创建服务器配置
 	s := &config.Server{
-		ID:           serverID,
 		Name:         fmt.Sprintf("%s:%d", addr, port),
 		Addr:         addr,
 		Port:         port,
@@ -249,6 +270,7 @@ func (p *SSParser) Parse(content string) (*config.Server, error) {
 		}
 	}
 
+	s.ID = server.GenerateServerID(s)
 	return s, nil
 }
 
@@ -291,10 +313,13 @@ func (p *TrojanParser) Parse(content string) (*config.Server, error) {
 	if !found {
 		return nil, fmt.Errorf("invalid Trojan format: missing @ separator")
 	}
+	if unescaped, err := url.PathUnescape(password); err == nil {
+		password = unescaped
+	}
 
 	// 解析地址和端口
-	addr, portStr, found := strings.Cut(addrPort, ":")
-	if !found {
+	addr, portStr, err := net.SplitHostPort(addrPort)
+	if err != nil {
 		return nil, fmt.Errorf("invalid Trojan format: missing addr:port")
 	}
 
@@ -312,7 +337,7 @@ func (p *TrojanParser) Parse(content string) (*config.Server, error) {
 		for _, param := range params {
 			key, value, _ := strings.Cut(param, "=")
 			key = strings.TrimSpace(key)
-			value = strings.TrimSpace(value)
+			value = unescapeParam(strings.TrimSpace(value))
 
 			switch key {
 			case "sni":
@@ -325,12 +350,8 @@ func (p *TrojanParser) Parse(content string) (*config.Server, error) {
 		}
 	}
 
-	// 生成服务器ID
-	serverID := server.GenerateServerID(addr, port, password)
-
 	// 创建服务器配置
 	s := &config.Server{
-		ID:           serverID,
 		Name:         name,
 		Addr:         addr,
 		Port:         port,
@@ -354,6 +375,106 @@ func (p *TrojanParser) Parse(content string) (*config.Server, error) {
 		s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
 	}
 
+	s.ID = server.GenerateServerID(s)
+	return s, nil
+}
+
+// VLESSParser VLESS协议解析器
+type VLESSParser struct{}
+
+// Parse 解析VLESS协议
+// 格式：vless://uuid@addr:port?encryption=none&security=reality&sni=...&fp=...&pbk=...&sid=...&type=tcp&flow=...#name
+func (p *VLESSParser) Parse(content string) (*config.Server, error) {
+	u, err := url.Parse(strings.TrimSpace(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VLESS format: %w", err)
+	}
+	if u.Scheme != "vless" {
+		return nil, fmt.Errorf("invalid VLESS format: unexpected scheme %q", u.Scheme)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid VLESS format: missing uuid")
+	}
+	uuid := u.User.Username()
+
+	addr := u.Hostname()
+	if addr == "" {
+		return nil, fmt.Errorf("invalid VLESS format: missing addr")
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, fmt.Errorf("invalid VLESS port: %w", err)
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid VLESS port: %d", port)
+	}
+
+	q := u.Query()
+	security := strings.ToLower(q.Get("security"))
+	switch security {
+	case "", "none", "tls", "reality":
+	default:
+		return nil, fmt.Errorf("unsupported VLESS security: %s", security)
+	}
+
+	network := strings.ToLower(q.Get("type"))
+	if network == "" {
+		network = "tcp"
+	}
+
+	// gRPC 使用 serviceName 作为路径
+	path := q.Get("path")
+	if network == "grpc" && q.Get("serviceName") != "" {
+		path = q.Get("serviceName")
+	}
+
+	encryption := q.Get("encryption")
+	if encryption == "" {
+		encryption = "none"
+	}
+
+	allowInsecure := q.Get("allowInsecure")
+
+	s := &config.Server{
+		Name:         u.Fragment,
+		Addr:         addr,
+		Port:         port,
+		Username:     uuid, // VLESS使用UUID作为标识
+		Delay:        0,
+		Selected:     false,
+		Enabled:      true,
+		ProtocolType: "vless",
+		// VLESS 协议字段
+		VLESSUUID:          uuid,
+		VLESSFlow:          q.Get("flow"),
+		VLESSEncryption:    encryption,
+		VLESSSecurity:      security,
+		VLESSNetwork:       network,
+		VLESSHeaderType:    q.Get("headerType"),
+		VLESSHost:          q.Get("host"),
+		VLESSPath:          path,
+		VLESSSNI:           q.Get("sni"),
+		VLESSFingerprint:   q.Get("fp"),
+		VLESSAlpn:          q.Get("alpn"),
+		VLESSAllowInsecure: allowInsecure == "1" || strings.ToLower(allowInsecure) == "true",
+		VLESSPublicKey:     q.Get("pbk"),
+		VLESSShortID:       q.Get("sid"),
+		VLESSSpiderX:       q.Get("spx"),
+		// 保存原始配置
+		RawConfig: content,
+	}
+
+	// REALITY 必须提供公钥
+	if s.VLESSSecurity == "reality" && s.VLESSPublicKey == "" {
+		return nil, fmt.Errorf("invalid VLESS REALITY config: missing pbk")
+	}
+
+	// 如果名称为空，使用地址:端口作为名称
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("%s:%d", s.Addr, s.Port)
+	}
+
+	s.ID = server.GenerateServerID(s)
 	return s, nil
 }
 
@@ -362,15 +483,22 @@ type SOCKS5Parser struct{}
 
 // Parse 解析SOCKS5协议
 func (p *SOCKS5Parser) Parse(content string) (*config.Server, error) {
-	socks5Regex := regexp.MustCompile(`^socks5://(?:([^:]+):([^@]+)@)?([^:]+):(\d+)$`)
+	// 地址可以是方括号包裹的 IPv6 地址，用户名和密码经过 URL 转义
+	socks5Regex := regexp.MustCompile(`^socks5://(?:([^:@]+):([^@]+)@)?(\[[^\]]+\]|[^:\[\]]+):(\d+)$`)
 	matches := socks5Regex.FindStringSubmatch(content)
 	if matches == nil {
 		return nil, fmt.Errorf("invalid SOCKS5 format")
 	}
 
-	username := matches[1]
-	password := matches[2]
-	addr := matches[3]
+	username, err := url.PathUnescape(matches[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 username: %w", err)
+	}
+	password, err := url.PathUnescape(matches[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 password: %w", err)
+	}
+	addr := strings.Trim(matches[3], "[]")
 	portStr := matches[4]
 
 	port, err := strconv.Atoi(portStr)
@@ -378,12 +506,8 @@ func (p *SOCKS5Parser) Parse(content string) (*config.Server, error) {
 		return nil, fmt.Errorf("invalid SOCKS5 port: %w", err)
 	}
 
-	// 生成服务器ID
-	serverID := server.GenerateServerID(addr, port, username)
-
 	// 创建服务器配置
 	s := &config.Server{
-		ID:           serverID,
 		Name:         fmt.Sprintf("%s:%d", addr, port),
 		Addr:         addr,
 		Port:         port,
@@ -396,6 +520,7 @@ func (p *SOCKS5Parser) Parse(content string) (*config.Server, error) {
 		RawConfig:    content,
 	}
 
+	s.ID = server.GenerateServerID(s)
 	return s, nil
 }
 
@@ -420,12 +545,8 @@ func (p *SimpleParser) Parse(content string) (*config.Server, error) {
 		return nil, fmt.Errorf("invalid simple port: %w", err)
 	}
 
-	// 生成服务器ID
-	serverID := server.GenerateServerID(addr, port, username)
-
 	// 创建服务器配置
 	s := &config.Server{
-		ID:           serverID,
 		Name:         fmt.Sprintf("%s:%d", addr, port),
 		Addr:         addr,
 		Port:         port,
@@ -438,6 +559,7 @@ func (p *SimpleParser) Parse(content string) (*config.Server, error) {
 		RawConfig:    content,
 	}
 
+	s.ID = server.GenerateServerID(s)
 	return s, nil
 }
 
@@ -445,8 +567,14 @@ func (p *SimpleParser) Parse(content string) (*config.Server, error) {
 type SubscriptionManager struct {
 	serverManager *server.ServerManager
 	client        *http.Client
-	parsers       map[string]ServerParser  // 服务器配置解析器映射，key为协议前缀
+	parsers       map[string]ServerParser // 服务器配置解析器映射，key为协议前缀
+	formatParsers []SubscriptionParser    // 整体订阅格式解析器，按注册顺序尝试
+	logger        *logging.Logger         // 日志记录器（可为 nil），用于流量和到期提醒
+	localProxy    func() *url.URL         // 返回正在运行的本地代理地址（未运行时为 nil），用于通过代理获取订阅
+
+	mu            sync.RWMutex             // 保护 subscriptions 和 updateLocks（自动更新在后台 goroutine 中执行）
 	subscriptions []*database.Subscription // 订阅列表
+	updateLocks   map[string]*sync.Mutex   // 每个订阅地址的更新锁，串行化同一订阅的手动和自动更新
 }
 
 // NewSubscriptionManager 创建新的订阅管理器
@@ -454,16 +582,25 @@ func NewSubscriptionManager(serverManager *server.ServerManager) *SubscriptionMa
 	// 注册所有支持的解析器
 	parsers := make(map[string]ServerParser)
 	parsers["vmess://"] = &VMessParser{}
+	parsers["vless://"] = &VLESSParser{}
 	parsers["ss://"] = &SSParser{}
 	parsers["trojan://"] = &TrojanParser{}
 	parsers["socks5://"] = &SOCKS5Parser{}
 
+	// 注册整体订阅格式解析器
+	formatParsers := []SubscriptionParser{
+		&ClashParser{},
+		&SingBoxParser{},
+		&SIP008Parser{},
+	}
+
 	sm := &SubscriptionManager{
 		serverManager: serverManager,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		parsers: parsers,
+		parsers:       parsers,
+		formatParsers: formatParsers,
 	}
 
 	// 初始化时从数据库加载订阅列表
@@ -472,6 +609,16 @@ func NewSubscriptionManager(serverManager *server.ServerManager) *SubscriptionMa
 	return sm
 }
 
+// SetLogger 设置日志记录器，订阅流量或到期需要提醒时写入警告日志
+func (sm *SubscriptionManager) SetLogger(logger *logging.Logger) {
+	sm.logger = logger
+}
+
+// SetLocalProxy 设置本地代理地址的获取函数，订阅设置为通过本地代理获取时调用，代理未运行时应返回 nil
+func (sm *SubscriptionManager) SetLocalProxy(proxy func() *url.URL) {
+	sm.localProxy = proxy
+}
+
 // LoadSubscriptionsFromDB 从数据库加载订阅列表到内存
 func (sm *SubscriptionManager) LoadSubscriptionsFromDB() error {
 	subscriptions, err := database.GetAllSubscriptions()
@@ -479,154 +626,452 @@ func (sm *SubscriptionManager) LoadSubscriptionsFromDB() error {
 		return fmt.Errorf("加载订阅列表失败: %w", err)
 	}
 
+	sm.mu.Lock()
 	sm.subscriptions = subscriptions
+	sm.mu.Unlock()
 	return nil
 }
 
-// GetSubscriptions 获取所有订阅列表
+// GetSubscriptions 获取所有订阅列表（副本）
 func (sm *SubscriptionManager) GetSubscriptions() []*database.Subscription {
-	return sm.subscriptions
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]*database.Subscription(nil), sm.subscriptions...)
+}
+
+// lockSubscription 获取订阅地址对应的更新锁，同一订阅的更新依次执行，返回解锁函数
+func (sm *SubscriptionManager) lockSubscription(url string) func() {
+	sm.mu.Lock()
+	if sm.updateLocks == nil {
+		sm.updateLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := sm.updateLocks[url]
+	if !ok {
+		lock = &sync.Mutex{}
+		sm.updateLocks[url] = lock
+	}
+	sm.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
 }
 
-// FetchSubscription 从URL获取订阅服务器列表
+// FetchSubscription 从URL获取订阅服务器列表，并用其替换该订阅下的服务器
 // label 参数用于为订阅添加标签，如果为空则使用默认标签
 func (sm *SubscriptionManager) FetchSubscription(url string, label ...string) ([]config.Server, error) {
+	subscriptionLabel := ""
+	if len(label) > 0 && label[0] != "" {
+		subscriptionLabel = label[0]
+	}
+
+	unlock := sm.lockSubscription(url)
+	defer unlock()
+	servers, _, err := sm.fetchAndApply(url, subscriptionLabel)
+	return servers, err
+}
+
+// fetch 按请求设置下载并解析订阅内容，不修改数据库
+func (sm *SubscriptionManager) fetch(url string, options database.SubscriptionFetchOptions) ([]config.Server, http.Header, error) {
+	body, header, _, err := sm.download(url, options, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 解析订阅内容
+	servers, err := sm.parseSubscription(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析订阅失败: %w", err)
+	}
+
+	return servers, header, nil
+}
+
+// download 按请求设置下载订阅原始内容，订阅地址失败时按顺序尝试备用地址。
+// cache 中有内容时发送条件请求（If-None-Match / If-Modified-Since），服务器返回 304 时使用缓存内容。
+// 返回：订阅内容、响应头、内容是否来自缓存和错误（如果有，包含每个地址的失败原因）
+func (sm *SubscriptionManager) download(url string, options database.SubscriptionFetchOptions, cache *database.SubscriptionCache) (string, http.Header, bool, error) {
+	client, err := sm.clientFor(options)
+	if err != nil {
+		return "", nil, false, err
+	}
+	// 指向本地代理的客户端每次获取时新建，用完后关闭空闲连接
+	if client != sm.client {
+		defer client.CloseIdleConnections()
+	}
+
+	urls := fetchURLs(url, options)
+	var errs []error
+	for i, u := range urls {
+		body, header, cached, err := sm.downloadFrom(client, u, options, cache)
+		if err == nil {
+			if i > 0 && sm.logger != nil {
+				sm.logger.Warn("订阅地址 %s 获取失败，已使用备用地址 %s", url, u)
+			}
+			return body, header, cached, nil
+		}
+		if len(urls) > 1 {
+			err = fmt.Errorf("%s: %w", u, err)
+		}
+		errs = append(errs, err)
+	}
+	return "", nil, false, errors.Join(errs...)
+}
+
+// downloadFrom 从单个地址下载订阅原始内容，参数与返回值同 download
+func (sm *SubscriptionManager) downloadFrom(client *http.Client, url string, options database.SubscriptionFetchOptions, cache *database.SubscriptionCache) (string, http.Header, bool, error) {
+	req, err := newFetchRequest(url, options)
+	if err != nil {
+		return "", nil, false, err
+	}
+	conditional := cache != nil && cache.Body != ""
+	if conditional {
+		if cache.ETag != "" {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+
 	// 发送HTTP请求获取订阅内容
-	resp, err := sm.client.Get(url)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("获取订阅失败: %w", err)
+		return "", nil, false, fmt.Errorf("获取订阅失败: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return cache.Body, resp.Header, true, nil
+	}
+	// 错误页面不能当作订阅内容解析和缓存
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, false, fmt.Errorf("获取订阅失败: 服务器返回 %s", resp.Status)
+	}
+
 	// 读取响应内容
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取订阅内容失败: %w", err)
+		return "", nil, false, fmt.Errorf("读取订阅内容失败: %w", err)
 	}
 
-	// 解析订阅内容
-	servers, err := sm.parseSubscription(string(body))
+	return string(body), resp.Header, false, nil
+}
+
+// PreviewFilter 按请求设置下载并解析订阅，返回应用给定过滤与重命名规则后的结果，不修改数据库
+func (sm *SubscriptionManager) PreviewFilter(url string, options database.SubscriptionFetchOptions, filter database.SubscriptionFilter) (*FilterResult, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	servers, _, err := sm.fetch(url, options)
 	if err != nil {
-		return nil, fmt.Errorf("解析订阅失败: %w", err)
+		return nil, err
 	}
+	return ApplyFilter(servers, filter)
+}
 
-	// 保存订阅到数据库
-	subscriptionLabel := ""
-	if len(label) > 0 && label[0] != "" {
-		subscriptionLabel = label[0]
+// fetchAndApply 先下载并解析订阅，在一个事务中替换该订阅下的服务器，成功后再保存订阅信息、解析报告和原始内容。
+// 订阅已有缓存时发送条件请求，内容未变化则使用缓存重新解析。
+// 请求使用订阅已保存的请求设置（请求头、认证、备用地址、是否通过本地代理）。
+// 下载、解析或替换服务器失败时不修改数据库（已有订阅只记录解析报告），订阅原有的服务器和缓存保持不变。
+// 返回：最新的服务器列表和相对于更新前的变化
+func (sm *SubscriptionManager) fetchAndApply(url, label string) ([]config.Server, *SubscriptionDiff, error) {
+	var cache *database.SubscriptionCache
+	var options database.SubscriptionFetchOptions
+	existing, err := database.GetSubscriptionByURL(url)
+	if err == nil && existing != nil {
+		cache, _ = database.GetSubscriptionCache(existing.ID)
+		options = existing.FetchOptions
 	}
 
-	sub, err := database.AddOrUpdateSubscription(url, subscriptionLabel)
+	body, header, cached, err := sm.download(url, options, cache)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, report, err := sm.parseWithReport(body)
+	if err != nil {
+		// 已有订阅保留本次的解析报告，便于查看失败原因
+		if existing != nil {
+			sm.saveParseReport(existing, report)
+		}
+		return nil, nil, fmt.Errorf("解析订阅失败: %w", err)
+	}
+
+	// 新订阅需要先创建记录以获得 ID（节点 ID 按所属订阅生成），替换服务器失败时删除
+	sub := existing
+	if sub == nil {
+		if sub, err = database.AddOrUpdateSubscription(url, label); err != nil {
+			return nil, nil, fmt.Errorf("保存订阅到数据库失败: %w", err)
+		}
+	}
+	servers, diff, err := sm.applyServers(sub, parsed)
 	if err != nil {
-		return nil, fmt.Errorf("保存订阅到数据库失败: %w", err)
+		if existing == nil {
+			if err := database.DeleteSubscription(sub.ID); err != nil && sm.logger != nil {
+				sm.logger.Error("%v", err)
+			}
+		}
+		return nil, nil, err
 	}
 
-	// 保存服务器到数据库
-	var subscriptionID *int64
-	if sub != nil {
-		subscriptionID = &sub.ID
+	// 服务器已替换，保存订阅信息
+	if sub, err = database.AddOrUpdateSubscription(url, label); err != nil {
+		return nil, nil, fmt.Errorf("保存订阅到数据库失败: %w", err)
 	}
 
-	for _, s := range servers {
-		if err := database.AddOrUpdateServer(s, subscriptionID); err != nil {
-			return nil, fmt.Errorf("保存服务器到数据库失败: %w", err)
+	// 保存响应头中的流量与到期信息
+	sm.saveUsage(sub, header)
+	sm.saveParseReport(sub, report)
+
+	// 缓存原始内容，304 响应可能不带 ETag 等响应头，此时沿用原值
+	newCache := database.SubscriptionCache{
+		Body:         body,
+		FetchedAt:    time.Now(),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	if cached {
+		if newCache.ETag == "" {
+			newCache.ETag = cache.ETag
+		}
+		if newCache.LastModified == "" {
+			newCache.LastModified = cache.LastModified
 		}
 	}
+	if err := database.SaveSubscriptionCache(sub.ID, newCache); err != nil && sm.logger != nil {
+		sm.logger.Error("%v", err)
+	}
 
 	// 更新内存中的订阅列表
 	if err := sm.LoadSubscriptionsFromDB(); err != nil {
-		return nil, fmt.Errorf("更新订阅列表失败: %w", err)
+		return nil, nil, fmt.Errorf("更新订阅列表失败: %w", err)
 	}
-
-	return servers, nil
+	return servers, diff, nil
 }
 
-// UpdateSubscription 更新订阅
-// label 参数用于更新订阅标签，如果为空则保持原有标签
-func (sm *SubscriptionManager) UpdateSubscription(url string, label ...string) error {
-	// 获取订阅服务器列表（会自动保存到数据库）
-	subscriptionLabel := ""
-	if len(label) > 0 && label[0] != "" {
-		subscriptionLabel = label[0]
-	} else {
-		// 如果未提供标签，尝试从数据库获取现有标签
-		existingSub, err := database.GetSubscriptionByURL(url)
-		if err == nil && existingSub != nil {
-			subscriptionLabel = existingSub.Label
-		}
+// ReparseSubscription 使用缓存的原始内容重新解析订阅并替换其服务器，不访问网络。
+// 用于解析器改进或过滤规则修改后，在订阅地址不可用时重建服务器列表。
+func (sm *SubscriptionManager) ReparseSubscription(id int64) (*SubscriptionDiff, error) {
+	sub, err := database.GetSubscriptionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("获取订阅信息失败: %w", err)
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("订阅不存在: %d", id)
 	}
 
-	// 获取现有订阅（用于清理旧服务器）
-	existingSub, err := database.GetSubscriptionByURL(url)
+	unlock := sm.lockSubscription(sub.URL)
+	defer unlock()
+	cache, err := database.GetSubscriptionCache(id)
 	if err != nil {
-		return fmt.Errorf("获取订阅信息失败: %w", err)
+		return nil, err
+	}
+	if cache == nil || cache.Body == "" {
+		return nil, fmt.Errorf("订阅 %s 没有缓存的内容，请先在线更新一次", sub.DisplayName())
 	}
 
-	// 如果存在旧订阅，先清理该订阅下的服务器，避免更新后重复累加
-	if existingSub != nil {
-		if err := database.DeleteServersBySubscriptionID(existingSub.ID); err != nil {
-			return fmt.Errorf("清理旧订阅服务器失败: %w", err)
+	parsed, report, err := sm.parseWithReport(cache.Body)
+	if err != nil {
+		sm.saveParseReport(sub, report)
+		return nil, fmt.Errorf("解析缓存的订阅内容失败: %w", err)
+	}
+	_, diff, err := sm.applyServers(sub, parsed)
+	if err != nil {
+		return nil, err
+	}
+	sm.saveParseReport(sub, report)
+
+	// 更新内存中的订阅列表
+	if err := sm.LoadSubscriptionsFromDB(); err != nil {
+		return nil, fmt.Errorf("更新订阅列表失败: %w", err)
+	}
+	return diff, nil
+}
+
+// applyServers 对解析出的服务器去重并应用过滤规则，保留本地数据后在一个事务中替换订阅下的服务器。
+// 节点 ID 按所属订阅重新生成，同一节点出现在多个订阅中时互不影响。
+func (sm *SubscriptionManager) applyServers(sub *database.Subscription, parsed []config.Server) ([]config.Server, *SubscriptionDiff, error) {
+	// 订阅中重复的节点只保留第一个
+	seen := make(map[string]bool, len(parsed))
+	servers := make([]config.Server, 0, len(parsed))
+	for _, s := range parsed {
+		s.ID = server.GenerateSubscriptionServerID(&s, sub.ID)
+		if !seen[s.ID] {
+			seen[s.ID] = true
+			servers = append(servers, s)
 		}
 	}
 
-	// 拉取并保存最新服务器；内部会更新订阅标签并写库
-	servers, err := sm.FetchSubscription(url, subscriptionLabel)
+	// 应用订阅的过滤与重命名规则，规则把节点全部过滤掉时视为配置错误，不清空订阅
+	filtered, err := ApplyFilter(servers, sub.Filter)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("应用订阅过滤规则失败: %w", err)
 	}
+	if len(filtered.Kept) == 0 {
+		return nil, nil, fmt.Errorf("订阅的 %d 个节点全部被过滤规则排除", len(servers))
+	}
+	servers = filtered.Kept
 
-	// 再次获取订阅信息（防止标签更新或首次创建）
-	sub, err := database.GetSubscriptionByURL(url)
+	previous, err := database.GetServersBySubscriptionID(sub.ID)
 	if err != nil {
-		return fmt.Errorf("获取订阅信息失败: %w", err)
+		return nil, nil, fmt.Errorf("获取订阅服务器失败: %w", err)
+	}
+
+	for i := range servers {
+		// 已存在的节点保留选中状态、延迟等本地数据
+		if existing, err := database.GetServer(servers[i].ID); err == nil {
+			keepServerState(&servers[i], existing)
+		}
 	}
+	diff := diffServers(previous, servers)
 
-	var subscriptionID *int64
-	if sub != nil {
-		subscriptionID = &sub.ID
+	if err := database.ReplaceSubscriptionServers(sub.ID, servers); err != nil {
+		return nil, nil, fmt.Errorf("保存服务器到数据库失败: %w", err)
 	}
 
-	// 更新服务器列表（同时更新内存和数据库）
-	for _, s := range servers {
-		// 检查服务器是否已存在（从数据库）
-		existingServer, err := database.GetServer(s.ID)
-		if err == nil {
-			// 服务器已存在，保留选中状态和延迟
-			s.Selected = existingServer.Selected
-			s.Delay = existingServer.Delay
+	// 从数据库同步内存中的服务器列表
+	if sm.serverManager != nil {
+		if err := sm.serverManager.LoadServersFromDB(); err != nil {
+			return nil, nil, fmt.Errorf("更新服务器到内存失败: %w", err)
 		}
+	}
+
+	return servers, diff, nil
+}
 
-		// 更新数据库中的服务器信息
-		if err := database.AddOrUpdateServer(s, subscriptionID); err != nil {
-			return fmt.Errorf("更新服务器到数据库失败: %w", err)
+// saveUsage 解析 subscription-userinfo 和 profile-title 响应头并保存，
+// 流量越过提醒阈值或即将到期时写入警告日志
+func (sm *SubscriptionManager) saveUsage(sub *database.Subscription, header http.Header) {
+	profileTitle := parseProfileTitle(header.Get("Profile-Title"))
+	usage, ok := ParseUserinfo(header.Get("Subscription-Userinfo"))
+	if !ok {
+		if profileTitle == "" {
+			return
 		}
+		// 只有名称时保留原有的流量信息
+		usage = sub.Usage
+	} else {
+		usage.UpdatedAt = time.Now()
+	}
 
-		// 同时更新内存中的服务器信息（保持兼容性）
-		if err := sm.serverManager.UpdateServer(s); err != nil {
-			// 如果内存中不存在，则添加
-			if err := sm.serverManager.AddServer(s); err != nil {
-				return fmt.Errorf("更新服务器到内存失败: %w", err)
-			}
+	if err := database.UpdateSubscriptionUsage(sub.ID, usage, profileTitle); err != nil {
+		if sm.logger != nil {
+			sm.logger.Error("保存订阅流量信息失败: %v", err)
 		}
+		return
+	}
+	if !ok || sm.logger == nil {
+		return
 	}
 
-	// 更新内存中的订阅列表
-	if err := sm.LoadSubscriptionsFromDB(); err != nil {
-		return fmt.Errorf("更新订阅列表失败: %w", err)
+	for _, warning := range usageWarnings(sub.DisplayName(), sub.Usage, usage, usage.UpdatedAt) {
+		sm.logger.Warn("%s", warning)
 	}
+}
 
-	return nil
+// saveParseReport 保存订阅的解析报告并记录解析条数，有无法解析的条目时写入警告日志
+func (sm *SubscriptionManager) saveParseReport(sub *database.Subscription, report *database.ParseReport) {
+	if err := database.SetSubscriptionParseReport(sub.ID, *report); err != nil {
+		if sm.logger != nil {
+			sm.logger.Error("%v", err)
+		}
+		return
+	}
+	if sm.logger == nil {
+		return
+	}
+	sm.logger.InfoWithType(logging.LogTypeApp, "订阅 %s 解析结果 %s", sub.DisplayName(), report.Summary())
+	if report.Failed() > 0 {
+		sm.logger.Warn("订阅 %s 有 %d 条内容无法解析，可在订阅卡片中查看解析报告", sub.DisplayName(), report.Failed())
+	}
+}
+
+// UpdateSubscription 更新订阅，返回服务器列表的变化，并记录本次更新结果和下次自动更新时间
+// label 参数用于更新订阅标签，如果为空则保持原有标签
+func (sm *SubscriptionManager) UpdateSubscription(url string, label ...string) (*SubscriptionDiff, error) {
+	unlock := sm.lockSubscription(url)
+	defer unlock()
+
+	subscriptionLabel := ""
+	if len(label) > 0 && label[0] != "" {
+		subscriptionLabel = label[0]
+	} else {
+		// 如果未提供标签，尝试从数据库获取现有标签
+		existingSub, err := database.GetSubscriptionByURL(url)
+		if err == nil && existingSub != nil {
+			subscriptionLabel = existingSub.Label
+		}
+	}
+
+	_, diff, err := sm.fetchAndApply(url, subscriptionLabel)
+	sm.recordUpdate(url, err)
+	return diff, err
+}
+
+// UpdateSubscriptionByID 根据订阅 ID 更新订阅（保持原有标签），返回服务器列表的变化
+func (sm *SubscriptionManager) UpdateSubscriptionByID(id int64) (*SubscriptionDiff, error) {
+	sub, err := database.GetSubscriptionByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("获取订阅信息失败: %w", err)
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("订阅不存在: %d", id)
+	}
+	return sm.UpdateSubscription(sub.URL, sub.Label)
+}
+
+// recordUpdate 保存订阅的更新结果，订阅尚不存在（首次获取失败）时不做记录
+func (sm *SubscriptionManager) recordUpdate(url string, updateErr error) {
+	sub, err := database.GetSubscriptionByURL(url)
+	if err != nil || sub == nil {
+		return
+	}
+	schedule := nextSchedule(sub.Schedule, updateErr, time.Now())
+	if err := database.UpdateSubscriptionSchedule(sub.ID, schedule); err != nil && sm.logger != nil {
+		sm.logger.Error("保存订阅更新结果失败: %v", err)
+	}
+}
+
+// keepServerState 将已有节点的本地数据（选中状态、延迟、测速结果、启用状态、前置节点）保留到新解析的节点
+func keepServerState(s *config.Server, existing *config.Server) {
+	s.Selected = existing.Selected
+	s.Delay = existing.Delay
+	s.SpeedMbps = existing.SpeedMbps
+	s.Enabled = existing.Enabled
+	s.UpstreamID = existing.UpstreamID
 }
 
 // parseSubscription 解析订阅内容
 func (sm *SubscriptionManager) parseSubscription(content string) ([]config.Server, error) {
+	servers, _, err := sm.parseWithReport(content)
+	return servers, err
+}
+
+// parseWithReport 解析订阅内容，同时生成解析报告，记录每个无法解析的条目、尝试的解析器和原因。
+// 解析失败时也会返回报告。
+func (sm *SubscriptionManager) parseWithReport(content string) ([]config.Server, *database.ParseReport, error) {
+	report := &database.ParseReport{ParsedAt: time.Now()}
+
 	// 尝试解码Base64
 	decoded, err := base64.StdEncoding.DecodeString(content)
 	if err == nil {
 		content = string(decoded)
 	}
 
-	// 1. 尝试JSON格式
+	// 1. 尝试整体订阅格式（Clash YAML、sing-box、SIP008）
+	for _, parser := range sm.formatParsers {
+		if parser.CanParse(content) {
+			report.Format = formatName(parser)
+			if rp, ok := parser.(reportingParser); ok {
+				servers, err := rp.parseAll(content, report)
+				return servers, report, err
+			}
+			servers, err := parser.ParseAll(content)
+			report.Total, report.Accepted = len(servers), len(servers)
+			return servers, report, err
+		}
+	}
+
+	// 2. 尝试自定义JSON格式 [{name,addr,port,username,password}]
 	var jsonServers []struct {
 		Name     string `json:"name"`
 		Addr     string `json:"addr"`
@@ -637,11 +1082,12 @@ func (sm *SubscriptionManager) parseSubscription(content string) ([]config.Serve
 
 	if err := json.Unmarshal([]byte(content), &jsonServers); err == nil {
 		// JSON格式解析成功
+		report.Format = "JSON"
+		report.Total, report.Accepted = len(jsonServers), len(jsonServers)
 		servers := make([]config.Server, len(jsonServers))
 		for i, js := range jsonServers {
 			rawConfig, _ := json.Marshal(js)
 			servers[i] = config.Server{
-				ID:           server.GenerateServerID(js.Addr, js.Port, js.Username),
 				Name:         js.Name,
 				Addr:         js.Addr,
 				Port:         js.Port,
@@ -653,28 +1099,26 @@ func (sm *SubscriptionManager) parseSubscription(content string) ([]config.Serve
 				ProtocolType: "socks5", // JSON格式默认为 SOCKS5
 				RawConfig:    string(rawConfig),
 			}
+			servers[i].ID = server.GenerateServerID(&servers[i])
 		}
-		return servers, nil
+		return servers, report, nil
 	}
 
-	// 2. 尝试Clash格式 (每行一个服务器配置)
+	// 3. 尝试逐行解析 (每行一个服务器链接)
+	report.Format = "链接"
 	lines := strings.Split(content, "\n")
 	var servers []config.Server
 
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
 
-		// 尝试解析Clash格式
-		if strings.HasPrefix(line, "- name:") {
-			// 多行Clash格式，暂时不支持
-			continue
-		}
-
 		// 使用注册的解析器解析服务器配置
 		var parsedServer *config.Server
+		var parseErr error
+		tried := ""
 
 		// 直接根据前缀获取解析器
 		// 查找字符串中第一个 "://" 出现的位置
@@ -683,25 +1127,37 @@ func (sm *SubscriptionManager) parseSubscription(content string) ([]config.Serve
 			prefix := line[:idx+3]
 			// 从 map 中获取对应的解析器
 			if parser, ok := sm.parsers[prefix]; ok {
-				parsedServer, err = parser.Parse(line)
+				tried = parserName(parser)
+				parsedServer, parseErr = parser.Parse(line)
+			} else {
+				tried = "（无）"
+				parseErr = fmt.Errorf("不支持的协议: %s", prefix)
 			}
 		}
 
 		// 如果没有找到解析器或解析失败，尝试使用 SimpleParser
 		if parsedServer == nil {
 			simpleParser := &SimpleParser{}
-			parsedServer, err = simpleParser.Parse(line)
+			var simpleErr error
+			parsedServer, simpleErr = simpleParser.Parse(line)
+			// 报告中优先保留协议解析器的错误，对没有协议前缀的行才报告 SimpleParser 的错误
+			if tried == "" {
+				tried, parseErr = parserName(simpleParser), simpleErr
+			}
 		}
 
 		// 如果解析成功，添加到服务器列表
 		if parsedServer != nil {
+			recordAccepted(report)
 			servers = append(servers, *parsedServer)
+		} else {
+			recordRejected(report, i+1, redactLine(line), tried, parseErr)
 		}
 	}
 
 	if len(servers) == 0 {
-		return nil, fmt.Errorf("不支持的订阅格式")
+		return nil, report, fmt.Errorf("不支持的订阅格式")
 	}
 
-	return servers, nil
+	return servers, report, nil
 }
@@ -1,9 +1,18 @@
 package subscription
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/server"
 )
 
 func TestSSParser(t *testing.T) {
@@ -123,3 +132,435 @@ func TestTrojanParser(t *testing.T) {
 		})
 	}
 }
+
+func TestVLESSParser(t *testing.T) {
+	// 测试VLESS协议解析
+	testCases := []struct {
+		name     string
+		input    string
+		expected *config.Server
+		wantErr  bool
+	}{
+		{
+			name:  "REALITY with Vision",
+			input: "vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?encryption=none&flow=xtls-rprx-vision&security=reality&sni=www.microsoft.com&fp=chrome&pbk=SbVKOEMjK0sIlbwg4akyBg5mL5KZwwB-ed4eEE7YnRc&sid=6ba85179e30d4fc2&type=tcp#RealityServer",
+			expected: &config.Server{
+				Name:             "RealityServer",
+				Addr:             "example.com",
+				Port:             443,
+				ProtocolType:     "vless",
+				VLESSUUID:        "b831381d-6324-4d53-ad4f-8cda48b30811",
+				VLESSFlow:        "xtls-rprx-vision",
+				VLESSSecurity:    "reality",
+				VLESSNetwork:     "tcp",
+				VLESSSNI:         "www.microsoft.com",
+				VLESSFingerprint: "chrome",
+				VLESSPublicKey:   "SbVKOEMjK0sIlbwg4akyBg5mL5KZwwB-ed4eEE7YnRc",
+				VLESSShortID:     "6ba85179e30d4fc2",
+			},
+			wantErr: false,
+		},
+		{
+			name:  "TLS over WebSocket",
+			input: "vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:8443?security=tls&type=ws&host=cdn.example.com&path=%2Fws&sni=cdn.example.com",
+			expected: &config.Server{
+				Name:          "example.com:8443",
+				Addr:          "example.com",
+				Port:          8443,
+				ProtocolType:  "vless",
+				VLESSUUID:     "b831381d-6324-4d53-ad4f-8cda48b30811",
+				VLESSSecurity: "tls",
+				VLESSNetwork:  "ws",
+				VLESSHost:     "cdn.example.com",
+				VLESSPath:     "/ws",
+				VLESSSNI:      "cdn.example.com",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "REALITY without public key",
+			input:   "vless://b831381d-6324-4d53-ad4f-8cda48b30811@example.com:443?security=reality&sni=www.microsoft.com",
+			wantErr: true,
+		},
+		{
+			name:    "missing uuid",
+			input:   "vless://example.com:443",
+			wantErr: true,
+		},
+	}
+
+	parser := &VLESSParser{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := parser.Parse(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("VLESSParser.Parse() error = %v, wantErr %v", err, tc.wantErr)
+				return
+			}
+
+			if !tc.wantErr {
+				if server.ID == "" {
+					t.Errorf("Server.ID = '', want non-empty string")
+				}
+				if server.Name != tc.expected.Name {
+					t.Errorf("Server.Name = %v, want %v", server.Name, tc.expected.Name)
+				}
+				if server.Addr != tc.expected.Addr {
+					t.Errorf("Server.Addr = %v, want %v", server.Addr, tc.expected.Addr)
+				}
+				if server.Port != tc.expected.Port {
+					t.Errorf("Server.Port = %v, want %v", server.Port, tc.expected.Port)
+				}
+				if server.ProtocolType != tc.expected.ProtocolType {
+					t.Errorf("Server.ProtocolType = %v, want %v", server.ProtocolType, tc.expected.ProtocolType)
+				}
+				if server.VLESSUUID != tc.expected.VLESSUUID {
+					t.Errorf("Server.VLESSUUID = %v, want %v", server.VLESSUUID, tc.expected.VLESSUUID)
+				}
+				if server.VLESSFlow != tc.expected.VLESSFlow {
+					t.Errorf("Server.VLESSFlow = %v, want %v", server.VLESSFlow, tc.expected.VLESSFlow)
+				}
+				if server.VLESSSecurity != tc.expected.VLESSSecurity {
+					t.Errorf("Server.VLESSSecurity = %v, want %v", server.VLESSSecurity, tc.expected.VLESSSecurity)
+				}
+				if server.VLESSNetwork != tc.expected.VLESSNetwork {
+					t.Errorf("Server.VLESSNetwork = %v, want %v", server.VLESSNetwork, tc.expected.VLESSNetwork)
+				}
+				if server.VLESSHost != tc.expected.VLESSHost {
+					t.Errorf("Server.VLESSHost = %v, want %v", server.VLESSHost, tc.expected.VLESSHost)
+				}
+				if server.VLESSPath != tc.expected.VLESSPath {
+					t.Errorf("Server.VLESSPath = %v, want %v", server.VLESSPath, tc.expected.VLESSPath)
+				}
+				if server.VLESSSNI != tc.expected.VLESSSNI {
+					t.Errorf("Server.VLESSSNI = %v, want %v", server.VLESSSNI, tc.expected.VLESSSNI)
+				}
+				if server.VLESSFingerprint != tc.expected.VLESSFingerprint {
+					t.Errorf("Server.VLESSFingerprint = %v, want %v", server.VLESSFingerprint, tc.expected.VLESSFingerprint)
+				}
+				if server.VLESSPublicKey != tc.expected.VLESSPublicKey {
+					t.Errorf("Server.VLESSPublicKey = %v, want %v", server.VLESSPublicKey, tc.expected.VLESSPublicKey)
+				}
+				if server.VLESSShortID != tc.expected.VLESSShortID {
+					t.Errorf("Server.VLESSShortID = %v, want %v", server.VLESSShortID, tc.expected.VLESSShortID)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateSubscriptionKeepsServerState(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "socks5://1.1.1.1:1080\nsocks5://2.2.2.2:1080\nsocks5://3.3.3.3:1080\n"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	serverManager := server.NewServerManager(config.DefaultConfig())
+	sm := NewSubscriptionManager(serverManager)
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+
+	first, err := sm.parseSubscription(content)
+	if err != nil || len(first) != 3 {
+		t.Fatalf("parseSubscription() = %v, %v", first, err)
+	}
+	sub, _ := database.GetSubscriptionByURL(provider.URL)
+	a := server.GenerateSubscriptionServerID(&first[0], sub.ID)
+	b := server.GenerateSubscriptionServerID(&first[1], sub.ID)
+	c := server.GenerateSubscriptionServerID(&first[2], sub.ID)
+
+	// 本地数据：选中 A、A 的延迟和历史、B 以 A 为前置节点
+	if err := serverManager.SelectServer(a); err != nil {
+		t.Fatalf("SelectServer() error = %v", err)
+	}
+	serverManager.UpdateServerDelay(a, 88)
+	database.AddLatencySample(database.LatencySample{ServerID: a, Delay: 88, Success: true})
+	if err := serverManager.SetServerUpstream(b, a); err != nil {
+		t.Fatalf("SetServerUpstream() error = %v", err)
+	}
+
+	// 订阅刷新后 C 被移除，新增 D
+	content = "socks5://1.1.1.1:1080\nsocks5://2.2.2.2:1080\nsocks5://4.4.4.4:1080\n"
+	diff, err := sm.UpdateSubscription(provider.URL, "test")
+	if err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	if diff.Total != 3 || len(diff.Added) != 1 || len(diff.Removed) != 1 || diff.Removed[0].ID != c || len(diff.Modified) != 0 {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	selected, err := serverManager.GetSelectedServer()
+	if err != nil || selected.ID != a || selected.Delay != 88 {
+		t.Errorf("刷新后选中的服务器 = %+v, err = %v", selected, err)
+	}
+	if got, err := database.GetServer(b); err != nil || got.UpstreamID != a {
+		t.Errorf("刷新后前置节点 = %+v, err = %v", got, err)
+	}
+	if samples, _ := database.GetLatencySamples(a, 10, time.Time{}); len(samples) != 1 {
+		t.Errorf("刷新后延迟历史 = %v", samples)
+	}
+	if _, err := database.GetServer(c); err == nil {
+		t.Error("订阅中已移除的节点应被删除")
+	}
+	if servers := serverManager.ListServers(); len(servers) != 3 {
+		t.Errorf("刷新后内存中有 %d 个服务器, want 3", len(servers))
+	}
+}
+
+func TestSubscriptionsShareNode(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	// 同一节点同时出现在两个订阅中，并被手动导入
+	content := "socks5://1.1.1.1:1080\n"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	serverManager := server.NewServerManager(config.DefaultConfig())
+	sm := NewSubscriptionManager(serverManager)
+	urlA, urlB := provider.URL+"/a", provider.URL+"/b"
+	for _, u := range []string{urlA, urlB} {
+		if _, err := sm.UpdateSubscription(u, ""); err != nil {
+			t.Fatalf("UpdateSubscription(%s) error = %v", u, err)
+		}
+	}
+	if _, err := sm.ImportText(content); err != nil {
+		t.Fatalf("ImportText() error = %v", err)
+	}
+	if servers, _ := database.GetAllServers(); len(servers) != 3 {
+		t.Fatalf("共有 %d 条服务器记录, want 3", len(servers))
+	}
+
+	// 刷新其中一个订阅不会把节点报告为新增，也不影响另一个订阅
+	diff, err := sm.UpdateSubscription(urlA, "")
+	if err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("diff = %+v", diff)
+	}
+	subB, _ := database.GetSubscriptionByURL(urlB)
+	if servers, _ := database.GetServersBySubscriptionID(subB.ID); len(servers) != 1 {
+		t.Errorf("订阅 B 有 %d 个节点, want 1", len(servers))
+	}
+
+	// 删除订阅 A 后，订阅 B 和手动导入的节点保留
+	subA, _ := database.GetSubscriptionByURL(urlA)
+	if err := database.DeleteSubscription(subA.ID); err != nil {
+		t.Fatalf("DeleteSubscription() error = %v", err)
+	}
+	if servers, _ := database.GetServersBySubscriptionID(subB.ID); len(servers) != 1 {
+		t.Errorf("删除订阅 A 后订阅 B 有 %d 个节点, want 1", len(servers))
+	}
+	if servers, _ := database.GetAllServers(); len(servers) != 2 {
+		t.Errorf("删除订阅 A 后共有 %d 条服务器记录, want 2", len(servers))
+	}
+}
+
+func TestUpdateSubscriptionFailureKeepsServers(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "socks5://1.1.1.1:1080\nsocks5://2.2.2.2:1080\n"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	sub, _ := database.GetSubscriptionByURL(provider.URL)
+
+	// 解析失败时不修改订阅下的服务器
+	content = "<html>502 Bad Gateway</html>"
+	if diff, err := sm.UpdateSubscription(provider.URL, "test"); err == nil || diff != nil {
+		t.Fatalf("UpdateSubscription() = %v, %v, want error", diff, err)
+	}
+	if n, _ := database.GetServerCountBySubscriptionID(sub.ID); n != 2 {
+		t.Errorf("更新失败后订阅下有 %d 个服务器, want 2", n)
+	}
+
+	// 替换服务器失败（节点全部被过滤）时不保存订阅信息和原始内容
+	if err := database.SetSubscriptionFilter(sub.ID, database.SubscriptionFilter{Include: "不存在"}); err != nil {
+		t.Fatalf("设置过滤规则失败: %v", err)
+	}
+	content = "socks5://3.3.3.3:1080\n"
+	if _, err := sm.UpdateSubscription(provider.URL, "changed"); err == nil {
+		t.Fatal("节点全部被过滤时 UpdateSubscription() 应返回错误")
+	}
+	if after, _ := database.GetSubscriptionByURL(provider.URL); after.Label != "test" {
+		t.Errorf("更新失败后订阅标签 = %q, want test", after.Label)
+	}
+	if cache, _ := database.GetSubscriptionCache(sub.ID); cache == nil || strings.Contains(cache.Body, "3.3.3.3") {
+		t.Errorf("更新失败后缓存 = %+v", cache)
+	}
+}
+
+func TestUpdateSubscriptionConcurrent(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	// 记录同时进行中的请求数，同一订阅的更新应依次执行
+	var inFlight, maxInFlight atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("socks5://1.1.1.1:1080\nsocks5://2.2.2.2:1080\n"))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+				t.Errorf("UpdateSubscription() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_ = sm.GetSubscriptions()
+		}()
+	}
+	wg.Wait()
+
+	if n := maxInFlight.Load(); n != 1 {
+		t.Errorf("同一订阅同时有 %d 个更新请求, want 1", n)
+	}
+	if subs := sm.GetSubscriptions(); len(subs) != 1 {
+		t.Errorf("GetSubscriptions() = %d 个订阅, want 1", len(subs))
+	}
+}
+
+func TestDiffServers(t *testing.T) {
+	a := config.Server{ID: "a", Name: "A", Addr: "1.1.1.1", Port: 1080, RawConfig: "a"}
+	b := config.Server{ID: "b", Name: "B", Addr: "2.2.2.2", Port: 1080}
+	c := config.Server{ID: "c", Name: "C", Addr: "3.3.3.3", Port: 1080}
+
+	renamed := b
+	renamed.Name = "B 新名称"
+	reformatted := a
+	reformatted.RawConfig = "a2"
+	diff := diffServers([]config.Server{a, b}, []config.Server{reformatted, renamed, c})
+
+	if len(diff.Added) != 1 || diff.Added[0].ID != "c" || len(diff.Removed) != 0 ||
+		len(diff.Modified) != 1 || diff.Modified[0].Name != "B 新名称" || diff.Total != 3 {
+		t.Errorf("diff = %+v", diff)
+	}
+	if got := diff.Summary(); got != "共 3 个节点：新增 1，删除 0，变更 1" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if got := diffServers([]config.Server{a}, []config.Server{a}); !got.Empty() {
+		t.Errorf("无变化时 Empty() = false: %+v", got)
+	}
+}
+
+func TestSubscriptionCacheAndReparse(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	content := "trojan://pass@1.1.1.1:443#HK-01\ntrojan://pass@2.2.2.2:443#JP-01\n"
+	var requests, notModified int
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(content))
+	}))
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	sub, _ := database.GetSubscriptionByURL(provider.URL)
+	cache, _ := database.GetSubscriptionCache(sub.ID)
+	if cache == nil || cache.Body != content || cache.ETag != `"v1"` || sub.FetchedAt.IsZero() {
+		t.Fatalf("缓存 = %+v", cache)
+	}
+
+	// 内容未变化时服务器返回 304，使用缓存内容
+	diff, err := sm.UpdateSubscription(provider.URL, "test")
+	if err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	if notModified != 1 || !diff.Empty() || diff.Total != 2 {
+		t.Errorf("304 更新: notModified = %d, diff = %s", notModified, diff.Summary())
+	}
+	if cache, _ := database.GetSubscriptionCache(sub.ID); cache.ETag != `"v1"` {
+		t.Errorf("304 后 ETag = %q, want 保留原值", cache.ETag)
+	}
+
+	// 订阅地址不可用时从缓存重新解析，新的过滤规则随之生效
+	provider.Close()
+	before := requests
+	if err := database.SetSubscriptionFilter(sub.ID, database.SubscriptionFilter{Exclude: "JP"}); err != nil {
+		t.Fatalf("设置过滤规则失败: %v", err)
+	}
+	diff, err = sm.ReparseSubscription(sub.ID)
+	if err != nil {
+		t.Fatalf("ReparseSubscription() error = %v", err)
+	}
+	if requests != before || diff.Total != 1 || len(diff.Removed) != 1 {
+		t.Errorf("重新解析: requests = %d, diff = %s", requests-before, diff.Summary())
+	}
+
+	// 网络错误不影响已有服务器
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err == nil {
+		t.Error("订阅地址不可用时应返回错误")
+	}
+	if n, _ := database.GetServerCountBySubscriptionID(sub.ID); n != 1 {
+		t.Errorf("订阅下有 %d 个服务器, want 1", n)
+	}
+}
+
+func TestUpdateSubscriptionHTTPError(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "socks5://1.1.1.1:1080", http.StatusServiceUnavailable)
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(server.NewServerManager(config.DefaultConfig()))
+	if _, err := sm.UpdateSubscription(provider.URL, "test"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("UpdateSubscription() error = %v, want 503", err)
+	}
+	if sub, _ := database.GetSubscriptionByURL(provider.URL); sub != nil {
+		t.Errorf("请求失败时不应保存订阅: %+v", sub)
+	}
+}
@@ -0,0 +1,114 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproxy.com/p/internal/database"
+)
+
+// 订阅流量与到期提醒阈值
+const (
+	UsageWarnRatio   = 0.9                // 已用流量达到总流量的比例时提醒
+	ExpireWarnBefore = 7 * 24 * time.Hour // 距离到期不足该时长时提醒
+)
+
+// ParseUserinfo 解析 subscription-userinfo 响应头。
+// 格式：upload=123; download=456; total=789; expire=1700000000（流量单位为字节，expire 为 Unix 秒）。
+// 没有任何可识别的字段时返回 false。
+func ParseUserinfo(header string) (database.SubscriptionUsage, bool) {
+	var usage database.SubscriptionUsage
+	found := false
+	for _, part := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		// 部分提供商会输出小数，按整数截断
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "upload":
+			usage.Upload = int64(n)
+		case "download":
+			usage.Download = int64(n)
+		case "total":
+			usage.Total = int64(n)
+		case "expire":
+			if n > 0 {
+				usage.ExpireAt = time.Unix(int64(n), 0)
+			}
+		default:
+			continue
+		}
+		found = true
+	}
+	return usage, found
+}
+
+// parseProfileTitle 解析 profile-title 响应头，支持 "base64:" 前缀的编码形式
+func parseProfileTitle(header string) string {
+	title := strings.TrimSpace(header)
+	if encoded, ok := strings.CutPrefix(title, "base64:"); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return ""
+		}
+		title = strings.TrimSpace(string(decoded))
+	}
+	return title
+}
+
+// usageWarnings 比较本次与上次获取的流量信息，返回需要提醒的内容。
+// 只在用量越过阈值或刚进入到期提醒范围时提醒一次，避免每次刷新重复提醒。
+func usageWarnings(name string, prev, cur database.SubscriptionUsage, now time.Time) []string {
+	var warnings []string
+
+	if cur.Total > 0 {
+		ratio := float64(cur.Used()) / float64(cur.Total)
+		prevRatio := 0.0
+		if prev.Total > 0 {
+			prevRatio = float64(prev.Used()) / float64(prev.Total)
+		}
+		if ratio >= UsageWarnRatio && (prev.UpdatedAt.IsZero() || prevRatio < UsageWarnRatio) {
+			warnings = append(warnings, fmt.Sprintf("订阅 %s 流量已使用 %.0f%%（%s / %s）",
+				name, ratio*100, formatBytes(cur.Used()), formatBytes(cur.Total)))
+		}
+	}
+
+	if !cur.ExpireAt.IsZero() {
+		remaining := cur.ExpireAt.Sub(now)
+		// 上次获取时尚未进入提醒范围（或到期时间有变化）才提醒
+		wasNear := !prev.UpdatedAt.IsZero() && prev.ExpireAt.Equal(cur.ExpireAt) &&
+			cur.ExpireAt.Sub(prev.UpdatedAt) <= ExpireWarnBefore
+		if remaining <= ExpireWarnBefore && !wasNear {
+			if remaining <= 0 {
+				warnings = append(warnings, fmt.Sprintf("订阅 %s 已于 %s 到期", name, cur.ExpireAt.Format("2006-01-02")))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("订阅 %s 将于 %s 到期（剩余 %d 天）",
+					name, cur.ExpireAt.Format("2006-01-02"), int(remaining.Hours()/24)))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// formatBytes 将字节数格式化为易读的字符串
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
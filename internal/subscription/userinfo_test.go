@@ -0,0 +1,111 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/database"
+)
+
+func TestParseUserinfo(t *testing.T) {
+	usage, ok := ParseUserinfo("upload=1024; download=2048;total=10737418240; expire=1893456000")
+	if !ok {
+		t.Fatal("ParseUserinfo() ok = false")
+	}
+	if usage.Upload != 1024 || usage.Download != 2048 || usage.Total != 10737418240 || usage.Used() != 3072 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if !usage.ExpireAt.Equal(time.Unix(1893456000, 0)) {
+		t.Errorf("ExpireAt = %v", usage.ExpireAt)
+	}
+
+	// expire=0 表示长期有效，小数按整数截断
+	usage, ok = ParseUserinfo("upload=1.5e3; download=0; total=0; expire=0")
+	if !ok || usage.Upload != 1500 || !usage.ExpireAt.IsZero() {
+		t.Errorf("usage = %+v, ok = %v", usage, ok)
+	}
+
+	if _, ok := ParseUserinfo("foo=bar"); ok {
+		t.Error("无法识别的内容应返回 false")
+	}
+}
+
+func TestParseProfileTitle(t *testing.T) {
+	if got := parseProfileTitle(" 机场 "); got != "机场" {
+		t.Errorf("parseProfileTitle() = %q", got)
+	}
+	encoded := "base64:" + base64.StdEncoding.EncodeToString([]byte("我的机场"))
+	if got := parseProfileTitle(encoded); got != "我的机场" {
+		t.Errorf("parseProfileTitle(base64) = %q", got)
+	}
+}
+
+func TestUsageWarnings(t *testing.T) {
+	now := time.Now()
+	const gb = 1 << 30
+
+	// 首次获取时已超过阈值，提醒
+	cur := database.SubscriptionUsage{Download: 95 * gb, Total: 100 * gb, UpdatedAt: now}
+	if w := usageWarnings("test", database.SubscriptionUsage{}, cur, now); len(w) != 1 {
+		t.Errorf("首次超过阈值: %v", w)
+	}
+	// 上次已超过阈值，不重复提醒
+	prev := database.SubscriptionUsage{Download: 91 * gb, Total: 100 * gb, UpdatedAt: now.Add(-time.Hour)}
+	if w := usageWarnings("test", prev, cur, now); len(w) != 0 {
+		t.Errorf("重复提醒: %v", w)
+	}
+	// 从阈值以下越过阈值，提醒
+	prev.Download = 80 * gb
+	if w := usageWarnings("test", prev, cur, now); len(w) != 1 {
+		t.Errorf("越过阈值: %v", w)
+	}
+
+	// 到期时间进入提醒范围时提醒一次
+	expire := now.Add(3 * 24 * time.Hour)
+	cur = database.SubscriptionUsage{ExpireAt: expire, UpdatedAt: now}
+	prev = database.SubscriptionUsage{ExpireAt: expire, UpdatedAt: now.Add(-5 * 24 * time.Hour)}
+	if w := usageWarnings("test", prev, cur, now); len(w) != 1 {
+		t.Errorf("即将到期: %v", w)
+	}
+	prev.UpdatedAt = now.Add(-time.Hour)
+	if w := usageWarnings("test", prev, cur, now); len(w) != 0 {
+		t.Errorf("到期重复提醒: %v", w)
+	}
+	// 远未到期不提醒
+	cur.ExpireAt = now.Add(30 * 24 * time.Hour)
+	if w := usageWarnings("test", database.SubscriptionUsage{}, cur, now); len(w) != 0 {
+		t.Errorf("远未到期: %v", w)
+	}
+}
+
+func TestFetchSubscriptionUserinfo(t *testing.T) {
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Subscription-Userinfo", "upload=100; download=200; total=1000; expire=1893456000")
+		w.Header().Set("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte("测试机场")))
+		w.Write([]byte("socks5://1.2.3.4:1080\n"))
+	}))
+	defer provider.Close()
+
+	sm := NewSubscriptionManager(nil)
+	if _, err := sm.FetchSubscription(provider.URL, "test"); err != nil {
+		t.Fatalf("FetchSubscription() error = %v", err)
+	}
+
+	sub, err := database.GetSubscriptionByURL(provider.URL)
+	if err != nil || sub == nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	if sub.ProfileTitle != "测试机场" || sub.Usage.Used() != 300 || sub.Usage.Total != 1000 ||
+		sub.Usage.ExpireAt.Unix() != 1893456000 || sub.Usage.UpdatedAt.IsZero() {
+		t.Errorf("订阅流量信息 = %+v", sub)
+	}
+}
@@ -2,8 +2,12 @@ package ui
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -11,6 +15,7 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"myproxy.com/p/internal/config"
 	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/failover"
 	"myproxy.com/p/internal/logging"
 	"myproxy.com/p/internal/ping"
 	"myproxy.com/p/internal/server"
@@ -31,7 +36,17 @@ type AppState struct {
 	SelectedServerID    string
 
 	// Xray 实例 - 用于 xray-core 代理
+	// 在 UI 线程中通过 SetXrayInstance 替换；后台 goroutine 需通过 CurrentXray 读取
 	XrayInstance *xray.XrayInstance
+	localProxy   *url.URL     // 替换实例时记录的本地代理地址，供后台 goroutine 读取
+	xrayMu       sync.RWMutex // 保护 XrayInstance 和 localProxy 的替换
+
+	// 故障转移监控器 - 当前节点不可用时自动切换
+	FailoverMonitor *failover.Monitor
+	failoverSwitch  failover.SwitchFunc
+
+	// 订阅自动更新调度器 - 按各订阅的更新间隔自动刷新
+	SubscriptionScheduler *subscription.Scheduler
 
 	// 绑定数据 - 用于状态面板自动更新
 	ProxyStatusBinding binding.String // 代理状态文本
@@ -58,6 +73,11 @@ func NewAppState(cfg *config.Config, logger *logging.Logger) *AppState {
 	serverManager := server.NewServerManager(cfg)
 	subscriptionManager := subscription.NewSubscriptionManager(serverManager)
 	pingManager := ping.NewPingManager(serverManager)
+	pingManager.SetMode(cfg.PingMode)
+	pingManager.SetTestURL(cfg.PingTestURL)
+	pingManager.SetTimeout(time.Duration(cfg.PingTimeout) * time.Second)
+	pingManager.SetHistory(cfg.LatencyHistorySize, time.Duration(cfg.LatencyHistoryHours)*time.Hour)
+	pingManager.SetSpeedTest(cfg.SpeedTestURL, int64(cfg.SpeedTestMaxMB)<<20, time.Duration(cfg.SpeedTestSeconds)*time.Second)
 
 	// 创建绑定数据
 	proxyStatusBinding := binding.NewString()
@@ -78,6 +98,9 @@ func NewAppState(cfg *config.Config, logger *logging.Logger) *AppState {
 		SubscriptionLabelsBinding: subscriptionLabelsBinding,
 	}
 
+	// 订阅可设置为通过正在运行的本地代理获取
+	subscriptionManager.SetLocalProxy(appState.LocalProxyURL)
+
 	// 注意：不在构造函数中初始化绑定数据
 	// 绑定数据需要在 Fyne 应用初始化后才能使用
 	// 将在 InitApp() 之后初始化
@@ -100,6 +123,13 @@ func (a *AppState) LoadServersFromDB() {
 
 	// 同步选中服务器ID
 	a.SelectedServerID = a.Config.SelectedServerID
+
+	// 按保留策略清理过期的延迟历史
+	if a.PingManager != nil {
+		if _, err := a.PingManager.PruneHistory(); err != nil && a.Logger != nil {
+			a.Logger.Error("清理延迟历史失败: %v", err)
+		}
+	}
 }
 
 // updateStatusBindings 更新状态绑定数据
@@ -119,14 +149,16 @@ func (a *AppState) updateStatusBindings() {
 			// 如果实例中没有端口，从配置中获取
 			proxyPort = a.Config.AutoProxyPort
 		} else {
-			proxyPort = 10080 // 默认端口
+			proxyPort = config.DefaultProxyPort // 默认端口
 		}
 	}
 
 	if isRunning {
 		// 与 UI 设计规范保持一致的文案：当前连接状态 + 已连接
 		a.ProxyStatusBinding.Set("当前连接状态: 🟢 已连接")
-		if proxyPort > 0 {
+		if proxyPort > 0 && a.XrayInstance.GetHTTPPort() > 0 {
+			a.PortBinding.Set(fmt.Sprintf("监听端口: %d (HTTP: %d)", proxyPort, a.XrayInstance.GetHTTPPort()))
+		} else if proxyPort > 0 {
 			a.PortBinding.Set(fmt.Sprintf("监听端口: %d", proxyPort))
 		} else {
 			a.PortBinding.Set("监听端口: -")
@@ -138,7 +170,10 @@ func (a *AppState) updateStatusBindings() {
 	}
 
 	// 更新当前服务器（符合 UI.md 设计：🌐 节点: US - LA - 32ms）
-	if a.ServerManager != nil && a.SelectedServerID != "" {
+	// 负载均衡模式下显示负载均衡器当前优先选择的节点
+	if isRunning && a.Config != nil && a.Config.BalancerEnabled {
+		a.ServerNameBinding.Set(a.BalancerTargetText())
+	} else if a.ServerManager != nil && a.SelectedServerID != "" {
 		server, err := a.ServerManager.GetServer(a.SelectedServerID)
 		if err == nil && server != nil {
 			// 使用节点名称，格式更简洁
@@ -244,6 +279,143 @@ func (a *AppState) AppendLog(level, logType, message string) {
 	}
 }
 
+// CurrentXray 返回当前的 xray 实例（可能为 nil），可在后台 goroutine 中调用
+func (a *AppState) CurrentXray() *xray.XrayInstance {
+	a.xrayMu.RLock()
+	defer a.xrayMu.RUnlock()
+	return a.XrayInstance
+}
+
+// SetXrayInstance 替换当前的 xray 实例（nil 表示代理已停止），需在 UI 线程调用
+func (a *AppState) SetXrayInstance(xi *xray.XrayInstance) {
+	proxyURL := a.buildLocalProxyURL(xi)
+	a.xrayMu.Lock()
+	defer a.xrayMu.Unlock()
+	a.XrayInstance = xi
+	a.localProxy = proxyURL
+}
+
+// LocalProxyURL 返回正在运行的本地 SOCKS5 代理地址，代理未运行时返回 nil，可在任意 goroutine 调用
+func (a *AppState) LocalProxyURL() *url.URL {
+	a.xrayMu.RLock()
+	defer a.xrayMu.RUnlock()
+	if a.localProxy == nil || a.XrayInstance == nil || !a.XrayInstance.IsRunning() {
+		return nil
+	}
+	proxyURL := *a.localProxy
+	return &proxyURL
+}
+
+// buildLocalProxyURL 根据实例端口和当前配置生成本地代理地址，启用入站认证时使用第一个账户
+func (a *AppState) buildLocalProxyURL(xi *xray.XrayInstance) *url.URL {
+	if xi == nil || xi.GetPort() <= 0 {
+		return nil
+	}
+	// 监听所有地址时通过本机回环地址连接
+	host := config.DefaultListenAddr
+	proxyURL := &url.URL{Scheme: "socks5"}
+	if a.Config != nil {
+		if addr := a.Config.GetListenAddr(); addr != "0.0.0.0" && addr != "::" {
+			host = addr
+		}
+		if len(a.Config.InboundAccounts) > 0 {
+			account := a.Config.InboundAccounts[0]
+			proxyURL.User = url.UserPassword(account.User, account.Pass)
+		}
+	}
+	proxyURL.Host = net.JoinHostPort(host, strconv.Itoa(xi.GetPort()))
+	return proxyURL
+}
+
+// BalancerTargetText 返回负载均衡器当前优先节点的显示文本
+func (a *AppState) BalancerTargetText() string {
+	xi := a.CurrentXray()
+	if xi == nil || !xi.IsRunning() {
+		return "🌐 负载均衡: -"
+	}
+	targetID, err := xi.GetBalancerTarget()
+	if err != nil {
+		return "🌐 负载均衡: 检测中"
+	}
+	if a.ServerManager != nil {
+		if server, err := a.ServerManager.GetServer(targetID); err == nil && server != nil {
+			return fmt.Sprintf("🌐 负载均衡: %s", server.Name)
+		}
+	}
+	return fmt.Sprintf("🌐 负载均衡: %s", targetID)
+}
+
+// SetFailoverSwitcher 设置故障转移时用于切换节点的回调（由服务器列表面板提供，需在 UI 线程执行）
+func (a *AppState) SetFailoverSwitcher(switchTo failover.SwitchFunc) {
+	a.failoverSwitch = switchTo
+}
+
+// StartFailoverMonitor 根据当前配置（重新）启动故障转移监控。
+// 未启用故障转移或启用了负载均衡时只停止已有监控。
+func (a *AppState) StartFailoverMonitor() {
+	if a.FailoverMonitor != nil {
+		a.FailoverMonitor.Stop()
+		a.FailoverMonitor = nil
+	}
+	if a.Config == nil || !a.Config.FailoverEnabled || a.Config.BalancerEnabled || a.failoverSwitch == nil {
+		return
+	}
+
+	getProber := func() failover.Prober {
+		xi := a.CurrentXray()
+		if xi == nil {
+			return nil
+		}
+		return xi
+	}
+	switchTo := func(srv *config.Server) error {
+		var err error
+		fyne.DoAndWait(func() {
+			err = a.failoverSwitch(srv)
+		})
+		return err
+	}
+
+	a.FailoverMonitor = failover.NewMonitor(a.ServerManager, a.Logger, getProber, switchTo, failover.OptionsFromConfig(a.Config))
+	a.FailoverMonitor.Start()
+}
+
+// StartSubscriptionScheduler （重新）启动订阅自动更新调度，每次自动更新后刷新服务器列表和订阅显示。
+func (a *AppState) StartSubscriptionScheduler() {
+	if a.SubscriptionScheduler != nil {
+		a.SubscriptionScheduler.Stop()
+		a.SubscriptionScheduler = nil
+	}
+	if a.SubscriptionManager == nil {
+		return
+	}
+
+	onUpdate := func(sub *database.Subscription, diff *subscription.SubscriptionDiff, err error) {
+		fyne.Do(func() {
+			a.LoadServersFromDB()
+			if a.MainWindow != nil {
+				a.MainWindow.Refresh()
+				if a.MainWindow.subscriptionPageInstance != nil {
+					a.MainWindow.subscriptionPageInstance.Refresh()
+				}
+			}
+		})
+	}
+
+	a.SubscriptionScheduler = subscription.NewScheduler(a.SubscriptionManager, a.Logger, onUpdate)
+	a.SubscriptionScheduler.Start()
+}
+
+// SaveConfigToDB 保存应用配置到数据库（统一配置保存），失败时记录错误日志
+func (a *AppState) SaveConfigToDB() {
+	if a.Config == nil {
+		return
+	}
+	if err := database.SaveAppSettings(a.Config); err != nil && a.Logger != nil {
+		a.Logger.Error("保存配置到数据库失败: %v", err)
+	}
+}
+
 // LoadWindowSize 从数据库加载窗口大小，如果不存在则返回默认值
 // 参数：
 //   - defaultSize: 默认窗口大小
@@ -7,7 +7,6 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
-	"fyne.io/fyne/v2/widget"
 	"myproxy.com/p/internal/database"
 )
 
@@ -37,6 +36,7 @@ type MainWindow struct {
 	serverListPanel   *ServerListPanel
 	logsPanel         *LogsPanel
 	statusPanel       *StatusPanel
+	settingsPanel     *SettingsPanel
 	mainSplit         *container.Split // 主分割容器（服务器列表和日志，保留用于日志面板独立窗口等场景）
 	layoutConfig      *LayoutConfig    // 布局配置
 
@@ -67,10 +67,15 @@ func NewMainWindow(appState *AppState) *MainWindow {
 	mw.serverListPanel = NewServerListPanel(appState)
 	mw.logsPanel = NewLogsPanel(appState)
 	mw.statusPanel = NewStatusPanel(appState)
+	mw.settingsPanel = NewSettingsPanel(appState)
 
 	// 设置状态面板引用，以便服务器列表可以刷新状态
 	mw.serverListPanel.SetStatusPanel(mw.statusPanel)
 
+	// 保存设置后，如果代理正在运行则使用新设置重启
+	mw.settingsPanel.SetOnApply(mw.serverListPanel.RestartProxy)
+	appState.SetFailoverSwitcher(mw.serverListPanel.SwitchToServer)
+
 	// 设置主窗口和日志面板引用到 AppState，以便其他组件可以刷新日志面板
 	appState.MainWindow = mw
 	appState.LogsPanel = mw.logsPanel
@@ -269,9 +274,8 @@ func (mw *MainWindow) buildSettingsPage() fyne.CanvasObject {
 		layout.NewSpacer(),
 	))
 
-	// 这里暂时使用占位内容，后续可以替换为真正的设置视图
-	placeholder := widget.NewLabel("设置界面开发中（Settings View Placeholder）")
-	center := container.NewCenter(placeholder)
+	// 设置内容：左侧导航 + 右侧内容区
+	center := container.NewPadded(mw.settingsPanel.Build())
 
 	return container.NewBorder(
 		headerBar,
@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/subscription"
+)
+
+// shareQRCodeSize 分享二维码的边长（像素）
+const shareQRCodeSize = 320
+
+// copyShareLink 将服务器的分享链接复制到剪贴板
+func copyShareLink(appState *AppState, srv config.Server) {
+	if appState == nil || appState.Window == nil {
+		return
+	}
+	link, err := subscription.ShareLink(&srv)
+	if err != nil {
+		dialog.ShowError(err, appState.Window)
+		return
+	}
+	appState.Window.Clipboard().SetContent(link)
+	appState.Window.SetTitle("分享链接已复制到剪贴板")
+}
+
+// showShareQRCode 显示服务器分享链接的二维码
+func showShareQRCode(appState *AppState, srv config.Server) {
+	if appState == nil || appState.Window == nil {
+		return
+	}
+	link, err := subscription.ShareLink(&srv)
+	if err != nil {
+		dialog.ShowError(err, appState.Window)
+		return
+	}
+	img, err := subscription.EncodeQRCode(link, shareQRCodeSize)
+	if err != nil {
+		dialog.ShowError(err, appState.Window)
+		return
+	}
+
+	qr := canvas.NewImageFromImage(img)
+	qr.FillMode = canvas.ImageFillContain
+	qr.SetMinSize(fyne.NewSize(shareQRCodeSize, shareQRCodeSize))
+	copyBtn := widget.NewButton("复制链接", func() {
+		appState.Window.Clipboard().SetContent(link)
+	})
+	content := container.NewBorder(nil, container.NewCenter(copyBtn), nil, nil, qr)
+	dialog.ShowCustom(srv.Name, "关闭", content, appState.Window)
+}
+
+// showExportServersDialog 将服务器导出为 Base64 订阅内容，可复制到剪贴板或保存为文件
+func showExportServersDialog(appState *AppState, servers []config.Server) {
+	if appState == nil || appState.Window == nil {
+		return
+	}
+	body, skipped, err := subscription.ExportSubscription(servers)
+	if err != nil {
+		dialog.ShowError(err, appState.Window)
+		return
+	}
+	exported := len(servers) - len(skipped)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 个节点将导出为 Base64 订阅内容", exported)
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "\n以下 %d 个节点的协议不支持导出，已跳过:", len(skipped))
+		for _, s := range skipped {
+			fmt.Fprintf(&b, "\n  %s [%s]", s.Name, s.ProtocolType)
+		}
+	}
+	info := widget.NewLabel(b.String())
+	info.Wrapping = fyne.TextWrapWord
+
+	var d dialog.Dialog
+	copyBtn := widget.NewButton("复制到剪贴板", func() {
+		appState.Window.Clipboard().SetContent(body)
+		appState.Window.SetTitle(fmt.Sprintf("已复制 %d 个节点的订阅内容", exported))
+		d.Hide()
+	})
+	copyBtn.Importance = widget.HighImportance
+	saveBtn := widget.NewButton("保存为文件…", func() {
+		save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, appState.Window)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if _, err := writer.Write([]byte(body)); err != nil {
+				dialog.ShowError(fmt.Errorf("保存订阅文件失败: %w", err), appState.Window)
+				return
+			}
+			if appState.Logger != nil {
+				appState.Logger.InfoWithType(logging.LogTypeApp, "已导出 %d 个节点到 %s", exported, writer.URI().Path())
+			}
+			d.Hide()
+		}, appState.Window)
+		save.SetFileName("subscription.txt")
+		save.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+		save.Show()
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(copyBtn, saveBtn), nil, nil, container.NewVScroll(info))
+	d = dialog.NewCustom("导出节点", "取消", content, appState.Window)
+	d.Resize(fyne.NewSize(420, 260))
+	d.Show()
+}
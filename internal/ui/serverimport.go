@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/subscription"
+)
+
+// importFileExtensions 导入节点时可选择的文件类型
+var importFileExtensions = []string{".png", ".jpg", ".jpeg", ".txt", ".yaml", ".yml", ".json", ".conf"}
+
+// showImportServersDialog 显示导入节点对话框：粘贴分享链接，或选择订阅文件、二维码图片。
+// 剪贴板中有分享链接时自动填入。导入的节点保存为手动服务器，完成后调用 onDone。
+func showImportServersDialog(appState *AppState, onDone func()) {
+	if appState == nil || appState.Window == nil || appState.SubscriptionManager == nil {
+		return
+	}
+
+	textEntry := widget.NewMultiLineEntry()
+	textEntry.SetPlaceHolder("粘贴一个或多个分享链接（vmess://、vless://、ss://、trojan://、socks5://），\n也可以是 Base64、Clash YAML 等订阅内容")
+	textEntry.SetMinRowsVisible(6)
+	textEntry.Wrapping = fyne.TextWrapBreak
+	if clip := appState.Window.Clipboard().Content(); strings.Contains(clip, "://") {
+		textEntry.SetText(clip)
+	}
+
+	var d dialog.Dialog
+	fileBtn := widget.NewButtonWithIcon("从文件或二维码图片导入…", theme.FolderOpenIcon(), func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, appState.Window)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			path := reader.URI().Path()
+			reader.Close()
+			d.Hide()
+			runImportServers(appState, onDone, func(sm *subscription.SubscriptionManager) (*subscription.ImportResult, error) {
+				return sm.ImportFile(path)
+			})
+		}, appState.Window)
+		open.SetFilter(storage.NewExtensionFileFilter(importFileExtensions))
+		open.Show()
+	})
+
+	content := container.NewBorder(nil, fileBtn, nil, nil, textEntry)
+	d = dialog.NewCustomConfirm("导入节点", "导入", "取消", content, func(ok bool) {
+		text := textEntry.Text
+		if !ok || strings.TrimSpace(text) == "" {
+			return
+		}
+		runImportServers(appState, onDone, func(sm *subscription.SubscriptionManager) (*subscription.ImportResult, error) {
+			return sm.ImportText(text)
+		})
+	}, appState.Window)
+	d.Resize(fyne.NewSize(520, 360))
+	d.Show()
+}
+
+// runImportServers 在后台执行导入并显示结果
+func runImportServers(appState *AppState, onDone func(), importFn func(sm *subscription.SubscriptionManager) (*subscription.ImportResult, error)) {
+	progress := dialog.NewCustomWithoutButtons("导入节点", widget.NewProgressBarInfinite(), appState.Window)
+	progress.Show()
+	go func() {
+		result, err := importFn(appState.SubscriptionManager)
+		fyne.Do(func() {
+			progress.Hide()
+			if err != nil {
+				if appState.Logger != nil {
+					appState.Logger.Error("导入节点失败: %v", err)
+				}
+				dialog.ShowError(fmt.Errorf("导入节点失败: %w", err), appState.Window)
+				return
+			}
+			if appState.Logger != nil {
+				appState.Logger.InfoWithType(logging.LogTypeApp, "导入节点完成，%s", result.Summary())
+			}
+			if onDone != nil {
+				onDone()
+			}
+
+			var b strings.Builder
+			b.WriteString(result.Summary())
+			for _, s := range result.Added {
+				fmt.Fprintf(&b, "\n  + %s [%s]", s.Name, s.ProtocolType)
+			}
+			for _, s := range result.Existing {
+				fmt.Fprintf(&b, "\n  = %s", s.Name)
+			}
+			if result.Report != nil {
+				for _, r := range result.Report.Rejected {
+					fmt.Fprintf(&b, "\n  ✗ 第 %d 条：%s", r.Line, r.Error)
+				}
+			}
+			detail := widget.NewLabel(b.String())
+			detail.Wrapping = fyne.TextWrapWord
+			scroll := container.NewVScroll(detail)
+			scroll.SetMinSize(fyne.NewSize(400, 200))
+			dialog.ShowCustom("导入结果", "确定", scroll, appState.Window)
+		})
+	}()
+}
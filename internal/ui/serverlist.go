@@ -1,17 +1,20 @@
 package ui
 
 import (
+	"context"
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"myproxy.com/p/internal/config"
-	"myproxy.com/p/internal/database"
 	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/ping"
 	"myproxy.com/p/internal/xray"
 )
 
@@ -26,8 +29,35 @@ type ServerListPanel struct {
 	// 搜索与过滤相关
 	searchEntry *widget.Entry // 节点搜索输入框
 	searchText  string        // 当前搜索关键字（小写）
+
+	// 一键测速相关（仅在 UI 线程访问）
+	testAllBtn *widget.Button     // 一键测速按钮，测速中显示为“取消”
+	testCancel context.CancelFunc // 取消正在进行的一键测速，为 nil 表示未在测速
+
+	// 下载测速相关（仅在 UI 线程访问）
+	speedAllBtn *widget.Button     // 下载测速按钮，测速中显示为“取消”
+	speedCancel context.CancelFunc // 取消正在进行的下载测速，为 nil 表示未在测速
+
+	// 排序与延迟统计（仅在 UI 线程访问）
+	sortMode      string                // 当前排序方式
+	stats         map[string]ping.Stats // 延迟统计缓存
+	statsLoadedAt time.Time             // 延迟统计缓存的加载时间
 }
 
+// 服务器列表排序方式
+const (
+	SortDefault     = "默认排序"
+	SortDelay       = "最近延迟"
+	SortMedian      = "延迟中位数"
+	SortP95         = "P95 延迟"
+	SortJitter      = "抖动"
+	SortSuccessRate = "成功率"
+	SortSpeed       = "下载速度"
+)
+
+// statsCacheTTL 延迟统计缓存的有效期，避免批量测速时每刷新一次就查询一次数据库
+const statsCacheTTL = 2 * time.Second
+
 // NewServerListPanel 创建并初始化服务器列表面板。
 // 该方法会创建服务器列表组件并设置选中事件处理。
 // 参数：
@@ -74,6 +104,8 @@ func (slp *ServerListPanel) SetStatusPanel(statusPanel *StatusPanel) {
 				slp.StartProxyForSelected()
 			}
 		})
+		// 路由模式切换后，如果代理正在运行，使用新配置重启代理
+		slp.statusPanel.SetRoutingModeHandler(slp.RestartProxy)
 	}
 }
 
@@ -88,7 +120,10 @@ func (slp *ServerListPanel) Build() fyne.CanvasObject {
 	})
 
 	// 操作按钮 - 一键测速（符合 UI.md 设计）
-	testAllBtn := NewStyledButton("测速", theme.ViewRefreshIcon(), slp.onTestAll)
+	slp.testAllBtn = NewStyledButton("测速", theme.ViewRefreshIcon(), slp.onTestAll)
+
+	// 下载测速：依次测试全部启用节点的下载速度
+	slp.speedAllBtn = NewStyledButton("下载测速", theme.DownloadIcon(), slp.onSpeedTestAll)
 
 	// 收藏按钮（显示收藏节点）
 	favoriteBtn := NewStyledButton("收藏", nil, func() {
@@ -106,6 +141,11 @@ func (slp *ServerListPanel) Build() fyne.CanvasObject {
 		}
 	})
 
+	// 导出按钮：将当前列表中的节点导出为 Base64 订阅
+	exportBtn := NewStyledButton("导出", theme.UploadIcon(), func() {
+		showExportServersDialog(slp.appState, slp.getFilteredServers())
+	})
+
 	// 刷新按钮
 	refreshBtn := NewStyledButton("刷新", theme.ViewRefreshIcon(), func() {
 		if slp.appState != nil && slp.appState.ServerManager != nil {
@@ -135,8 +175,10 @@ func (slp *ServerListPanel) Build() fyne.CanvasObject {
 		slp.searchEntry,        // 搜索框自适应剩余空间
 		NewSpacer(SpacingLarge), // 间距
 		favoriteBtn,            // 收藏按钮
-		testAllBtn,             // 一键测速按钮
+		slp.testAllBtn,          // 一键测速按钮
+		slp.speedAllBtn,         // 下载测速按钮
 		subscriptionBtn,        // 订阅管理按钮
+		exportBtn,              // 导出按钮
 		refreshBtn,             // 刷新按钮
 	))
 
@@ -146,6 +188,10 @@ func (slp *ServerListPanel) Build() fyne.CanvasObject {
 	// 分组标题
 	allNodesHeader := NewSubtitleLabel("🌍 所有节点 (All Nodes)")
 
+	// 排序方式：按最近延迟或延迟历史统计排序
+	sortSelect := widget.NewSelect([]string{SortDefault, SortDelay, SortMedian, SortP95, SortJitter, SortSuccessRate, SortSpeed}, slp.SetSortMode)
+	sortSelect.SetSelected(SortDefault)
+
 	// 服务器列表滚动区域
 	serverScroll := container.NewScroll(slp.serverList)
 
@@ -153,7 +199,7 @@ func (slp *ServerListPanel) Build() fyne.CanvasObject {
 	// 顶部固定内容：分组标题 + 分隔符 + 列标题 + 分隔符
 	topContent := container.NewVBox(
 		// TODO: 未来在这里插入真正的“收藏”节点列表
-		allNodesHeader,
+		container.NewBorder(nil, nil, allNodesHeader, sortSelect),
 		NewSeparator(),
 		columnHeaders,
 		NewSeparator(),
@@ -237,7 +283,7 @@ func (slp *ServerListPanel) getFilteredServers() []config.Server {
 	servers := slp.appState.ServerManager.ListServers()
 	// 如果没有搜索关键字，直接返回完整列表
 	if slp.searchText == "" {
-		return servers
+		return slp.sortServers(servers)
 	}
 
 	filtered := make([]config.Server, 0, len(servers))
@@ -252,7 +298,75 @@ func (slp *ServerListPanel) getFilteredServers() []config.Server {
 			filtered = append(filtered, s)
 		}
 	}
-	return filtered
+	return slp.sortServers(filtered)
+}
+
+// latencyStats 返回延迟统计（带短时缓存），查询失败时返回上一次的结果
+func (slp *ServerListPanel) latencyStats() map[string]ping.Stats {
+	if slp.appState == nil || slp.appState.PingManager == nil {
+		return nil
+	}
+	if slp.stats != nil && time.Since(slp.statsLoadedAt) < statsCacheTTL {
+		return slp.stats
+	}
+	stats, err := slp.appState.PingManager.GetAllStats()
+	if err != nil {
+		if slp.appState.Logger != nil {
+			slp.appState.Logger.Error("获取延迟统计失败: %v", err)
+		}
+		return slp.stats
+	}
+	slp.stats = stats
+	slp.statsLoadedAt = time.Now()
+	return stats
+}
+
+// sortServers 按当前排序方式排序服务器列表（不修改传入的切片）。
+// 没有对应数据的服务器排在最后；成功率和下载速度从高到低，其他指标从低到高。
+func (slp *ServerListPanel) sortServers(servers []config.Server) []config.Server {
+	if slp.sortMode == "" || slp.sortMode == SortDefault {
+		return servers
+	}
+
+	stats := slp.latencyStats()
+	// metric 返回排序值和是否有数据
+	metric := func(s config.Server) (float64, bool) {
+		st, ok := stats[s.ID]
+		switch slp.sortMode {
+		case SortDelay:
+			return float64(s.Delay), s.Delay > 0
+		case SortMedian:
+			return float64(st.Median), ok && st.Median >= 0
+		case SortP95:
+			return float64(st.P95), ok && st.P95 >= 0
+		case SortJitter:
+			return float64(st.Jitter), ok && st.Successes > 1
+		case SortSuccessRate:
+			return -st.SuccessRate, ok && st.Samples > 0
+		case SortSpeed:
+			return -s.SpeedMbps, s.SpeedMbps > 0
+		}
+		return 0, false
+	}
+
+	sorted := make([]config.Server, len(servers))
+	copy(sorted, servers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		vi, oki := metric(sorted[i])
+		vj, okj := metric(sorted[j])
+		if oki != okj {
+			return oki
+		}
+		return oki && vi < vj
+	})
+	return sorted
+}
+
+// SetSortMode 设置服务器列表的排序方式并刷新列表
+func (slp *ServerListPanel) SetSortMode(mode string) {
+	slp.sortMode = mode
+	slp.stats = nil // 切换排序时重新加载统计
+	slp.Refresh()
 }
 
 // createServerItem 创建服务器列表项
@@ -318,12 +432,25 @@ func (slp *ServerListPanel) onRightClick(id widget.ListItemID, ev *fyne.PointEve
 		fyne.NewMenuItem("测速", func() {
 			slp.onTestSpeed(id)
 		}),
+		fyne.NewMenuItem("下载测速", func() {
+			slp.onSpeedTest([]config.Server{srv})
+		}),
 		fyne.NewMenuItem("启动代理", func() {
 			slp.onStartProxy(id)
 		}),
 		fyne.NewMenuItem("停止代理", func() {
 			slp.onStopProxy()
 		}),
+		fyne.NewMenuItem("设置前置节点", func() {
+			slp.onSetUpstream(srv)
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("复制链接", func() {
+			copyShareLink(slp.appState, srv)
+		}),
+		fyne.NewMenuItem("显示二维码", func() {
+			showShareQRCode(slp.appState, srv)
+		}),
 	)
 
 	// 显示菜单
@@ -401,23 +528,17 @@ func (slp *ServerListPanel) onStartProxyFromSelected() {
 		return
 	}
 
-	// 如果已有代理在运行，先停止
-	if slp.appState.XrayInstance != nil {
-		slp.appState.XrayInstance.Stop()
-		slp.appState.XrayInstance = nil
-	}
-
 	// 把当前的设置为选中
 	slp.appState.ServerManager.SelectServer(srv.ID)
 	slp.appState.SelectedServerID = srv.ID
 
-	// 启动代理
-	slp.startProxyWithServer(srv)
+	// 切换或启动代理
+	slp.switchProxyServer(srv)
 }
 
 // onStartProxy 启动代理（右键菜单使用）
 func (slp *ServerListPanel) onStartProxy(id widget.ListItemID) {
-	servers := slp.appState.ServerManager.ListServers()
+	servers := slp.getFilteredServers()
 	if id < 0 || id >= len(servers) {
 		return
 	}
@@ -426,35 +547,240 @@ func (slp *ServerListPanel) onStartProxy(id widget.ListItemID) {
 	slp.appState.ServerManager.SelectServer(srv.ID)
 	slp.appState.SelectedServerID = srv.ID
 
+	// 切换或启动代理
+	slp.switchProxyServer(&srv)
+}
+
+// switchProxyServer 切换到指定服务器。
+// 代理运行中时优先原地替换出站（不中断入站监听和直连连接），失败时回退为完整重启。
+func (slp *ServerListPanel) switchProxyServer(srv *config.Server) {
+	if slp.appState.XrayInstance != nil && slp.appState.XrayInstance.IsRunning() {
+		err := slp.appState.XrayInstance.SwapOutbound(srv)
+		if err == nil {
+			proxyPort := slp.appState.XrayInstance.GetPort()
+			if slp.appState.Logger != nil {
+				slp.appState.Logger.InfoWithType(logging.LogTypeProxy, "已切换节点: %s (端口: %d)", srv.Name, proxyPort)
+			}
+			slp.appState.AppendLog("INFO", "xray", fmt.Sprintf("已切换节点: %s (端口: %d)", srv.Name, proxyPort))
+
+			slp.Refresh()
+			slp.appState.UpdateProxyStatus()
+			slp.appState.Window.SetTitle(fmt.Sprintf("代理已切换: %s (端口: %d)", srv.Name, proxyPort))
+			return
+		}
+
+		// 原地切换失败，回退为完整重启
+		slp.appState.AppendLog("WARN", "xray", fmt.Sprintf("原地切换节点失败，将重启代理: %v", err))
+	}
+
 	// 如果已有代理在运行，先停止
 	if slp.appState.XrayInstance != nil {
 		slp.appState.XrayInstance.Stop()
-		slp.appState.XrayInstance = nil
+		slp.appState.SetXrayInstance(nil)
 	}
 
 	// 启动代理
-	slp.startProxyWithServer(&srv)
+	slp.startProxyWithServer(srv)
+}
+
+// chainText 返回服务器的链式代理显示文本，如 "入口 → 中转 → 落地"；没有前置节点时返回服务器名称
+func (slp *ServerListPanel) chainText(srv config.Server) string {
+	if srv.UpstreamID == "" || slp.appState == nil || slp.appState.ServerManager == nil {
+		return srv.Name
+	}
+	chain, err := slp.appState.ServerManager.ResolveChain(srv.ID)
+	if err != nil {
+		return srv.Name + " (前置节点无效)"
+	}
+	names := make([]string, 0, len(chain)+1)
+	for i := len(chain) - 1; i >= 0; i-- {
+		names = append(names, chain[i].Name)
+	}
+	names = append(names, srv.Name)
+	return strings.Join(names, " → ")
+}
+
+// onSetUpstream 为服务器选择前置节点（链式代理）
+func (slp *ServerListPanel) onSetUpstream(srv config.Server) {
+	if slp.appState == nil || slp.appState.Window == nil {
+		return
+	}
+
+	const noneOption = "无（直接连接）"
+	options := []string{noneOption}
+	optionIDs := map[string]string{noneOption: ""}
+	selected := noneOption
+	for _, s := range slp.appState.ServerManager.ListServers() {
+		if s.ID == srv.ID {
+			continue
+		}
+		// 名称可能重复，附加地址以便区分
+		option := fmt.Sprintf("%s (%s:%d)", s.Name, s.Addr, s.Port)
+		options = append(options, option)
+		optionIDs[option] = s.ID
+		if s.ID == srv.UpstreamID {
+			selected = option
+		}
+	}
+
+	upstreamSelect := widget.NewSelect(options, nil)
+	upstreamSelect.SetSelected(selected)
+	items := []*widget.FormItem{
+		{Text: "前置节点", Widget: upstreamSelect},
+	}
+
+	dialog.ShowForm(fmt.Sprintf("设置前置节点: %s", srv.Name), "确认", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		upstreamID := optionIDs[upstreamSelect.Selected]
+		if err := slp.appState.ServerManager.SetServerUpstream(srv.ID, upstreamID); err != nil {
+			slp.logAndShowError("设置前置节点失败", err)
+			dialog.ShowError(err, slp.appState.Window)
+			return
+		}
+
+		updated, _ := slp.appState.ServerManager.GetServer(srv.ID)
+		message := fmt.Sprintf("节点 %s 已改为直接连接", srv.Name)
+		if upstreamID != "" && updated != nil {
+			message = fmt.Sprintf("已设置链式代理: %s", slp.chainText(*updated))
+		}
+		slp.appState.AppendLog("INFO", "app", message)
+		if slp.appState.Logger != nil {
+			slp.appState.Logger.InfoWithType(logging.LogTypeApp, "%s", message)
+		}
+		slp.Refresh()
+
+		// 修改影响当前运行的代理时重启以生效
+		if slp.usesServer(srv.ID) {
+			slp.RestartProxy()
+		}
+	}, slp.appState.Window)
+}
+
+// usesServer 判断当前运行的代理是否使用了指定服务器（作为当前节点、负载均衡节点或前置节点）
+func (slp *ServerListPanel) usesServer(id string) bool {
+	if xi := slp.appState.CurrentXray(); xi == nil || !xi.IsRunning() {
+		return false
+	}
+	if slp.appState.Config.BalancerEnabled {
+		return true
+	}
+	if slp.appState.SelectedServerID == id {
+		return true
+	}
+	chain, _ := slp.appState.ServerManager.ResolveChain(slp.appState.SelectedServerID)
+	for _, hop := range chain {
+		if hop.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchToServer 选中并切换到指定服务器（供自动故障转移使用），需在 UI 线程调用。
+// 返回：切换后代理未运行时返回错误
+func (slp *ServerListPanel) SwitchToServer(srv *config.Server) error {
+	if err := slp.appState.ServerManager.SelectServer(srv.ID); err != nil {
+		return err
+	}
+	slp.appState.SelectedServerID = srv.ID
+
+	slp.switchProxyServer(srv)
+
+	if slp.appState.XrayInstance == nil || !slp.appState.XrayInstance.IsRunning() {
+		return fmt.Errorf("代理未能使用节点 %s 启动", srv.Name)
+	}
+	return nil
+}
+
+// RestartProxy 使用当前配置完整重启代理（用于路由模式等需要重建配置的变更）。
+// 代理未运行时不做任何操作。
+func (slp *ServerListPanel) RestartProxy() {
+	if slp.appState == nil || slp.appState.XrayInstance == nil || !slp.appState.XrayInstance.IsRunning() {
+		return
+	}
+	slp.appState.XrayInstance.Stop()
+	slp.appState.SetXrayInstance(nil)
+	slp.StartProxyForSelected()
 }
 
 // startProxyWithServer 使用指定的服务器启动代理
 func (slp *ServerListPanel) startProxyWithServer(srv *config.Server) {
-	// 使用固定的10080端口监听本地SOCKS5
-	proxyPort := 10080
-
 	// 记录开始启动日志
 	if slp.appState != nil {
 		slp.appState.AppendLog("INFO", "xray", fmt.Sprintf("开始启动xray-core代理: %s", srv.Name))
 	}
 
+	// 检查监听端口是否可用（被占用时根据配置报错或自动选择空闲端口）
+	cfg := slp.appState.Config
+	listenAddr := cfg.GetListenAddr()
+	proxyPort, err := slp.resolvePort(listenAddr, cfg.GetProxyPort(), cfg.PortFallback)
+	if err != nil {
+		slp.logAndShowError("本地监听端口不可用", err)
+		slp.appState.Config.AutoProxyEnabled = false
+		slp.appState.UpdateProxyStatus()
+		slp.saveConfigToDB()
+		return
+	}
+	httpPort := 0
+	if cfg.HTTPPort > 0 && cfg.HTTPPort != proxyPort {
+		httpPort, err = slp.resolvePort(listenAddr, cfg.HTTPPort, cfg.PortFallback)
+		if err != nil {
+			slp.logAndShowError("HTTP 代理端口不可用", err)
+			slp.appState.Config.AutoProxyEnabled = false
+			slp.appState.UpdateProxyStatus()
+			slp.saveConfigToDB()
+			return
+		}
+	}
+
 	// 使用统一的日志文件路径（与应用日志使用同一个文件）
 	unifiedLogPath := slp.appState.Logger.GetLogFilePath()
 
+	// 服务器列表由后台测速等任务更新，使用副本解析前置节点链
+	allServers := slp.appState.ServerManager.ListServers()
+
 	// 创建xray配置，设置日志文件路径为统一日志文件
-	xrayConfigJSON, err := xray.CreateXrayConfig(proxyPort, srv, unifiedLogPath)
+	opts := xray.ConfigOptions{
+		RoutingMode:    cfg.RoutingMode,
+		ListenAddr:     listenAddr,
+		HTTPPort:       httpPort,
+		Accounts:       cfg.InboundAccounts,
+		AllowedSources: cfg.AllowedSources,
+		Servers:        allServers, // 用于解析前置节点链
+	}
+
+	// 负载均衡：使用当前订阅的全部启用节点，无法生成出站的节点跳过并记录日志
+	if cfg.BalancerEnabled {
+		var candidates []*config.Server
+		for _, s := range allServers {
+			if s.Enabled {
+				server := s
+				candidates = append(candidates, &server)
+			}
+		}
+		usable, skipped := xray.FilterBalancerServers(candidates, allServers)
+		for _, s := range skipped {
+			slp.appState.AppendLog("WARN", "xray", fmt.Sprintf("负载均衡跳过节点 %s: %v", s.Server.Name, s.Err))
+		}
+		if len(usable) == 0 {
+			slp.logAndShowError("创建xray配置失败", fmt.Errorf("没有可用于负载均衡的节点"))
+			slp.appState.Config.AutoProxyEnabled = false
+			slp.appState.SetXrayInstance(nil)
+			slp.appState.UpdateProxyStatus()
+			slp.saveConfigToDB()
+			return
+		}
+		opts.BalancerServers = usable
+		opts.BalancerStrategy = cfg.BalancerStrategy
+		slp.appState.AppendLog("INFO", "xray", fmt.Sprintf("负载均衡已启用: %d 个节点, 策略 %s", len(opts.BalancerServers), opts.BalancerStrategy))
+	}
+	xrayConfigJSON, err := xray.CreateXrayConfigWithOptions(proxyPort, srv, opts, unifiedLogPath)
 	if err != nil {
 		slp.logAndShowError("创建xray配置失败", err)
 		slp.appState.Config.AutoProxyEnabled = false
-		slp.appState.XrayInstance = nil
+		slp.appState.SetXrayInstance(nil)
 		slp.appState.UpdateProxyStatus()
 		slp.saveConfigToDB()
 		return
@@ -477,7 +803,7 @@ func (slp *ServerListPanel) startProxyWithServer(srv *config.Server) {
 	if err != nil {
 		slp.logAndShowError("创建xray实例失败", err)
 		slp.appState.Config.AutoProxyEnabled = false
-		slp.appState.XrayInstance = nil
+		slp.appState.SetXrayInstance(nil)
 		slp.appState.UpdateProxyStatus()
 		slp.saveConfigToDB()
 		return
@@ -486,19 +812,20 @@ func (slp *ServerListPanel) startProxyWithServer(srv *config.Server) {
 	// 启动xray实例
 	err = xrayInstance.Start()
 	if err != nil {
+		xrayInstance.Stop()
 		slp.logAndShowError("启动xray实例失败", err)
 		slp.appState.Config.AutoProxyEnabled = false
-		slp.appState.XrayInstance = nil
+		slp.appState.SetXrayInstance(nil)
 		slp.appState.UpdateProxyStatus()
 		slp.saveConfigToDB()
 		return
 	}
 
-	// 启动成功，设置端口信息
+	// 启动成功，设置端口信息（自动回退的端口只记录在实例上，不覆盖用户配置）
 	xrayInstance.SetPort(proxyPort)
-	slp.appState.XrayInstance = xrayInstance
+	xrayInstance.SetHTTPPort(httpPort)
+	slp.appState.SetXrayInstance(xrayInstance)
 	slp.appState.Config.AutoProxyEnabled = true
-	slp.appState.Config.AutoProxyPort = proxyPort
 
 	// 记录日志（统一日志记录）
 	if slp.appState.Logger != nil {
@@ -521,6 +848,22 @@ func (slp *ServerListPanel) startProxyWithServer(srv *config.Server) {
 	slp.saveConfigToDB()
 }
 
+// resolvePort 检查端口是否可用，被占用且允许回退时自动选择空闲端口并记录日志
+func (slp *ServerListPanel) resolvePort(listenAddr string, port int, fallback bool) (int, error) {
+	resolved, err := xray.ResolveListenPort(listenAddr, port, fallback)
+	if err != nil {
+		return 0, err
+	}
+	if resolved != port {
+		message := fmt.Sprintf("端口 %d 已被占用，自动改用空闲端口 %d", port, resolved)
+		slp.appState.AppendLog("WARN", "xray", message)
+		if slp.appState.Logger != nil {
+			slp.appState.Logger.InfoWithType(logging.LogTypeProxy, "%s", message)
+		}
+	}
+	return resolved, nil
+}
+
 // StartProxyForSelected 对外暴露的“启动当前选中服务器”接口，供主界面一键按钮等复用。
 // 内部直接复用现有 onStartProxyFromSelected 逻辑，避免重复实现。
 func (slp *ServerListPanel) StartProxyForSelected() {
@@ -542,13 +885,7 @@ func (slp *ServerListPanel) saveConfigToDB() {
 	if slp.appState == nil || slp.appState.Config == nil {
 		return
 	}
-	cfg := slp.appState.Config
-
-	// 保存配置到数据库
-	database.SetAppConfig("logLevel", cfg.LogLevel)
-	database.SetAppConfig("logFile", cfg.LogFile)
-	database.SetAppConfig("autoProxyEnabled", strconv.FormatBool(cfg.AutoProxyEnabled))
-	database.SetAppConfig("autoProxyPort", strconv.Itoa(cfg.AutoProxyPort))
+	slp.appState.SaveConfigToDB()
 }
 
 // onStopProxy 停止代理
@@ -568,7 +905,7 @@ func (slp *ServerListPanel) onStopProxy() {
 			return
 		}
 
-		slp.appState.XrayInstance = nil
+		slp.appState.SetXrayInstance(nil)
 		stopped = true
 
 		// 记录日志（统一日志记录）
@@ -585,7 +922,6 @@ func (slp *ServerListPanel) onStopProxy() {
 	if stopped {
 		// 停止成功
 		slp.appState.Config.AutoProxyEnabled = false
-		slp.appState.Config.AutoProxyPort = 0
 
 		// 更新状态绑定
 		slp.appState.UpdateProxyStatus()
@@ -605,62 +941,191 @@ func (slp *ServerListPanel) StopProxy() {
 	slp.onStopProxy()
 }
 
-// onTestAll 一键测延迟
+// onTestAll 一键测延迟；测速进行中再次点击则取消测速
 func (slp *ServerListPanel) onTestAll() {
-	// 在goroutine中执行测速
-	go func() {
-		servers := slp.appState.ServerManager.ListServers()
-		enabledCount := 0
-		for _, s := range servers {
-			if s.Enabled {
-				enabledCount++
-			}
-		}
+	if slp.testCancel != nil {
+		slp.testCancel()
+		return
+	}
 
-		// 记录开始测速日志
-		if slp.appState != nil {
-			slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("开始一键测速，共 %d 个启用的服务器", enabledCount))
+	var servers []config.Server
+	for _, s := range slp.appState.ServerManager.ListServers() {
+		if s.Enabled {
+			servers = append(servers, s)
 		}
+	}
+	if len(servers) == 0 {
+		slp.appState.Window.SetTitle("没有启用的服务器")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slp.testCancel = cancel
+	slp.setTestAllButton(true)
 
-		results := slp.appState.PingManager.TestAllServersDelay()
+	// 记录开始测速日志
+	slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("开始一键测速，共 %d 个启用的服务器", len(servers)))
 
-		// 统计结果并记录每个服务器的详细日志
+	opts := ping.BatchOptions{Concurrency: slp.appState.Config.PingConcurrency}
+	results := slp.appState.PingManager.TestServers(ctx, servers, opts)
+
+	// 在goroutine中接收结果，每完成一个服务器就刷新列表
+	go func() {
 		successCount := 0
 		failCount := 0
-		for _, srv := range servers {
-			if !srv.Enabled {
-				continue
-			}
-			delay, exists := results[srv.ID]
-			if !exists {
-				continue
-			}
-			if delay > 0 {
+		for result := range results {
+			srv := result.Server
+			if result.Err == nil {
 				successCount++
-				if slp.appState != nil {
-					slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("服务器 %s (%s:%d) 测速完成: %d ms", srv.Name, srv.Addr, srv.Port, delay))
-				}
+				slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("服务器 %s (%s:%d) 测速完成: %d ms", srv.Name, srv.Addr, srv.Port, result.Delay))
 			} else {
 				failCount++
-				if slp.appState != nil {
-					slp.appState.AppendLog("ERROR", "ping", fmt.Sprintf("服务器 %s (%s:%d) 测速失败", srv.Name, srv.Addr, srv.Port))
-				}
+				slp.appState.AppendLog("ERROR", "ping", fmt.Sprintf("服务器 %s (%s:%d) 测速失败: %v", srv.Name, srv.Addr, srv.Port, result.Err))
 			}
+
+			done := successCount + failCount
+			fyne.Do(func() {
+				slp.Refresh()
+				slp.appState.Window.SetTitle(fmt.Sprintf("测速中 %d/%d", done, len(servers)))
+			})
 		}
 
+		cancelled := ctx.Err() != nil
+		cancel()
+
 		// 记录完成日志
-		if slp.appState != nil {
-			slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("一键测速完成: 成功 %d 个，失败 %d 个，共测试 %d 个服务器", successCount, failCount, len(results)))
+		summary := fmt.Sprintf("成功 %d 个，失败 %d 个，共测试 %d 个服务器", successCount, failCount, successCount+failCount)
+		if cancelled {
+			slp.appState.AppendLog("WARN", "ping", "一键测速已取消: "+summary)
+		} else {
+			slp.appState.AppendLog("INFO", "ping", "一键测速完成: "+summary)
 		}
 
 		// 更新UI（需要在主线程中执行）
 		fyne.Do(func() {
+			slp.testCancel = nil
+			slp.setTestAllButton(false)
 			slp.Refresh()
-			slp.appState.Window.SetTitle(fmt.Sprintf("测速完成，共测试 %d 个服务器", len(results)))
+			if cancelled {
+				slp.appState.Window.SetTitle(fmt.Sprintf("测速已取消，已测试 %d 个服务器", successCount+failCount))
+			} else {
+				slp.appState.Window.SetTitle(fmt.Sprintf("测速完成，共测试 %d 个服务器", successCount+failCount))
+			}
+			slp.appState.UpdateProxyStatus()
 		})
 	}()
 }
 
+// onSpeedTestAll 下载测速全部启用的服务器，测速进行中再次点击则取消
+func (slp *ServerListPanel) onSpeedTestAll() {
+	if slp.speedCancel != nil {
+		slp.speedCancel()
+		return
+	}
+
+	var servers []config.Server
+	for _, s := range slp.appState.ServerManager.ListServers() {
+		if s.Enabled {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 {
+		slp.appState.Window.SetTitle("没有启用的服务器")
+		return
+	}
+	slp.onSpeedTest(servers)
+}
+
+// onSpeedTest 依次对服务器做下载测速，每完成一个服务器就刷新列表。
+// 同一时间只进行一轮下载测速，避免相互争抢带宽。
+func (slp *ServerListPanel) onSpeedTest(servers []config.Server) {
+	if slp.speedCancel != nil {
+		slp.appState.Window.SetTitle("下载测速进行中，请稍候")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slp.speedCancel = cancel
+	slp.setSpeedAllButton(true)
+
+	slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("开始下载测速，共 %d 个服务器", len(servers)))
+	results := slp.appState.PingManager.TestServersSpeed(ctx, servers)
+
+	go func() {
+		done := 0
+		for result := range results {
+			done++
+			srv := result.Server
+			if result.Err == nil {
+				slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("服务器 %s (%s:%d) 下载测速完成: %.1f Mbps（%d KB，%v）",
+					srv.Name, srv.Addr, srv.Port, result.Mbps, result.Bytes>>10, result.Elapsed.Round(time.Millisecond)))
+			} else {
+				slp.appState.AppendLog("ERROR", "ping", fmt.Sprintf("服务器 %s (%s:%d) 下载测速失败: %v", srv.Name, srv.Addr, srv.Port, result.Err))
+			}
+
+			count := done
+			fyne.Do(func() {
+				slp.Refresh()
+				if len(servers) == 1 {
+					if result.Err != nil {
+						slp.appState.Window.SetTitle(fmt.Sprintf("下载测速失败: %v", result.Err))
+					} else {
+						slp.appState.Window.SetTitle(fmt.Sprintf("下载测速完成: %.1f Mbps", result.Mbps))
+					}
+				} else {
+					slp.appState.Window.SetTitle(fmt.Sprintf("下载测速中 %d/%d", count, len(servers)))
+				}
+			})
+		}
+
+		cancelled := ctx.Err() != nil
+		cancel()
+		if cancelled {
+			slp.appState.AppendLog("WARN", "ping", fmt.Sprintf("下载测速已取消，已测试 %d 个服务器", done))
+		} else {
+			slp.appState.AppendLog("INFO", "ping", fmt.Sprintf("下载测速完成，共测试 %d 个服务器", done))
+		}
+
+		fyne.Do(func() {
+			slp.speedCancel = nil
+			slp.setSpeedAllButton(false)
+			if cancelled {
+				slp.appState.Window.SetTitle(fmt.Sprintf("下载测速已取消，已测试 %d 个服务器", done))
+			} else if len(servers) > 1 {
+				slp.appState.Window.SetTitle(fmt.Sprintf("下载测速完成，共测试 %d 个服务器", done))
+			}
+		})
+	}()
+}
+
+// setSpeedAllButton 根据是否正在测速切换下载测速按钮的文字和图标
+func (slp *ServerListPanel) setSpeedAllButton(testing bool) {
+	if slp.speedAllBtn == nil {
+		return
+	}
+	if testing {
+		slp.speedAllBtn.SetText("取消")
+		slp.speedAllBtn.SetIcon(theme.CancelIcon())
+	} else {
+		slp.speedAllBtn.SetText("下载测速")
+		slp.speedAllBtn.SetIcon(theme.DownloadIcon())
+	}
+}
+
+// setTestAllButton 根据是否正在测速切换一键测速按钮的文字和图标
+func (slp *ServerListPanel) setTestAllButton(testing bool) {
+	if slp.testAllBtn == nil {
+		return
+	}
+	if testing {
+		slp.testAllBtn.SetText("取消")
+		slp.testAllBtn.SetIcon(theme.CancelIcon())
+	} else {
+		slp.testAllBtn.SetText("测速")
+		slp.testAllBtn.SetIcon(theme.ViewRefreshIcon())
+	}
+}
+
 // ServerListItem 自定义服务器列表项（支持右键菜单和多列显示）
 type ServerListItem struct {
 	widget.BaseWidget
@@ -790,7 +1255,11 @@ func (s *ServerListItem) Update(server config.Server) {
 		} else {
 			s.nameLabel.Importance = widget.MediumImportance
 		}
-		s.nameLabel.SetText(prefix + server.Name)
+		displayName := server.Name
+		if s.panel != nil {
+			displayName = s.panel.chainText(server)
+		}
+		s.nameLabel.SetText(prefix + displayName)
 
 		// 延迟 - 根据延迟值设置重要性（颜色）
 		// 符合 UI.md 设计：< 100ms绿色(🟢)，100-200ms黄色(🟡)，> 200ms红色(🔴)
@@ -813,6 +1282,16 @@ func (s *ServerListItem) Update(server config.Server) {
 			delayText = "未测速"
 			s.delayLabel.Importance = widget.LowImportance
 		}
+		// 有多次测速记录且存在失败时，附加成功率，便于区分不稳定的节点
+		if s.panel != nil {
+			if st, ok := s.panel.latencyStats()[server.ID]; ok && st.Samples > 1 && st.Successes < st.Samples {
+				delayText = fmt.Sprintf("%s · %.0f%%", delayText, st.SuccessRate*100)
+			}
+		}
+		// 测过下载速度时一并显示
+		if server.SpeedMbps > 0 {
+			delayText = fmt.Sprintf("%s · %.1f Mbps", delayText, server.SpeedMbps)
+		}
 		s.delayLabel.SetText(delayText)
 
 		// 更新在线/离线状态图标
@@ -862,12 +1341,32 @@ func (s *ServerListItem) showQuickMenu(server config.Server) {
 				s.panel.onTestSpeed(s.id)
 			}
 		}),
+		fyne.NewMenuItem("下载测速", func() {
+			if s.panel != nil {
+				s.panel.onSpeedTest([]config.Server{server})
+			}
+		}),
+		fyne.NewMenuItem("设置前置节点", func() {
+			if s.panel != nil {
+				s.panel.onSetUpstream(server)
+			}
+		}),
 		fyne.NewMenuItem("收藏", func() {
 			// TODO: 实现收藏功能
 			if s.panel != nil && s.panel.appState != nil {
 				s.panel.appState.Window.SetTitle("收藏功能开发中")
 			}
 		}),
+		fyne.NewMenuItem("复制链接", func() {
+			if s.panel != nil {
+				copyShareLink(s.panel.appState, server)
+			}
+		}),
+		fyne.NewMenuItem("显示二维码", func() {
+			if s.panel != nil {
+				showShareQRCode(s.panel.appState, server)
+			}
+		}),
 		fyne.NewMenuItem("复制信息", func() {
 			// TODO: 实现复制节点信息功能
 			info := fmt.Sprintf("名称: %s\n地址: %s:%d\n协议: %s", 
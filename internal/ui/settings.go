@@ -0,0 +1,552 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/config"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/ping"
+	"myproxy.com/p/internal/xray"
+)
+
+// SettingsPanel 设置页面内容，采用左侧导航 + 右侧内容区的布局（符合 UI.md 设计）。
+type SettingsPanel struct {
+	appState *AppState
+	onApply  func() // 保存设置后的回调（用于在代理运行时重启代理）
+
+	// 连接设置
+	listenAddrEntry   *widget.SelectEntry
+	proxyPortEntry    *widget.Entry
+	httpPortEntry     *widget.Entry
+	portFallbackCheck *widget.Check
+
+	// 访问控制设置
+	accountsEntry *widget.Entry
+	sourcesEntry  *widget.Entry
+
+	// 负载均衡设置
+	balancerCheck  *widget.Check
+	strategySelect *widget.Select
+
+	// 故障转移设置
+	failoverCheck          *widget.Check
+	failoverIntervalEntry  *widget.Entry
+	failoverThresholdEntry *widget.Entry
+	failoverCooldownEntry  *widget.Entry
+
+	// 测速设置
+	pingModeSelect   *widget.Select
+	pingTestURLEntry *widget.Entry
+	pingConcurrency  *widget.Entry
+	pingTimeout      *widget.Entry
+	historySize      *widget.Entry
+	historyHours     *widget.Entry
+	speedURLEntry    *widget.Entry
+	speedMaxMB       *widget.Entry
+	speedSeconds     *widget.Entry
+}
+
+// 测速模式显示名称（对应 config.PingMode* 常量）
+var pingModeLabels = []struct {
+	mode  string
+	label string
+}{
+	{config.PingModeTCP, "TCP 连接"},
+	{config.PingModeURL, "URL 测试（经由节点访问）"},
+}
+
+// 负载均衡策略显示名称（对应 config.BalancerStrategy* 常量）
+var balancerStrategyLabels = []struct {
+	strategy string
+	label    string
+}{
+	{config.BalancerStrategyLeastPing, "延迟最低 (leastPing)"},
+	{config.BalancerStrategyLeastLoad, "负载最低 (leastLoad)"},
+	{config.BalancerStrategyRoundRobin, "轮询 (roundRobin)"},
+	{config.BalancerStrategyRandom, "随机 (random)"},
+}
+
+// NewSettingsPanel 创建设置页面内容。
+// 参数：
+//   - appState: 应用状态实例
+//
+// 返回：初始化后的设置面板实例
+func NewSettingsPanel(appState *AppState) *SettingsPanel {
+	return &SettingsPanel{
+		appState: appState,
+	}
+}
+
+// SetOnApply 设置保存设置后的回调，由外部（如 MainWindow）注入。
+func (sp *SettingsPanel) SetOnApply(handler func()) {
+	sp.onApply = handler
+}
+
+// Build 构建并返回设置页面的 UI 组件。
+func (sp *SettingsPanel) Build() fyne.CanvasObject {
+	tabs := container.NewAppTabs(
+		container.NewTabItem("连接", sp.buildConnectionTab()),
+		container.NewTabItem("访问控制", sp.buildAccessTab()),
+		container.NewTabItem("负载均衡", sp.buildBalancerTab()),
+		container.NewTabItem("故障转移", sp.buildFailoverTab()),
+		container.NewTabItem("测速", sp.buildPingTab()),
+	)
+	tabs.SetTabLocation(container.TabLocationLeading)
+	return tabs
+}
+
+// buildConnectionTab 构建“连接与核心协议”设置内容
+func (sp *SettingsPanel) buildConnectionTab() fyne.CanvasObject {
+	cfg := sp.appState.Config
+
+	// 监听地址：127.0.0.1 仅本机，0.0.0.0 局域网共享
+	sp.listenAddrEntry = widget.NewSelectEntry([]string{"127.0.0.1", "0.0.0.0"})
+	sp.listenAddrEntry.SetText(cfg.GetListenAddr())
+
+	sp.proxyPortEntry = widget.NewEntry()
+	sp.proxyPortEntry.SetText(strconv.Itoa(cfg.GetProxyPort()))
+
+	sp.httpPortEntry = widget.NewEntry()
+	sp.httpPortEntry.SetPlaceHolder("0 表示仅使用混合端口")
+	sp.httpPortEntry.SetText(strconv.Itoa(cfg.HTTPPort))
+
+	sp.portFallbackCheck = widget.NewCheck("端口被占用时自动选择空闲端口", nil)
+	sp.portFallbackCheck.SetChecked(cfg.PortFallback)
+
+	form := widget.NewForm(
+		widget.NewFormItem("监听地址", sp.listenAddrEntry),
+		widget.NewFormItem("混合端口 (SOCKS5/HTTP)", sp.proxyPortEntry),
+		widget.NewFormItem("HTTP 端口", sp.httpPortEntry),
+		widget.NewFormItem("", sp.portFallbackCheck),
+	)
+
+	hint := widget.NewLabel("0.0.0.0 会将代理共享给局域网内的其他设备")
+	hint.Wrapping = fyne.TextWrapWord
+
+	saveBtn := NewStyledButton("保存", nil, sp.onSave)
+	saveBtn.Importance = widget.HighImportance
+
+	return container.NewVBox(
+		NewTitleLabel("连接设置"),
+		form,
+		hint,
+		container.NewHBox(saveBtn),
+	)
+}
+
+// buildAccessTab 构建“访问控制”设置内容（入站认证和来源白名单）
+func (sp *SettingsPanel) buildAccessTab() fyne.CanvasObject {
+	cfg := sp.appState.Config
+
+	accountLines := make([]string, 0, len(cfg.InboundAccounts))
+	for _, account := range cfg.InboundAccounts {
+		accountLines = append(accountLines, account.User+":"+account.Pass)
+	}
+	sp.accountsEntry = widget.NewMultiLineEntry()
+	sp.accountsEntry.SetPlaceHolder("每行一个，格式：用户名:密码（留空表示不认证）")
+	sp.accountsEntry.SetText(strings.Join(accountLines, "\n"))
+	sp.accountsEntry.SetMinRowsVisible(3)
+
+	sp.sourcesEntry = widget.NewMultiLineEntry()
+	sp.sourcesEntry.SetPlaceHolder("每行一个 IP 或 CIDR，如 192.168.1.0/24（留空表示不限制）")
+	sp.sourcesEntry.SetText(strings.Join(cfg.AllowedSources, "\n"))
+	sp.sourcesEntry.SetMinRowsVisible(3)
+
+	form := widget.NewForm(
+		widget.NewFormItem("认证账户", sp.accountsEntry),
+		widget.NewFormItem("来源白名单", sp.sourcesEntry),
+	)
+
+	hint := widget.NewLabel("认证同时作用于 SOCKS5 和 HTTP 入站；本机地址始终允许访问，白名单外的来源会被阻断")
+	hint.Wrapping = fyne.TextWrapWord
+
+	saveBtn := NewStyledButton("保存", nil, sp.onSaveAccess)
+	saveBtn.Importance = widget.HighImportance
+
+	return container.NewVBox(
+		NewTitleLabel("访问控制"),
+		form,
+		hint,
+		container.NewHBox(saveBtn),
+	)
+}
+
+// onSaveAccess 校验并保存访问控制设置
+func (sp *SettingsPanel) onSaveAccess() {
+	var accounts []config.InboundAccount
+	for _, line := range splitLines(sp.accountsEntry.Text) {
+		user, pass, found := strings.Cut(line, ":")
+		if !found || user == "" || pass == "" {
+			sp.showError(fmt.Errorf("账户格式无效: %s（应为 用户名:密码）", line))
+			return
+		}
+		accounts = append(accounts, config.InboundAccount{User: user, Pass: pass})
+	}
+	sources := splitLines(sp.sourcesEntry.Text)
+
+	updated := sp.appState.Config.Settings()
+	updated.InboundAccounts = accounts
+	updated.AllowedSources = sources
+	if err := updated.Validate(); err != nil {
+		sp.showError(err)
+		return
+	}
+	sp.apply(updated, fmt.Sprintf("访问控制已保存: %d 个账户, %d 条来源白名单", len(accounts), len(sources)))
+}
+
+// buildBalancerTab 构建“负载均衡”设置内容
+func (sp *SettingsPanel) buildBalancerTab() fyne.CanvasObject {
+	cfg := sp.appState.Config
+
+	sp.balancerCheck = widget.NewCheck("对当前订阅的全部启用节点做负载均衡", nil)
+	sp.balancerCheck.SetChecked(cfg.BalancerEnabled)
+
+	labels := make([]string, 0, len(balancerStrategyLabels))
+	selected := balancerStrategyLabels[0].label
+	for _, item := range balancerStrategyLabels {
+		labels = append(labels, item.label)
+		if item.strategy == cfg.BalancerStrategy {
+			selected = item.label
+		}
+	}
+	sp.strategySelect = widget.NewSelect(labels, nil)
+	sp.strategySelect.SetSelected(selected)
+
+	form := widget.NewForm(
+		widget.NewFormItem("", sp.balancerCheck),
+		widget.NewFormItem("策略", sp.strategySelect),
+	)
+
+	hint := widget.NewLabel("启用后由 xray 定期探测各节点，主界面显示负载均衡器当前优先选择的节点")
+	hint.Wrapping = fyne.TextWrapWord
+
+	saveBtn := NewStyledButton("保存", nil, sp.onSaveBalancer)
+	saveBtn.Importance = widget.HighImportance
+
+	return container.NewVBox(
+		NewTitleLabel("负载均衡"),
+		form,
+		hint,
+		container.NewHBox(saveBtn),
+	)
+}
+
+// onSaveBalancer 保存负载均衡设置
+func (sp *SettingsPanel) onSaveBalancer() {
+	updated := sp.appState.Config.Settings()
+	updated.BalancerEnabled = sp.balancerCheck.Checked
+	for _, item := range balancerStrategyLabels {
+		if item.label == sp.strategySelect.Selected {
+			updated.BalancerStrategy = item.strategy
+		}
+	}
+	if err := updated.Validate(); err != nil {
+		sp.showError(err)
+		return
+	}
+
+	message := "负载均衡已关闭"
+	if updated.BalancerEnabled {
+		message = fmt.Sprintf("负载均衡已启用: 策略 %s", updated.BalancerStrategy)
+	}
+	sp.apply(updated, message)
+}
+
+// buildFailoverTab 构建“故障转移”设置内容
+func (sp *SettingsPanel) buildFailoverTab() fyne.CanvasObject {
+	cfg := sp.appState.Config
+
+	sp.failoverCheck = widget.NewCheck("当前节点不可用时自动切换到其他节点", nil)
+	sp.failoverCheck.SetChecked(cfg.FailoverEnabled)
+
+	sp.failoverIntervalEntry = widget.NewEntry()
+	sp.failoverIntervalEntry.SetText(strconv.Itoa(cfg.FailoverInterval))
+
+	sp.failoverThresholdEntry = widget.NewEntry()
+	sp.failoverThresholdEntry.SetText(strconv.Itoa(cfg.FailoverThreshold))
+
+	sp.failoverCooldownEntry = widget.NewEntry()
+	sp.failoverCooldownEntry.SetText(strconv.Itoa(cfg.FailoverCooldown))
+
+	form := widget.NewForm(
+		widget.NewFormItem("", sp.failoverCheck),
+		widget.NewFormItem("检测间隔 (秒)", sp.failoverIntervalEntry),
+		widget.NewFormItem("连续失败次数", sp.failoverThresholdEntry),
+		widget.NewFormItem("切换冷却 (秒)", sp.failoverCooldownEntry),
+	)
+
+	hint := widget.NewLabel("通过当前节点定期访问探测地址，连续失败达到次数后切换到延迟最低的其他启用节点；负载均衡启用时不生效")
+	hint.Wrapping = fyne.TextWrapWord
+
+	saveBtn := NewStyledButton("保存", nil, sp.onSaveFailover)
+	saveBtn.Importance = widget.HighImportance
+
+	return container.NewVBox(
+		NewTitleLabel("故障转移"),
+		form,
+		hint,
+		container.NewHBox(saveBtn),
+	)
+}
+
+// onSaveFailover 校验并保存故障转移设置
+func (sp *SettingsPanel) onSaveFailover() {
+	interval, err := strconv.Atoi(strings.TrimSpace(sp.failoverIntervalEntry.Text))
+	if err != nil || interval <= 0 {
+		sp.showError(fmt.Errorf("检测间隔无效: 请输入正整数"))
+		return
+	}
+	threshold, err := strconv.Atoi(strings.TrimSpace(sp.failoverThresholdEntry.Text))
+	if err != nil || threshold <= 0 {
+		sp.showError(fmt.Errorf("连续失败次数无效: 请输入正整数"))
+		return
+	}
+	cooldown, err := strconv.Atoi(strings.TrimSpace(sp.failoverCooldownEntry.Text))
+	if err != nil || cooldown < 0 {
+		sp.showError(fmt.Errorf("切换冷却无效: 请输入非负整数"))
+		return
+	}
+
+	updated := sp.appState.Config.Settings()
+	updated.FailoverEnabled = sp.failoverCheck.Checked
+	updated.FailoverInterval = interval
+	updated.FailoverThreshold = threshold
+	updated.FailoverCooldown = cooldown
+	if err := updated.Validate(); err != nil {
+		sp.showError(err)
+		return
+	}
+
+	message := "故障转移已关闭"
+	if updated.FailoverEnabled {
+		message = fmt.Sprintf("故障转移已启用: 每 %d 秒检测, 连续失败 %d 次切换", interval, threshold)
+	}
+	sp.apply(updated, message)
+}
+
+// buildPingTab 构建“测速”设置内容
+func (sp *SettingsPanel) buildPingTab() fyne.CanvasObject {
+	cfg := sp.appState.Config
+
+	labels := make([]string, 0, len(pingModeLabels))
+	selected := pingModeLabels[0].label
+	for _, item := range pingModeLabels {
+		labels = append(labels, item.label)
+		if item.mode == cfg.PingMode {
+			selected = item.label
+		}
+	}
+	sp.pingModeSelect = widget.NewSelect(labels, nil)
+	sp.pingModeSelect.SetSelected(selected)
+
+	sp.pingTestURLEntry = widget.NewEntry()
+	sp.pingTestURLEntry.SetPlaceHolder(xray.DefaultProbeURL)
+	sp.pingTestURLEntry.SetText(cfg.PingTestURL)
+
+	sp.pingConcurrency = widget.NewEntry()
+	sp.pingConcurrency.SetText(strconv.Itoa(cfg.PingConcurrency))
+
+	sp.pingTimeout = widget.NewEntry()
+	sp.pingTimeout.SetText(strconv.Itoa(cfg.PingTimeout))
+
+	sp.historySize = widget.NewEntry()
+	sp.historySize.SetText(strconv.Itoa(cfg.LatencyHistorySize))
+
+	sp.historyHours = widget.NewEntry()
+	sp.historyHours.SetText(strconv.Itoa(cfg.LatencyHistoryHours))
+
+	sp.speedURLEntry = widget.NewEntry()
+	sp.speedURLEntry.SetPlaceHolder(ping.DefaultSpeedTestURL)
+	sp.speedURLEntry.SetText(cfg.SpeedTestURL)
+
+	sp.speedMaxMB = widget.NewEntry()
+	sp.speedMaxMB.SetText(strconv.Itoa(cfg.SpeedTestMaxMB))
+
+	sp.speedSeconds = widget.NewEntry()
+	sp.speedSeconds.SetText(strconv.Itoa(cfg.SpeedTestSeconds))
+
+	form := widget.NewForm(
+		widget.NewFormItem("测速方式", sp.pingModeSelect),
+		widget.NewFormItem("测试地址", sp.pingTestURLEntry),
+		widget.NewFormItem("并发数", sp.pingConcurrency),
+		widget.NewFormItem("单节点超时 (秒)", sp.pingTimeout),
+		widget.NewFormItem("统计最近次数", sp.historySize),
+		widget.NewFormItem("统计时间范围 (小时)", sp.historyHours),
+		widget.NewFormItem("下载测速地址", sp.speedURLEntry),
+		widget.NewFormItem("下载数据上限 (MB)", sp.speedMaxMB),
+		widget.NewFormItem("下载时长上限 (秒)", sp.speedSeconds),
+	)
+
+	hint := widget.NewLabel("TCP 连接只检测服务器端口是否可达；URL 测试会经由节点实际访问测试地址，能发现协议、认证或 TLS 配置错误，耗时也更长。节点列表可按统计范围内的中位数、P95、抖动和成功率排序，超出范围的测速记录会被自动清理。下载测速逐个节点下载测试文件，达到数据或时长上限即停止")
+	hint.Wrapping = fyne.TextWrapWord
+
+	saveBtn := NewStyledButton("保存", nil, sp.onSavePing)
+	saveBtn.Importance = widget.HighImportance
+
+	return container.NewVBox(
+		NewTitleLabel("测速"),
+		form,
+		hint,
+		container.NewHBox(saveBtn),
+	)
+}
+
+// onSavePing 校验并保存测速设置
+func (sp *SettingsPanel) onSavePing() {
+	concurrency, err := strconv.Atoi(strings.TrimSpace(sp.pingConcurrency.Text))
+	if err != nil || concurrency <= 0 {
+		sp.showError(fmt.Errorf("并发数无效: 请输入正整数"))
+		return
+	}
+	timeout, err := strconv.Atoi(strings.TrimSpace(sp.pingTimeout.Text))
+	if err != nil || timeout <= 0 {
+		sp.showError(fmt.Errorf("单节点超时无效: 请输入正整数"))
+		return
+	}
+
+	historySize, err := strconv.Atoi(strings.TrimSpace(sp.historySize.Text))
+	if err != nil || historySize <= 0 {
+		sp.showError(fmt.Errorf("统计最近次数无效: 请输入正整数"))
+		return
+	}
+	historyHours, err := strconv.Atoi(strings.TrimSpace(sp.historyHours.Text))
+	if err != nil || historyHours <= 0 {
+		sp.showError(fmt.Errorf("统计时间范围无效: 请输入正整数"))
+		return
+	}
+
+	speedMaxMB, err := strconv.Atoi(strings.TrimSpace(sp.speedMaxMB.Text))
+	if err != nil || speedMaxMB <= 0 {
+		sp.showError(fmt.Errorf("下载数据上限无效: 请输入正整数"))
+		return
+	}
+	speedSeconds, err := strconv.Atoi(strings.TrimSpace(sp.speedSeconds.Text))
+	if err != nil || speedSeconds <= 0 {
+		sp.showError(fmt.Errorf("下载时长上限无效: 请输入正整数"))
+		return
+	}
+
+	updated := sp.appState.Config.Settings()
+	updated.PingConcurrency = concurrency
+	updated.PingTimeout = timeout
+	updated.LatencyHistorySize = historySize
+	updated.LatencyHistoryHours = historyHours
+	updated.SpeedTestURL = strings.TrimSpace(sp.speedURLEntry.Text)
+	updated.SpeedTestMaxMB = speedMaxMB
+	updated.SpeedTestSeconds = speedSeconds
+	for _, item := range pingModeLabels {
+		if item.label == sp.pingModeSelect.Selected {
+			updated.PingMode = item.mode
+		}
+	}
+	updated.PingTestURL = strings.TrimSpace(sp.pingTestURLEntry.Text)
+	if err := updated.Validate(); err != nil {
+		sp.showError(err)
+		return
+	}
+
+	// 测速设置不影响运行中的代理，无需重启，直接保存
+	sp.appState.PingManager.SetMode(updated.PingMode)
+	sp.appState.PingManager.SetTestURL(updated.PingTestURL)
+	sp.appState.PingManager.SetTimeout(time.Duration(updated.PingTimeout) * time.Second)
+	sp.appState.PingManager.SetHistory(updated.LatencyHistorySize, time.Duration(updated.LatencyHistoryHours)*time.Hour)
+	sp.appState.PingManager.SetSpeedTest(updated.SpeedTestURL, int64(updated.SpeedTestMaxMB)<<20, time.Duration(updated.SpeedTestSeconds)*time.Second)
+
+	sp.appState.Config.ApplySettings(&updated)
+	sp.appState.SaveConfigToDB()
+	message := fmt.Sprintf("测速设置已保存: %s", sp.pingModeSelect.Selected)
+	sp.appState.AppendLog("INFO", "app", message)
+	if sp.appState.Logger != nil {
+		sp.appState.Logger.InfoWithType(logging.LogTypeApp, "%s", message)
+	}
+}
+
+// apply 写入新配置、保存到数据库并在代理运行时重启
+func (sp *SettingsPanel) apply(updated config.Config, message string) {
+	sp.appState.Config.ApplySettings(&updated)
+	sp.appState.SaveConfigToDB()
+	sp.appState.StartFailoverMonitor()
+
+	sp.appState.AppendLog("INFO", "app", message)
+	if sp.appState.Logger != nil {
+		sp.appState.Logger.InfoWithType(logging.LogTypeApp, "%s", message)
+	}
+
+	// 代理运行中时使用新设置重启
+	if sp.onApply != nil {
+		sp.onApply()
+	}
+}
+
+// splitLines 按行拆分输入，去除空行和首尾空白
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// onSave 校验并保存连接设置
+func (sp *SettingsPanel) onSave() {
+	proxyPort, err := parsePort(sp.proxyPortEntry.Text, false)
+	if err != nil {
+		sp.showError(fmt.Errorf("混合端口无效: %w", err))
+		return
+	}
+	httpPort, err := parsePort(sp.httpPortEntry.Text, true)
+	if err != nil {
+		sp.showError(fmt.Errorf("HTTP 端口无效: %w", err))
+		return
+	}
+
+	// 先在副本上校验，避免无效配置写入当前配置
+	updated := sp.appState.Config.Settings()
+	updated.ListenAddr = strings.TrimSpace(sp.listenAddrEntry.Text)
+	updated.AutoProxyPort = proxyPort
+	updated.HTTPPort = httpPort
+	updated.PortFallback = sp.portFallbackCheck.Checked
+	if err := updated.Validate(); err != nil {
+		sp.showError(err)
+		return
+	}
+	sp.apply(updated, fmt.Sprintf("连接设置已保存: 监听 %s:%d, HTTP 端口 %d", updated.GetListenAddr(), proxyPort, httpPort))
+}
+
+// showError 记录日志并显示错误对话框
+func (sp *SettingsPanel) showError(err error) {
+	if sp.appState.Logger != nil {
+		sp.appState.Logger.Error("保存设置失败: %v", err)
+	}
+	if sp.appState.Window != nil {
+		dialog.ShowError(err, sp.appState.Window)
+	}
+}
+
+// parsePort 解析端口输入，allowZero 为 true 时允许 0（表示不启用）
+func parsePort(text string, allowZero bool) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" && allowZero {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("请输入数字")
+	}
+	if port == 0 && allowZero {
+		return 0, nil
+	}
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("端口范围为 1-65535")
+	}
+	return port, nil
+}
@@ -1,15 +1,19 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/config"
 	"myproxy.com/p/internal/database"
 	"myproxy.com/p/internal/logging"
 	"myproxy.com/p/internal/systemproxy"
+	"myproxy.com/p/internal/xray"
 )
 
 // 系统代理模式常量定义
@@ -25,6 +29,13 @@ const (
 	SystemProxyModeShortTerminal = "终端"
 )
 
+// 路由模式显示名称（对应 config.RoutingMode* 常量）
+const (
+	RoutingModeLabelDirect = "直连"
+	RoutingModeLabelGlobal = "全局"
+	RoutingModeLabelSmart  = "智能"
+)
+
 // StatusPanel 显示代理状态、端口和当前服务器信息。
 // 它使用 Fyne 的双向数据绑定机制，当应用状态更新时自动刷新显示。
 type StatusPanel struct {
@@ -33,7 +44,9 @@ type StatusPanel struct {
 	portLabel        *widget.Label
 	serverNameLabel  *widget.Label
 	delayLabel       *widget.Label
+	trafficLabel     *widget.Label // 实时流量标签（上行/下行速率）
 	proxyModeSelect  *widget.Select
+	routingSelect    *widget.Select // 路由模式下拉框（直连/全局/智能）
 	systemProxy      *systemproxy.SystemProxy
 	statusIcon       *widget.Icon // 状态图标
 	portIcon         *widget.Icon // 端口图标
@@ -43,6 +56,10 @@ type StatusPanel struct {
 	// 主界面一键操作大按钮相关
 	mainToggleButton *widget.Button      // 主开关按钮（连接/断开）
 	onToggleProxy    func()              // 由外部注入的代理开关回调
+	onRoutingChange  func()              // 由外部注入的路由模式切换回调（用于重启代理）
+
+	ctx    context.Context    // 上下文，用于控制流量刷新 goroutine
+	cancel context.CancelFunc // 取消函数
 }
 
 // NewStatusPanel 创建并初始化状态信息面板。
@@ -63,6 +80,7 @@ func NewStatusPanel(appState *AppState) *StatusPanel {
 		sp.portLabel = widget.NewLabel("动态端口: -")
 		sp.serverNameLabel = widget.NewLabel("当前服务器: 无")
 		sp.delayLabel = widget.NewLabel("延迟: -")
+		sp.trafficLabel = widget.NewLabel(formatTrafficText(nil))
 		return sp
 	}
 
@@ -96,7 +114,7 @@ func NewStatusPanel(appState *AppState) *StatusPanel {
 	sp.delayLabel.Wrapping = fyne.TextWrapOff
 
 	// 创建系统代理管理器（默认使用 localhost:10080）
-	sp.systemProxy = systemproxy.NewSystemProxy("127.0.0.1", 10080)
+	sp.systemProxy = systemproxy.NewSystemProxy("127.0.0.1", config.DefaultProxyPort)
 
 	// 创建图标
 	sp.statusIcon = widget.NewIcon(theme.CancelIcon())
@@ -128,12 +146,113 @@ func NewStatusPanel(appState *AppState) *StatusPanel {
 	)
 	sp.proxyModeSelect.PlaceHolder = "智能模式"
 
+	// 创建路由模式下拉框（符合 UI.md 设计：直连/全局/智能）
+	sp.routingSelect = widget.NewSelect(
+		[]string{
+			RoutingModeLabelDirect,
+			RoutingModeLabelGlobal,
+			RoutingModeLabelSmart,
+		},
+		nil,
+	)
+	if appState.Config != nil {
+		sp.routingSelect.SetSelected(getRoutingModeLabel(appState.Config.RoutingMode))
+	}
+	// 恢复选中状态后再绑定 change 事件，避免启动时触发代理重启
+	sp.routingSelect.OnChanged = sp.onRoutingModeSelected
+
+	// 实时流量标签，由后台定时器每秒刷新
+	sp.trafficLabel = widget.NewLabel(formatTrafficText(nil))
+	sp.trafficLabel.Alignment = fyne.TextAlignCenter
+	sp.ctx, sp.cancel = context.WithCancel(context.Background())
+	go sp.runTrafficTicker()
+
 	// 恢复系统代理状态（在应用启动时）
 	sp.restoreSystemProxyState()
 
 	return sp
 }
 
+// runTrafficTicker 每秒从 xray 实例读取流量统计并更新实时流量标签，直到调用 Stop
+func (sp *StatusPanel) runTrafficTicker() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastText := formatTrafficText(nil)
+	tick := 0
+	for {
+		select {
+		case <-sp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		tick++
+
+		var xi *xray.XrayInstance
+		if sp.appState != nil {
+			xi = sp.appState.CurrentXray()
+		}
+		running := xi != nil && xi.IsRunning()
+
+		// 负载均衡模式下每 5 秒刷新一次优先节点（配置只在 UI 线程读取）
+		if tick%5 == 0 && running {
+			targetText := sp.appState.BalancerTargetText()
+			fyne.Do(func() {
+				if sp.appState.Config != nil && sp.appState.Config.BalancerEnabled {
+					sp.appState.ServerNameBinding.Set(targetText)
+				}
+			})
+		}
+
+		var text string
+		if running {
+			stats, err := xi.GetTrafficStats()
+			if err == nil {
+				text = formatTrafficText(stats)
+			}
+		}
+		if text == "" {
+			text = formatTrafficText(nil)
+		}
+		if text == lastText {
+			continue
+		}
+		lastText = text
+		fyne.Do(func() {
+			sp.trafficLabel.SetText(text)
+		})
+	}
+}
+
+// Stop 停止状态面板的后台刷新
+func (sp *StatusPanel) Stop() {
+	if sp.cancel != nil {
+		sp.cancel()
+	}
+}
+
+// formatTrafficText 格式化实时流量显示文本
+func formatTrafficText(stats *xray.TrafficStats) string {
+	if stats == nil {
+		return "↑ - ↓ -"
+	}
+	return fmt.Sprintf("↑ %s/s  ↓ %s/s", formatBytes(stats.TotalUplinkRate()), formatBytes(stats.TotalDownlinkRate()))
+}
+
+// formatBytes 将字节数格式化为易读的字符串
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // Build 构建并返回状态信息面板的 UI 组件。
 // 返回：包含代理状态、端口和服务器名称的水平布局容器
 func (sp *StatusPanel) Build() fyne.CanvasObject {
@@ -179,9 +298,14 @@ func (sp *StatusPanel) Build() fyne.CanvasObject {
 
 	// 模式选择（简化显示，符合 UI.md 设计）
 	modeLabel := widget.NewLabel("⚙️ 模式:")
+	proxyModeLabel := widget.NewLabel("系统代理:")
 	modeInfo := container.NewHBox(
 		modeLabel,
 		NewSpacer(SpacingSmall),
+		sp.routingSelect,
+		NewSpacer(SpacingMedium),
+		proxyModeLabel,
+		NewSpacer(SpacingSmall),
 		sp.proxyModeSelect,
 	)
 	modeInfo = container.NewPadded(modeInfo)
@@ -193,10 +317,8 @@ func (sp *StatusPanel) Build() fyne.CanvasObject {
 	)
 	nodeAndMode = container.NewPadded(nodeAndMode)
 
-	// 底部：实时流量占位（未来可替换为小曲线图）
-	trafficPlaceholder := widget.NewLabel("实时流量图（预留）")
-	trafficPlaceholder.Alignment = fyne.TextAlignCenter
-	trafficArea := container.NewCenter(container.NewPadded(trafficPlaceholder))
+	// 底部：实时流量（上行/下行速率）
+	trafficArea := container.NewCenter(container.NewPadded(sp.trafficLabel))
 
 	// 整体垂直排版，类似 UI.md 草图，增加间距使布局更清晰
 	content := container.NewVBox(
@@ -260,7 +382,7 @@ func (sp *StatusPanel) updateSystemProxyPort() {
 	}
 
 	// 从配置或 xray 实例获取端口
-	proxyPort := 10080 // 默认端口
+	proxyPort := config.DefaultProxyPort // 默认端口
 	if sp.appState.XrayInstance != nil && sp.appState.XrayInstance.IsRunning() {
 		if port := sp.appState.XrayInstance.GetPort(); port > 0 {
 			proxyPort = port
@@ -330,6 +452,65 @@ func (sp *StatusPanel) SetToggleHandler(handler func()) {
 	sp.onToggleProxy = handler
 }
 
+// SetRoutingModeHandler 设置路由模式切换后的回调，由外部（如 ServerListPanel）注入。
+// 回调内部负责在代理运行时使用新的路由模式重启代理。
+func (sp *StatusPanel) SetRoutingModeHandler(handler func()) {
+	sp.onRoutingChange = handler
+}
+
+// onRoutingModeSelected 路由模式下拉框变更处理
+func (sp *StatusPanel) onRoutingModeSelected(label string) {
+	if sp.appState == nil || sp.appState.Config == nil {
+		return
+	}
+
+	mode := getRoutingMode(label)
+	if mode == sp.appState.Config.RoutingMode {
+		return
+	}
+	sp.appState.Config.RoutingMode = mode
+
+	// 保存到数据库，保证重启后仍然生效
+	if err := database.SetAppConfig("routingMode", mode); err != nil {
+		if sp.appState.Logger != nil {
+			sp.appState.Logger.Error("保存路由模式失败: %v", err)
+		}
+	}
+
+	sp.appState.AppendLog("INFO", "app", fmt.Sprintf("路由模式已切换为: %s", label))
+	if sp.appState.Logger != nil {
+		sp.appState.Logger.InfoWithType(logging.LogTypeApp, "路由模式已切换为: %s", label)
+	}
+
+	if sp.onRoutingChange != nil {
+		sp.onRoutingChange()
+	}
+}
+
+// getRoutingModeLabel 将路由模式映射到显示名称
+func getRoutingModeLabel(mode string) string {
+	switch mode {
+	case config.RoutingModeDirect:
+		return RoutingModeLabelDirect
+	case config.RoutingModeGlobal:
+		return RoutingModeLabelGlobal
+	default:
+		return RoutingModeLabelSmart
+	}
+}
+
+// getRoutingMode 将显示名称映射到路由模式
+func getRoutingMode(label string) string {
+	switch label {
+	case RoutingModeLabelDirect:
+		return config.RoutingModeDirect
+	case RoutingModeLabelGlobal:
+		return config.RoutingModeGlobal
+	default:
+		return config.RoutingModeSmart
+	}
+}
+
 // getFullModeName 将简短文本映射到完整的功能名称
 func (sp *StatusPanel) getFullModeName(shortText string) string {
 	switch shortText {
@@ -395,7 +576,7 @@ func (sp *StatusPanel) applySystemProxyMode(fullModeName string) error {
 		// 然后设置系统代理
 		err = sp.systemProxy.SetSystemProxy()
 		if err == nil {
-			proxyPort := 10080
+			proxyPort := config.DefaultProxyPort
 			if sp.appState.XrayInstance != nil && sp.appState.XrayInstance.IsRunning() {
 				if port := sp.appState.XrayInstance.GetPort(); port > 0 {
 					proxyPort = port
@@ -415,7 +596,7 @@ func (sp *StatusPanel) applySystemProxyMode(fullModeName string) error {
 		// 然后设置环境变量代理
 		err = sp.systemProxy.SetTerminalProxy()
 		if err == nil {
-			proxyPort := 10080
+			proxyPort := config.DefaultProxyPort
 			if sp.appState.XrayInstance != nil && sp.appState.XrayInstance.IsRunning() {
 				if port := sp.appState.XrayInstance.GetPort(); port > 0 {
 					proxyPort = port
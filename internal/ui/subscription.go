@@ -3,6 +3,7 @@ package ui
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -12,6 +13,8 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/subscription"
 )
 
 // SubscriptionPanel 管理订阅的显示和操作。
@@ -181,11 +184,12 @@ func (sp *SubscriptionPanel) onEditSubscription(sub *database.Subscription) {
 		// 如果URL改变，更新订阅
 		if url != sub.URL {
 			// 更新订阅
-			err := sp.appState.SubscriptionManager.UpdateSubscription(url, label)
+			diff, err := sp.appState.SubscriptionManager.UpdateSubscription(url, label)
 			if err != nil {
 				sp.logAndShowError("订阅更新失败", err)
 				return
 			}
+			showSubscriptionDiff(sp.appState, label, diff)
 		} else if label != sub.Label {
 			// 只更新标签
 			_, err := database.AddOrUpdateSubscription(url, label)
@@ -325,10 +329,12 @@ func (sp *SubscriptionPanel) onUpdateSubscription() {
 		}
 
 		sub := sp.subscriptions[selectedIndex]
-		if err := sp.appState.SubscriptionManager.UpdateSubscription(sub.URL, sub.Label); err != nil {
+		diff, err := sp.appState.SubscriptionManager.UpdateSubscription(sub.URL, sub.Label)
+		if err != nil {
 			sp.logAndShowError("更新订阅失败", err)
 			return
 		}
+		showSubscriptionDiff(sp.appState, sub.Label, diff)
 
 		// 刷新订阅、服务器及状态显示
 		sp.refreshSubscriptionList()
@@ -343,3 +349,56 @@ func (sp *SubscriptionPanel) onUpdateSubscription() {
 		sp.appState.Window.SetTitle("订阅已更新")
 	}, sp.appState.Window)
 }
+
+// showSubscriptionDiff 记录订阅更新的节点变化，并显示变化摘要对话框（需在 UI 线程调用）
+func showSubscriptionDiff(appState *AppState, name string, diff *subscription.SubscriptionDiff) {
+	if appState == nil || diff == nil {
+		return
+	}
+	if appState.Logger != nil {
+		appState.Logger.InfoWithType(logging.LogTypeApp, "订阅 %s 更新完成，%s", name, diff.Summary())
+	}
+	if appState.Window == nil {
+		return
+	}
+
+	detail := widget.NewLabel(diff.Details(20))
+	detail.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(detail)
+	scroll.SetMinSize(fyne.NewSize(360, 200))
+	dialog.ShowCustom(fmt.Sprintf("订阅 %s 更新完成", name), "确定", scroll, appState.Window)
+}
+
+// showParseReport 显示订阅最近一次解析的诊断报告，列出每个无法解析的条目（需在 UI 线程调用）
+func showParseReport(appState *AppState, name string, report database.ParseReport) {
+	if appState == nil || appState.Window == nil {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n解析于 %s", report.Summary(), report.ParsedAt.Format("2006-01-02 15:04:05"))
+	if report.Failed() > len(report.Rejected) {
+		fmt.Fprintf(&b, "（仅记录前 %d 条失败）", len(report.Rejected))
+	}
+	for _, r := range report.Rejected {
+		fmt.Fprintf(&b, "\n\n第 %d 条 [%s] %s\n  %s", r.Line, r.Parser, r.Error, r.Content)
+	}
+
+	detail := widget.NewLabel(b.String())
+	detail.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(detail)
+	scroll.SetMinSize(fyne.NewSize(480, 300))
+	dialog.ShowCustom(fmt.Sprintf("订阅 %s 解析报告", name), "确定", scroll, appState.Window)
+}
+
+// showSubscriptionUpdateResults 记录批量更新的结果，并在一个对话框中列出每个订阅的变化摘要（需在 UI 线程调用）
+func showSubscriptionUpdateResults(appState *AppState, results []string) {
+	if appState == nil || appState.Window == nil || len(results) == 0 {
+		return
+	}
+	detail := widget.NewLabel(strings.Join(results, "\n"))
+	detail.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(detail)
+	scroll.SetMinSize(fyne.NewSize(360, 200))
+	dialog.ShowCustom("批量更新完成", "确定", scroll, appState.Window)
+}
@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/subscription"
+)
+
+// subscriptionAuthOptions 订阅请求认证方式选项
+var subscriptionAuthOptions = []struct {
+	label    string
+	authType string
+}{
+	{"无", database.AuthNone},
+	{"Basic", database.AuthBasic},
+	{"Bearer", database.AuthBearer},
+}
+
+// subscriptionFetchForm 订阅请求设置的表单
+type subscriptionFetchForm struct {
+	userAgent *widget.SelectEntry
+	headers   *widget.Entry
+	auth      *widget.Select
+	username  *widget.Entry
+	password  *widget.Entry
+	token     *widget.Entry
+	mirrors   *widget.Entry
+	useProxy  *widget.Check
+}
+
+// newSubscriptionFetchForm 创建请求设置表单并填入当前设置
+func newSubscriptionFetchForm(options database.SubscriptionFetchOptions) *subscriptionFetchForm {
+	f := &subscriptionFetchForm{
+		userAgent: widget.NewSelectEntry(subscription.UserAgentPresets),
+		headers:   widget.NewMultiLineEntry(),
+		username:  widget.NewEntry(),
+		password:  widget.NewPasswordEntry(),
+		token:     widget.NewPasswordEntry(),
+		mirrors:   widget.NewMultiLineEntry(),
+		useProxy:  widget.NewCheck("通过正在运行的本地代理获取", nil),
+	}
+	f.userAgent.SetPlaceHolder("默认")
+	f.headers.SetPlaceHolder("每行一个，如: X-Device: desktop")
+	f.headers.SetMinRowsVisible(2)
+	f.mirrors.SetPlaceHolder("每行一个，订阅地址失败时按顺序尝试")
+	f.mirrors.SetMinRowsVisible(2)
+
+	labels := make([]string, len(subscriptionAuthOptions))
+	selected := subscriptionAuthOptions[0].label
+	for i, opt := range subscriptionAuthOptions {
+		labels[i] = opt.label
+		if opt.authType == options.AuthType {
+			selected = opt.label
+		}
+	}
+	f.auth = widget.NewSelect(labels, func(string) { f.updateAuthFields() })
+
+	f.userAgent.SetText(options.UserAgent)
+	f.headers.SetText(formatHeaders(options.Headers))
+	f.username.SetText(options.Username)
+	f.password.SetText(options.Password)
+	f.token.SetText(options.Token)
+	f.mirrors.SetText(strings.Join(options.Mirrors, "\n"))
+	f.useProxy.SetChecked(options.UseProxy)
+	f.auth.SetSelected(selected)
+	return f
+}
+
+// form 返回请求设置表单
+func (f *subscriptionFetchForm) form() *widget.Form {
+	return widget.NewForm(
+		widget.NewFormItem("User-Agent", f.userAgent),
+		widget.NewFormItem("请求头", f.headers),
+		widget.NewFormItem("认证", f.auth),
+		widget.NewFormItem("用户名", f.username),
+		widget.NewFormItem("密码", f.password),
+		widget.NewFormItem("令牌", f.token),
+		widget.NewFormItem("备用地址", f.mirrors),
+		widget.NewFormItem("代理", f.useProxy),
+	)
+}
+
+// authType 返回选中的认证方式
+func (f *subscriptionFetchForm) authType() string {
+	for _, opt := range subscriptionAuthOptions {
+		if opt.label == f.auth.Selected {
+			return opt.authType
+		}
+	}
+	return database.AuthNone
+}
+
+// updateAuthFields 根据认证方式启用对应的输入框
+func (f *subscriptionFetchForm) updateAuthFields() {
+	authType := f.authType()
+	setEnabled(f.username, authType == database.AuthBasic)
+	setEnabled(f.password, authType == database.AuthBasic)
+	setEnabled(f.token, authType == database.AuthBearer)
+}
+
+// setEnabled 启用或禁用输入框
+func setEnabled(entry *widget.Entry, enabled bool) {
+	if enabled {
+		entry.Enable()
+	} else {
+		entry.Disable()
+	}
+}
+
+// options 返回表单中填写的请求设置，格式错误或设置无效时返回错误
+func (f *subscriptionFetchForm) options() (database.SubscriptionFetchOptions, error) {
+	headers, err := parseHeaders(f.headers.Text)
+	if err != nil {
+		return database.SubscriptionFetchOptions{}, err
+	}
+	options := database.SubscriptionFetchOptions{
+		Headers:   headers,
+		UserAgent: strings.TrimSpace(f.userAgent.Text),
+		AuthType:  f.authType(),
+		Mirrors:   splitLines(f.mirrors.Text),
+		UseProxy:  f.useProxy.Checked,
+	}
+	// 只保存所选认证方式需要的字段
+	switch options.AuthType {
+	case database.AuthBasic:
+		options.Username = strings.TrimSpace(f.username.Text)
+		options.Password = f.password.Text
+	case database.AuthBearer:
+		options.Token = strings.TrimSpace(f.token.Text)
+	}
+	if err := subscription.ValidateFetchOptions(options); err != nil {
+		return database.SubscriptionFetchOptions{}, err
+	}
+	return options, nil
+}
+
+// parseHeaders 解析每行一个的 "名称: 值" 格式请求头
+func parseHeaders(text string) (map[string]string, error) {
+	var headers map[string]string
+	for _, line := range splitLines(text) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("请求头格式错误（应为 名称: 值）: %s", line)
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// formatHeaders 将请求头按名称排序格式化为每行一个的文本
+func formatHeaders(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + headers[name]
+	}
+	return strings.Join(lines, "\n")
+}
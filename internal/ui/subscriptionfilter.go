@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/subscription"
+)
+
+// renameRuleSeparator 重命名规则文本中模式与替换内容的分隔符
+const renameRuleSeparator = " => "
+
+// subscriptionFilterForm 订阅节点过滤与重命名规则的表单
+type subscriptionFilterForm struct {
+	include         *widget.Entry
+	exclude         *widget.Entry
+	includeProtocol *widget.Entry
+	excludeProtocol *widget.Entry
+	renames         *widget.Entry
+}
+
+// newSubscriptionFilterForm 创建过滤规则表单并填入当前规则
+func newSubscriptionFilterForm(filter database.SubscriptionFilter) *subscriptionFilterForm {
+	f := &subscriptionFilterForm{
+		include:         widget.NewEntry(),
+		exclude:         widget.NewEntry(),
+		includeProtocol: widget.NewEntry(),
+		excludeProtocol: widget.NewEntry(),
+		renames:         widget.NewMultiLineEntry(),
+	}
+	f.include.SetPlaceHolder("例如: 香港|日本")
+	f.exclude.SetPlaceHolder("例如: 剩余流量|到期|官网")
+	f.includeProtocol.SetPlaceHolder("例如: ^(vless|trojan)$")
+	f.excludeProtocol.SetPlaceHolder("例如: ^ss$")
+	f.renames.SetPlaceHolder("每行一条，如: ^\\[(\\w+)\\]" + renameRuleSeparator + "$1 ")
+	f.renames.SetMinRowsVisible(3)
+
+	f.include.SetText(filter.Include)
+	f.exclude.SetText(filter.Exclude)
+	f.includeProtocol.SetText(filter.IncludeProtocol)
+	f.excludeProtocol.SetText(filter.ExcludeProtocol)
+	f.renames.SetText(formatRenameRules(filter.Renames))
+	return f
+}
+
+// items 返回表单项
+func (f *subscriptionFilterForm) items() []*widget.FormItem {
+	return []*widget.FormItem{
+		{Text: "保留名称", Widget: f.include, HintText: "正则，为空保留全部"},
+		{Text: "排除名称", Widget: f.exclude, HintText: "正则"},
+		{Text: "保留协议", Widget: f.includeProtocol, HintText: "正则，匹配 vmess、vless、ss、trojan 等"},
+		{Text: "排除协议", Widget: f.excludeProtocol, HintText: "正则"},
+		{Text: "重命名", Widget: f.renames, HintText: "按顺序应用，格式：模式" + renameRuleSeparator + "替换"},
+	}
+}
+
+// filter 返回表单中填写的规则
+func (f *subscriptionFilterForm) filter() database.SubscriptionFilter {
+	return database.SubscriptionFilter{
+		Include:         strings.TrimSpace(f.include.Text),
+		Exclude:         strings.TrimSpace(f.exclude.Text),
+		IncludeProtocol: strings.TrimSpace(f.includeProtocol.Text),
+		ExcludeProtocol: strings.TrimSpace(f.excludeProtocol.Text),
+		Renames:         parseRenameRules(f.renames.Text),
+	}
+}
+
+// parseRenameRules 解析每行一条的重命名规则，没有分隔符的行表示删除匹配内容
+func parseRenameRules(text string) []database.RenameRule {
+	var rules []database.RenameRule
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		pattern, replace, _ := strings.Cut(line, renameRuleSeparator)
+		rules = append(rules, database.RenameRule{Pattern: strings.TrimSpace(pattern), Replace: replace})
+	}
+	return rules
+}
+
+// formatRenameRules 将重命名规则格式化为每行一条的文本
+func formatRenameRules(rules []database.RenameRule) string {
+	lines := make([]string, len(rules))
+	for i, r := range rules {
+		lines[i] = r.Pattern + renameRuleSeparator + r.Replace
+	}
+	return strings.Join(lines, "\n")
+}
+
+// previewSubscriptionFilter 按请求设置下载订阅并预览过滤规则的效果，列出会保留和被过滤的节点
+func previewSubscriptionFilter(appState *AppState, url string, options database.SubscriptionFetchOptions, filter database.SubscriptionFilter) {
+	if err := subscription.ValidateFilter(filter); err != nil {
+		dialog.ShowError(err, appState.Window)
+		return
+	}
+
+	progress := dialog.NewCustomWithoutButtons("预览过滤规则", widget.NewProgressBarInfinite(), appState.Window)
+	progress.Show()
+	go func() {
+		result, err := appState.SubscriptionManager.PreviewFilter(url, options, filter)
+		fyne.Do(func() {
+			progress.Hide()
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("预览失败: %w", err), appState.Window)
+				return
+			}
+
+			var b strings.Builder
+			fmt.Fprintf(&b, "保留 %d 个节点，过滤 %d 个节点", len(result.Kept), len(result.Dropped))
+			fmt.Fprintf(&b, "\n\n保留（%d）:", len(result.Kept))
+			for _, s := range result.Kept {
+				if original, ok := result.OriginalNames[s.ID]; ok {
+					fmt.Fprintf(&b, "\n  %s ← %s", s.Name, original)
+				} else {
+					b.WriteString("\n  " + s.Name)
+				}
+			}
+			if len(result.Dropped) > 0 {
+				fmt.Fprintf(&b, "\n\n过滤（%d）:", len(result.Dropped))
+				for _, s := range result.Dropped {
+					fmt.Fprintf(&b, "\n  %s [%s]", s.Name, s.ProtocolType)
+				}
+			}
+
+			detail := widget.NewLabel(b.String())
+			detail.Wrapping = fyne.TextWrapWord
+			scroll := container.NewVScroll(detail)
+			scroll.SetMinSize(fyne.NewSize(400, 300))
+			dialog.ShowCustom("过滤规则预览", "确定", scroll, appState.Window)
+		})
+	}()
+}
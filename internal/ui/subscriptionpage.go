@@ -2,6 +2,8 @@ package ui
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -12,8 +14,48 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"myproxy.com/p/internal/database"
+	"myproxy.com/p/internal/logging"
+	"myproxy.com/p/internal/subscription"
 )
 
+// subscriptionIntervalOptions 订阅自动更新间隔选项
+var subscriptionIntervalOptions = []struct {
+	label    string
+	interval time.Duration
+}{
+	{"不自动更新", 0},
+	{"每 1 小时", time.Hour},
+	{"每 6 小时", 6 * time.Hour},
+	{"每 12 小时", 12 * time.Hour},
+	{"每天", 24 * time.Hour},
+	{"每 3 天", 72 * time.Hour},
+}
+
+// newIntervalSelect 创建自动更新间隔选择框，非预设的间隔显示为最接近的较短选项
+func newIntervalSelect(current time.Duration) *widget.Select {
+	labels := make([]string, len(subscriptionIntervalOptions))
+	selected := 0
+	for i, opt := range subscriptionIntervalOptions {
+		labels[i] = opt.label
+		if current >= opt.interval {
+			selected = i
+		}
+	}
+	sel := widget.NewSelect(labels, nil)
+	sel.SetSelected(labels[selected])
+	return sel
+}
+
+// selectedInterval 返回选择框当前选中的自动更新间隔
+func selectedInterval(sel *widget.Select) time.Duration {
+	for _, opt := range subscriptionIntervalOptions {
+		if opt.label == sel.Selected {
+			return opt.interval
+		}
+	}
+	return 0
+}
+
 // SubscriptionPage 订阅管理页面
 type SubscriptionPage struct {
 	appState      *AppState
@@ -51,8 +93,19 @@ func (sp *SubscriptionPage) Build() fyne.CanvasObject {
 	batchUpdateBtn := widget.NewButtonWithIcon("全部更新", theme.ViewRefreshIcon(), sp.batchUpdateSubscriptions)
 	batchUpdateBtn.Importance = widget.LowImportance
 
+	// 从分享链接、文件或二维码导入手动节点
+	importBtn := widget.NewButtonWithIcon("导入节点", theme.DownloadIcon(), func() {
+		showImportServersDialog(sp.appState, func() {
+			if sp.appState.MainWindow != nil {
+				sp.appState.MainWindow.Refresh()
+			}
+		})
+	})
+	importBtn.Importance = widget.LowImportance
+
 	actionToolbar := container.NewHBox(
 		layout.NewSpacer(),
+		importBtn,
 		batchUpdateBtn,
 		addBtn,
 	)
@@ -121,35 +174,61 @@ func (sp *SubscriptionPage) showAddSubscriptionDialog() {
 	urlEntry.SetPlaceHolder("https://...")
 	labelEntry := widget.NewEntry()
 	labelEntry.SetPlaceHolder("订阅名称")
+	intervalSelect := newIntervalSelect(0)
+	fetchForm := newSubscriptionFetchForm(database.SubscriptionFetchOptions{})
 
-	items := []*widget.FormItem{
-		{Text: "名称", Widget: labelEntry},
-		{Text: "链接", Widget: urlEntry},
-	}
+	basicForm := widget.NewForm(
+		widget.NewFormItem("名称", labelEntry),
+		widget.NewFormItem("链接", urlEntry),
+		widget.NewFormItem("自动更新", intervalSelect),
+	)
+	tabs := container.NewAppTabs(
+		container.NewTabItem("基本", basicForm),
+		container.NewTabItem("获取设置", fetchForm.form()),
+	)
 
-	d := dialog.NewForm("添加新订阅", "确定添加", "取消", items, func(ok bool) {
+	d := dialog.NewCustomConfirm("添加新订阅", "确定添加", "取消", tabs, func(ok bool) {
 		if !ok || urlEntry.Text == "" {
 			return
 		}
+		options, err := fetchForm.options()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("请求设置无效: %w", err), sp.appState.Window)
+			return
+		}
 
 		go func() {
 			// 调用创建新订阅的逻辑（不根据URL去重）
-			_, err := database.AddOrUpdateSubscription(urlEntry.Text, labelEntry.Text)
+			sub, err := database.AddOrUpdateSubscription(urlEntry.Text, labelEntry.Text)
 			if err != nil {
 				fyne.Do(func() { dialog.ShowError(err, sp.appState.Window) })
 				return
 			}
-			
-			// 立即执行一次抓取
-			if sp.appState.SubscriptionManager != nil {
-				sp.appState.SubscriptionManager.FetchSubscription(urlEntry.Text, labelEntry.Text)
+			database.SetSubscriptionInterval(sub.ID, selectedInterval(intervalSelect))
+			if err := database.SetSubscriptionFetchOptions(sub.ID, options); err != nil {
+				fyne.Do(func() { dialog.ShowError(err, sp.appState.Window) })
+				return
 			}
 			
-			fyne.Do(func() { sp.Refresh() })
+			// 立即执行一次更新（同时记录更新结果并安排下次自动更新）
+			if sp.appState.SubscriptionManager == nil {
+				fyne.Do(func() { sp.Refresh() })
+				return
+			}
+			diff, err := sp.appState.SubscriptionManager.UpdateSubscription(urlEntry.Text, labelEntry.Text)
+
+			fyne.Do(func() {
+				sp.Refresh()
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("订阅获取失败: %w", err), sp.appState.Window)
+					return
+				}
+				showSubscriptionDiff(sp.appState, sub.DisplayName(), diff)
+			})
 		}()
 	}, sp.appState.Window)
 
-	d.Resize(fyne.NewSize(420, 240))
+	d.Resize(fyne.NewSize(480, 420))
 	d.Show()
 }
 
@@ -161,13 +240,34 @@ func (sp *SubscriptionPage) batchUpdateSubscriptions() {
 		if !ok {
 			return
 		}
+		subscriptions := sp.subscriptions
 		go func() {
-			for _, sub := range sp.subscriptions {
-				if sp.appState.SubscriptionManager != nil {
-					sp.appState.SubscriptionManager.UpdateSubscriptionByID(sub.ID)
+			var results []string
+			for _, sub := range subscriptions {
+				if sp.appState.SubscriptionManager == nil {
+					break
 				}
+				name := sub.DisplayName()
+				diff, err := sp.appState.SubscriptionManager.UpdateSubscriptionByID(sub.ID)
+				if err != nil {
+					if sp.appState.Logger != nil {
+						sp.appState.Logger.Error("订阅 %s 更新失败: %v", name, err)
+					}
+					results = append(results, fmt.Sprintf("%s：更新失败，%v", name, err))
+					continue
+				}
+				if sp.appState.Logger != nil {
+					sp.appState.Logger.InfoWithType(logging.LogTypeApp, "订阅 %s 更新完成，%s", name, diff.Summary())
+				}
+				results = append(results, fmt.Sprintf("%s：%s", name, diff.Summary()))
 			}
-			fyne.Do(func() { sp.Refresh() })
+			fyne.Do(func() {
+				sp.Refresh()
+				if sp.appState.MainWindow != nil {
+					sp.appState.MainWindow.Refresh()
+				}
+				showSubscriptionUpdateResults(sp.appState, results)
+			})
 		}()
 	}, sp.appState.Window)
 }
@@ -180,12 +280,17 @@ type SubscriptionCard struct {
 	sub       *database.Subscription
 	renderObj fyne.CanvasObject
 
-	nameLabel  *widget.Label
-	infoLabel  *widget.Label
-	urlLabel   *widget.Label
-	statusBar  *canvas.Rectangle
+	nameLabel     *widget.Label
+	infoLabel     *widget.Label
+	urlLabel      *widget.Label
+	usageLabel    *widget.Label
+	usageBar      *widget.ProgressBar
+	scheduleLabel *widget.Label
+	statusBar     *canvas.Rectangle
 
 	updateBtn  *widget.Button
+	reparseBtn *widget.Button
+	reportBtn  *widget.Button
 	editBtn    *widget.Button
 	deleteBtn  *widget.Button
 }
@@ -198,6 +303,15 @@ func NewSubscriptionCard(page *SubscriptionPage) *SubscriptionCard {
 	card.urlLabel.Truncation = fyne.TextTruncateEllipsis
 	
 	card.infoLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{})
+
+	// 流量与到期信息，订阅未提供时隐藏
+	card.usageLabel = widget.NewLabel("")
+	card.usageBar = widget.NewProgressBar()
+	card.usageBar.TextFormatter = func() string { return "" }
+
+	// 自动更新计划与最近一次失败信息
+	card.scheduleLabel = widget.NewLabel("")
+	card.scheduleLabel.Truncation = fyne.TextTruncateEllipsis
 	
 	card.statusBar = canvas.NewRectangle(theme.PrimaryColor())
 	card.statusBar.SetMinSize(fyne.NewSize(4, 0))
@@ -206,6 +320,14 @@ func NewSubscriptionCard(page *SubscriptionPage) *SubscriptionCard {
 	card.updateBtn = widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), nil)
 	card.updateBtn.Importance = widget.LowImportance
 	
+	// 从缓存的原始内容重新解析，不访问网络
+	card.reparseBtn = widget.NewButtonWithIcon("", theme.HistoryIcon(), nil)
+	card.reparseBtn.Importance = widget.LowImportance
+
+	// 查看最近一次解析的诊断报告
+	card.reportBtn = widget.NewButtonWithIcon("", theme.ListIcon(), nil)
+	card.reportBtn.Importance = widget.LowImportance
+
 	card.editBtn = widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), nil)
 	card.editBtn.Importance = widget.LowImportance
 
@@ -226,11 +348,16 @@ func (card *SubscriptionCard) setupLayout() fyne.CanvasObject {
 		card.nameLabel,
 		card.urlLabel,
 		container.NewHBox(widget.NewIcon(theme.InfoIcon()), card.infoLabel),
+		card.usageLabel,
+		card.usageBar,
+		card.scheduleLabel,
 	)
 
 	// 右侧按钮组
 	btnBox := container.NewHBox(
 		card.updateBtn,
+		card.reparseBtn,
+		card.reportBtn,
 		card.editBtn,
 		card.deleteBtn,
 	)
@@ -247,7 +374,8 @@ func (card *SubscriptionCard) setupLayout() fyne.CanvasObject {
 
 func (card *SubscriptionCard) Update(sub *database.Subscription) {
 	card.sub = sub
-	card.nameLabel.SetText(sub.Label)
+	name := sub.DisplayName()
+	card.nameLabel.SetText(name)
 	
 	urlDisplay := sub.URL
 	if len(urlDisplay) > 50 {
@@ -257,21 +385,39 @@ func (card *SubscriptionCard) Update(sub *database.Subscription) {
 
 	nodeCount, _ := database.GetServerCountBySubscriptionID(sub.ID)
 	lastUpdate := "从未更新"
-	if !sub.UpdatedAt.IsZero() {
+	if !sub.Schedule.LastSuccessAt.IsZero() {
+		lastUpdate = card.formatTime(sub.Schedule.LastSuccessAt)
+	} else if !sub.UpdatedAt.IsZero() {
 		lastUpdate = card.formatTime(sub.UpdatedAt)
 	}
-	card.infoLabel.SetText(fmt.Sprintf("%d 节点 · 更新于 %s", nodeCount, lastUpdate))
+	info := fmt.Sprintf("%d 节点 · 更新于 %s", nodeCount, lastUpdate)
+	if failed := sub.ParseReport.Failed(); failed > 0 {
+		info = fmt.Sprintf("%s · %d 条无法解析", info, failed)
+	}
+	card.infoLabel.SetText(info)
+	card.updateUsage(sub.Usage)
+	card.updateSchedule(sub.Schedule)
 
 	// 绑定事件 (基于 ID 操作)
-	card.updateBtn.OnTapped = func() {
-		card.updateBtn.Disable()
-		go func() {
-			card.page.appState.SubscriptionManager.UpdateSubscriptionByID(sub.ID)
-			fyne.Do(func() { 
-				card.updateBtn.Enable()
-				card.page.Refresh() 
-			})
-		}()
+	card.updateBtn.OnTapped = func() { card.runUpdate(sub) }
+	card.reparseBtn.OnTapped = func() { card.runReparse(sub) }
+	card.reportBtn.OnTapped = func() { showParseReport(card.page.appState, name, sub.ParseReport) }
+	if sub.ParseReport.ParsedAt.IsZero() {
+		card.reportBtn.Disable()
+	} else {
+		card.reportBtn.Enable()
+	}
+	// 有无法解析的条目时突出显示
+	if sub.ParseReport.Failed() > 0 {
+		card.reportBtn.Importance = widget.WarningImportance
+	} else {
+		card.reportBtn.Importance = widget.LowImportance
+	}
+	card.reportBtn.Refresh()
+	if sub.FetchedAt.IsZero() {
+		card.reparseBtn.Disable()
+	} else {
+		card.reparseBtn.Enable()
 	}
 
 	card.editBtn.OnTapped = card.showEditDialog
@@ -287,24 +433,172 @@ func (card *SubscriptionCard) Update(sub *database.Subscription) {
 	}
 }
 
+// runUpdate 在后台更新订阅，完成后刷新列表并显示节点变化
+func (card *SubscriptionCard) runUpdate(sub *database.Subscription) {
+	card.run(sub, card.updateBtn, "订阅更新失败", card.page.appState.SubscriptionManager.UpdateSubscriptionByID)
+}
+
+// runReparse 在后台用缓存的原始内容重新解析订阅，完成后刷新列表并显示节点变化
+func (card *SubscriptionCard) runReparse(sub *database.Subscription) {
+	card.run(sub, card.reparseBtn, "重新解析失败", card.page.appState.SubscriptionManager.ReparseSubscription)
+}
+
+// run 在后台执行订阅操作，执行期间禁用 btn，完成后刷新列表并显示节点变化或错误
+func (card *SubscriptionCard) run(sub *database.Subscription, btn *widget.Button, failure string, op func(id int64) (*subscription.SubscriptionDiff, error)) {
+	name := sub.DisplayName()
+	btn.Disable()
+	go func() {
+		diff, err := op(sub.ID)
+		fyne.Do(func() {
+			btn.Enable()
+			card.page.Refresh()
+			if card.page.appState.MainWindow != nil {
+				card.page.appState.MainWindow.Refresh()
+			}
+			if err != nil {
+				if card.page.appState.Logger != nil {
+					card.page.appState.Logger.Error("%s（订阅 %s）: %v", failure, name, err)
+				}
+				dialog.ShowError(fmt.Errorf("%s: %w", failure, err), card.page.appState.Window)
+				return
+			}
+			showSubscriptionDiff(card.page.appState, name, diff)
+		})
+	}()
+}
+
+// updateUsage 显示订阅的已用流量和到期时间
+func (card *SubscriptionCard) updateUsage(usage database.SubscriptionUsage) {
+	if usage.UpdatedAt.IsZero() {
+		card.usageLabel.Hide()
+		card.usageBar.Hide()
+		return
+	}
+
+	var parts []string
+	if usage.Total > 0 {
+		parts = append(parts, fmt.Sprintf("已用 %s / %s", formatBytes(usage.Used()), formatBytes(usage.Total)))
+		card.usageBar.SetValue(min(float64(usage.Used())/float64(usage.Total), 1))
+		card.usageBar.Show()
+	} else {
+		parts = append(parts, fmt.Sprintf("已用 %s", formatBytes(usage.Used())))
+		card.usageBar.Hide()
+	}
+	if usage.ExpireAt.IsZero() {
+		parts = append(parts, "长期有效")
+	} else {
+		parts = append(parts, "到期 "+usage.ExpireAt.Format("2006-01-02"))
+	}
+	card.usageLabel.SetText(strings.Join(parts, " · "))
+	card.usageLabel.Show()
+}
+
+// updateSchedule 显示自动更新计划，最近一次更新失败时显示失败原因和重试时间
+func (card *SubscriptionCard) updateSchedule(schedule database.SubscriptionSchedule) {
+	var text string
+	switch {
+	case schedule.Failures > 0:
+		text = fmt.Sprintf("更新失败（连续 %d 次）: %s", schedule.Failures, schedule.LastError)
+		if !schedule.NextUpdateAt.IsZero() {
+			text = fmt.Sprintf("%s · %s 重试", text, schedule.NextUpdateAt.Format("01-02 15:04"))
+		}
+	case schedule.Interval > 0:
+		text = "自动更新"
+		if !schedule.NextUpdateAt.IsZero() {
+			text = fmt.Sprintf("%s · 下次 %s", text, schedule.NextUpdateAt.Format("01-02 15:04"))
+		}
+	}
+
+	if text == "" {
+		card.scheduleLabel.Hide()
+		return
+	}
+	card.scheduleLabel.SetText(text)
+	card.scheduleLabel.Show()
+}
+
 func (card *SubscriptionCard) showEditDialog() {
 	urlEntry := widget.NewEntry()
 	urlEntry.SetText(card.sub.URL)
 	labelEntry := widget.NewEntry()
 	labelEntry.SetText(card.sub.Label)
+	intervalSelect := newIntervalSelect(card.sub.Schedule.Interval)
+	filterForm := newSubscriptionFilterForm(card.sub.Filter)
+	fetchForm := newSubscriptionFetchForm(card.sub.FetchOptions)
+	previewBtn := widget.NewButton("预览保留的节点", func() {
+		options, err := fetchForm.options()
+		if err != nil {
+			dialog.ShowError(err, card.page.appState.Window)
+			return
+		}
+		previewSubscriptionFilter(card.page.appState, urlEntry.Text, options, filterForm.filter())
+	})
 
-	items := []*widget.FormItem{
-		{Text: "名称", Widget: labelEntry},
-		{Text: "链接", Widget: urlEntry},
-	}
+	basicForm := widget.NewForm(
+		widget.NewFormItem("名称", labelEntry),
+		widget.NewFormItem("链接", urlEntry),
+		widget.NewFormItem("自动更新", intervalSelect),
+	)
+	tabs := container.NewAppTabs(
+		container.NewTabItem("基本", basicForm),
+		container.NewTabItem("过滤与重命名", container.NewVBox(widget.NewForm(filterForm.items()...), previewBtn)),
+		container.NewTabItem("获取设置", fetchForm.form()),
+	)
 
-	dialog.ShowForm("编辑订阅", "确认", "取消", items, func(ok bool) {
-		if ok {
-			// 基于唯一 ID 更新，即使 URL 相同也不会冲突
-			database.UpdateSubscriptionByID(card.sub.ID, urlEntry.Text, labelEntry.Text)
+	sub := card.sub
+	window := card.page.appState.Window
+	d := dialog.NewCustomConfirm("编辑订阅", "确认", "取消", tabs, func(ok bool) {
+		if !ok {
+			return
+		}
+		// 基于唯一 ID 更新，即使 URL 相同也不会冲突
+		database.UpdateSubscriptionByID(sub.ID, urlEntry.Text, labelEntry.Text)
+		if interval := selectedInterval(intervalSelect); interval != sub.Schedule.Interval {
+			database.SetSubscriptionInterval(sub.ID, interval)
+		}
+
+		// 请求设置变化后需要重新获取，过滤规则变化只需重建服务器列表
+		refetch, rebuild := false, false
+		if options, err := fetchForm.options(); err != nil {
+			dialog.ShowError(fmt.Errorf("请求设置未保存: %w", err), window)
+		} else if !sameFetchOptions(options, sub.FetchOptions) {
+			if err := database.SetSubscriptionFetchOptions(sub.ID, options); err != nil {
+				dialog.ShowError(err, window)
+			} else {
+				refetch = true
+			}
+		}
+
+		filter := filterForm.filter()
+		if !reflect.DeepEqual(filter, sub.Filter) && !(filter.IsZero() && sub.Filter.IsZero()) {
+			if err := subscription.ValidateFilter(filter); err != nil {
+				dialog.ShowError(fmt.Errorf("过滤规则未保存: %w", err), window)
+			} else if err := database.SetSubscriptionFilter(sub.ID, filter); err != nil {
+				dialog.ShowError(err, window)
+			} else {
+				rebuild = true
+			}
+		}
+
+		switch {
+		case refetch:
+			card.runUpdate(sub)
+		case rebuild && urlEntry.Text == sub.URL && !sub.FetchedAt.IsZero():
+			// 链接未变且有缓存时无需访问网络
+			card.runReparse(sub)
+		case rebuild:
+			card.runUpdate(sub)
+		default:
 			card.page.Refresh()
 		}
-	}, card.page.appState.Window)
+	}, window)
+	d.Resize(fyne.NewSize(560, 460))
+	d.Show()
+}
+
+// sameFetchOptions 比较两份请求设置是否相同（空设置视为相同）
+func sameFetchOptions(a, b database.SubscriptionFetchOptions) bool {
+	return reflect.DeepEqual(a, b) || a.IsZero() && b.IsZero()
 }
 
 func (card *SubscriptionCard) formatTime(t time.Time) string {
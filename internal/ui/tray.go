@@ -72,6 +72,11 @@ func (tm *TrayManager) quit() {
 	if tm.appState.LogsPanel != nil {
 		tm.appState.LogsPanel.Stop()
 	}
+
+	// 停止状态面板的流量刷新
+	if tm.appState.MainWindow != nil && tm.appState.MainWindow.statusPanel != nil {
+		tm.appState.MainWindow.statusPanel.Stop()
+	}
 	
 	// 保存布局配置
 	if tm.appState.MainWindow != nil {
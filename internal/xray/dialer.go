@@ -0,0 +1,155 @@
+package xray
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/dns"
+	"github.com/xtls/xray-core/features/outbound"
+	"github.com/xtls/xray-core/transport/internet"
+)
+
+// coreNewMu 串行化 core.New 与系统拨号器的替换：xray-core 在创建实例时会写入进程全局的
+// 拨号器状态（internet.InitSystemDialer），并发创建测速等临时实例时会产生数据竞争
+var coreNewMu sync.Mutex
+
+// sharedDialer 所有运行中实例共用的系统拨号器依赖。
+// sockopt.dialerProxy（链式代理）按标签从进程全局的出站管理器中查找前置出站，
+// 而 core.New 每次都会将其替换为新实例的管理器，创建测速实例后正在运行的代理就找不到前置出站。
+// 这里登记每个运行中实例的出站管理器，按标签找到所属实例的出站；
+// 每份配置的前置节点出站标签互不相同（见 chainBuilder），不会经由其他实例的前置出站连接。
+// 注意：core.New 执行期间全局拨号器会短暂指向新实例，此时其他实例的前置节点连接会失败，
+// 全局变量的写入在 xray-core 内部，无法加锁，因此 newCoreInstance 只串行化创建并在创建后立即恢复。
+var sharedDialer = &dialerRegistry{}
+
+// dialerEntry 运行中实例的出站管理器和 DNS 客户端
+type dialerEntry struct {
+	owner *XrayInstance
+	obm   outbound.Manager
+	dns   dns.Client
+}
+
+// dialerRegistry 运行中实例的拨号器依赖登记表
+type dialerRegistry struct {
+	mu      sync.RWMutex
+	entries []dialerEntry
+}
+
+// newCoreInstance 创建 xray-core 实例，并将系统拨号器恢复为共用的登记表
+func newCoreInstance(pbConfig *core.Config) (*core.Instance, error) {
+	coreNewMu.Lock()
+	defer coreNewMu.Unlock()
+	instance, err := core.New(pbConfig)
+	if err != nil {
+		return nil, err
+	}
+	internet.InitSystemDialer(sharedDNSClient{sharedDialer}, sharedOutboundManager{sharedDialer})
+	return instance, nil
+}
+
+// add 登记已启动的实例，常驻实例排在临时实例之前
+func (r *dialerRegistry) add(xi *XrayInstance) {
+	obm, _ := xi.instance.GetFeature(outbound.ManagerType()).(outbound.Manager)
+	client, _ := xi.instance.GetFeature(dns.ClientType()).(dns.Client)
+	entry := dialerEntry{owner: xi, obm: obm, dns: client}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if xi.ephemeral {
+		r.entries = append(r.entries, entry)
+		return
+	}
+	i := 0
+	for i < len(r.entries) && !r.entries[i].owner.ephemeral {
+		i++
+	}
+	r.entries = append(r.entries[:i], append([]dialerEntry{entry}, r.entries[i:]...)...)
+}
+
+// remove 移除已停止的实例
+func (r *dialerRegistry) remove(xi *XrayInstance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if e.owner == xi {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot 返回当前登记的实例
+func (r *dialerRegistry) snapshot() []dialerEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]dialerEntry(nil), r.entries...)
+}
+
+// sharedOutboundManager 按标签在所有运行中实例中查找出站，只读
+type sharedOutboundManager struct{ r *dialerRegistry }
+
+func (m sharedOutboundManager) Type() interface{} { return outbound.ManagerType() }
+func (m sharedOutboundManager) Start() error      { return nil }
+func (m sharedOutboundManager) Close() error      { return nil }
+
+// GetHandler 返回包含该标签的运行中实例的出站
+func (m sharedOutboundManager) GetHandler(tag string) outbound.Handler {
+	for _, e := range m.r.snapshot() {
+		if e.obm == nil {
+			continue
+		}
+		if h := e.obm.GetHandler(tag); h != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// GetDefaultHandler 返回优先实例的默认出站
+func (m sharedOutboundManager) GetDefaultHandler() outbound.Handler {
+	for _, e := range m.r.snapshot() {
+		if e.obm != nil {
+			return e.obm.GetDefaultHandler()
+		}
+	}
+	return nil
+}
+
+func (m sharedOutboundManager) AddHandler(ctx context.Context, handler outbound.Handler) error {
+	return fmt.Errorf("共用的出站管理器不支持添加出站")
+}
+
+func (m sharedOutboundManager) RemoveHandler(ctx context.Context, tag string) error {
+	return fmt.Errorf("共用的出站管理器不支持移除出站")
+}
+
+// ListHandlers 返回所有运行中实例的出站
+func (m sharedOutboundManager) ListHandlers(ctx context.Context) []outbound.Handler {
+	var handlers []outbound.Handler
+	for _, e := range m.r.snapshot() {
+		if e.obm != nil {
+			handlers = append(handlers, e.obm.ListHandlers(ctx)...)
+		}
+	}
+	return handlers
+}
+
+// sharedDNSClient 使用优先实例的 DNS 客户端解析域名
+type sharedDNSClient struct{ r *dialerRegistry }
+
+func (c sharedDNSClient) Type() interface{} { return dns.ClientType() }
+func (c sharedDNSClient) Start() error      { return nil }
+func (c sharedDNSClient) Close() error      { return nil }
+
+// LookupIP 使用第一个运行中实例的 DNS 客户端解析域名
+func (c sharedDNSClient) LookupIP(domain string, option dns.IPOption) ([]net.IP, uint32, error) {
+	for _, e := range c.r.snapshot() {
+		if e.dns != nil {
+			return e.dns.LookupIP(domain, option)
+		}
+	}
+	return nil, 0, fmt.Errorf("没有运行中的 xray 实例")
+}
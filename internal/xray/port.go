@@ -0,0 +1,48 @@
+package xray
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ErrPortInUse 端口已被占用
+var ErrPortInUse = errors.New("端口已被占用")
+
+// CheckPortAvailable 检查指定地址和端口是否可以监听
+// 端口被占用时返回包装了 ErrPortInUse 的错误
+func CheckPortAvailable(listenAddr string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("无效的端口: %d", port)
+	}
+	addr := net.JoinHostPort(listenAddr, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %s (%v)", ErrPortInUse, addr, err)
+	}
+	return listener.Close()
+}
+
+// FindFreePort 在指定地址上查找一个空闲端口
+func FindFreePort(listenAddr string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(listenAddr, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("查找空闲端口失败: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// ResolveListenPort 检查端口是否可用，被占用时根据 fallback 决定返回错误或自动选择空闲端口
+// 返回：实际可用的端口
+func ResolveListenPort(listenAddr string, port int, fallback bool) (int, error) {
+	err := CheckPortAvailable(listenAddr, port)
+	if err == nil {
+		return port, nil
+	}
+	if !fallback || !errors.Is(err, ErrPortInUse) {
+		return 0, err
+	}
+	return FindFreePort(listenAddr)
+}
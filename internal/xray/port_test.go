@@ -0,0 +1,38 @@
+package xray
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestResolveListenPort(t *testing.T) {
+	// 占用一个端口
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer listener.Close()
+	busyPort := listener.Addr().(*net.TCPAddr).Port
+
+	if err := CheckPortAvailable("127.0.0.1", busyPort); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("CheckPortAvailable() error = %v, want ErrPortInUse", err)
+	}
+
+	// 不允许回退时返回错误
+	if _, err := ResolveListenPort("127.0.0.1", busyPort, false); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("ResolveListenPort(fallback=false) error = %v, want ErrPortInUse", err)
+	}
+
+	// 允许回退时返回新的空闲端口
+	port, err := ResolveListenPort("127.0.0.1", busyPort, true)
+	if err != nil {
+		t.Fatalf("ResolveListenPort(fallback=true) error = %v", err)
+	}
+	if port == busyPort || port <= 0 {
+		t.Errorf("ResolveListenPort(fallback=true) = %d, want free port other than %d", port, busyPort)
+	}
+	if err := CheckPortAvailable("127.0.0.1", port); err != nil {
+		t.Errorf("回退端口不可用: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package xray
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/core"
+)
+
+// DefaultProbeURL 默认的连通性探测地址（返回 204 空响应）
+const DefaultProbeURL = "https://www.gstatic.com/generate_204"
+
+// ProbeOutbound 通过运行中实例的指定出站访问探测地址，返回请求耗时。
+// 请求直接在进程内分发到出站，不经过本地入站端口，也不受路由规则影响。
+// 参数：
+//   - ctx: 上下文，用于控制超时和取消
+//   - tag: 出站标签，如 "proxy"
+//   - probeURL: 探测地址，为空时使用 DefaultProbeURL
+func (xi *XrayInstance) ProbeOutbound(ctx context.Context, tag, probeURL string) (time.Duration, error) {
+	// 探测可能持续数秒，只在开始时取出实例，不在请求期间持锁阻塞 Stop；
+	// 实例中途停止时拨号会返回错误
+	xi.mu.RLock()
+	instance, running := xi.instance, xi.running()
+	xi.mu.RUnlock()
+	if !running {
+		return 0, fmt.Errorf("xray实例未运行")
+	}
+	if probeURL == "" {
+		probeURL = DefaultProbeURL
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dest, err := xnet.ParseDestination("tcp:" + addr)
+			if err != nil {
+				return nil, fmt.Errorf("解析探测地址失败: %w", err)
+			}
+			// 强制使用指定出站，绕过路由规则
+			return core.Dial(session.SetForcedOutboundTagToContext(ctx, tag), instance, dest)
+		},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建探测请求失败: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("探测请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return 0, fmt.Errorf("探测返回异常状态码: %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,48 @@
+package xray
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+)
+
+func TestProbeOutbound(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	server := &config.Server{Addr: "127.0.0.1", Port: 1, ProtocolType: "socks5"}
+	data, err := CreateXrayConfig(freePort(t), server)
+	if err != nil {
+		t.Fatalf("CreateXrayConfig() error = %v", err)
+	}
+	xi, err := NewXrayInstanceFromJSON(data)
+	if err != nil {
+		t.Fatalf("NewXrayInstanceFromJSON() error = %v", err)
+	}
+	if err := xi.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer xi.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// direct 出站可以直接访问本地服务器
+	if _, err := xi.ProbeOutbound(ctx, "direct", target.URL); err != nil {
+		t.Errorf("ProbeOutbound(direct) error = %v", err)
+	}
+	// proxy 出站指向不可用的 SOCKS5 服务器，应探测失败
+	if _, err := xi.ProbeOutbound(ctx, "proxy", target.URL); err == nil {
+		t.Errorf("ProbeOutbound(proxy) error = nil, want error")
+	}
+	// block 出站丢弃所有流量
+	if _, err := xi.ProbeOutbound(ctx, "block", target.URL); err == nil {
+		t.Errorf("ProbeOutbound(block) error = nil, want error")
+	}
+}
@@ -0,0 +1,133 @@
+package xray
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/features/stats"
+)
+
+// TrafficStat 单个入站或出站的流量统计
+type TrafficStat struct {
+	Tag          string // 入站/出站标签
+	Uplink       int64  // 累计上行字节数
+	Downlink     int64  // 累计下行字节数
+	UplinkRate   int64  // 上行速率（字节/秒）
+	DownlinkRate int64  // 下行速率（字节/秒）
+}
+
+// TrafficStats 某一时刻的流量快照
+type TrafficStats struct {
+	Inbounds  map[string]*TrafficStat // 按入站标签索引
+	Outbounds map[string]*TrafficStat // 按出站标签索引
+	Time      time.Time               // 快照时间
+}
+
+// TotalUplinkRate 返回所有入站的上行速率之和（字节/秒）
+// 使用入站统计：直连出站在 Linux 下可能走 splice 零拷贝，出站计数器不完整
+func (ts *TrafficStats) TotalUplinkRate() int64 {
+	var total int64
+	for _, stat := range ts.Inbounds {
+		total += stat.UplinkRate
+	}
+	return total
+}
+
+// TotalDownlinkRate 返回所有入站的下行速率之和（字节/秒）
+func (ts *TrafficStats) TotalDownlinkRate() int64 {
+	var total int64
+	for _, stat := range ts.Inbounds {
+		total += stat.DownlinkRate
+	}
+	return total
+}
+
+// counterVisitor 由 app/stats.Manager 实现，用于遍历所有计数器
+type counterVisitor interface {
+	VisitCounters(func(string, stats.Counter) bool)
+}
+
+// GetTrafficStats 读取进程内统计管理器，返回各入站/出站的累计流量和每秒速率。
+// 速率根据与上一次调用之间的差值计算，第一次调用时速率为 0。
+// 需要配置中启用 stats 和 policy.system（CreateXrayConfig 默认启用）。
+func (xi *XrayInstance) GetTrafficStats() (*TrafficStats, error) {
+	xi.mu.RLock()
+	defer xi.mu.RUnlock()
+	if !xi.running() {
+		return nil, fmt.Errorf("xray实例未运行")
+	}
+
+	feature := xi.instance.GetFeature(stats.ManagerType())
+	visitor, ok := feature.(counterVisitor)
+	if !ok {
+		return nil, fmt.Errorf("xray实例未启用流量统计")
+	}
+
+	current := &TrafficStats{
+		Inbounds:  make(map[string]*TrafficStat),
+		Outbounds: make(map[string]*TrafficStat),
+		Time:      time.Now(),
+	}
+
+	// 计数器名称格式：inbound>>>tag>>>traffic>>>uplink
+	visitor.VisitCounters(func(name string, counter stats.Counter) bool {
+		parts := strings.Split(name, ">>>")
+		if len(parts) != 4 || parts[2] != "traffic" {
+			return true
+		}
+
+		var group map[string]*TrafficStat
+		switch parts[0] {
+		case "inbound":
+			group = current.Inbounds
+		case "outbound":
+			group = current.Outbounds
+		default:
+			return true
+		}
+
+		stat, exists := group[parts[1]]
+		if !exists {
+			stat = &TrafficStat{Tag: parts[1]}
+			group[parts[1]] = stat
+		}
+		switch parts[3] {
+		case "uplink":
+			stat.Uplink = counter.Value()
+		case "downlink":
+			stat.Downlink = counter.Value()
+		}
+		return true
+	})
+
+	xi.statsMu.Lock()
+	defer xi.statsMu.Unlock()
+
+	// 根据上一次快照计算速率
+	if last := xi.lastTraffic; last != nil {
+		if elapsed := current.Time.Sub(last.Time).Seconds(); elapsed > 0 {
+			calcRates(current.Inbounds, last.Inbounds, elapsed)
+			calcRates(current.Outbounds, last.Outbounds, elapsed)
+		}
+	}
+	xi.lastTraffic = current
+
+	return current, nil
+}
+
+// calcRates 根据两次快照的差值计算每秒速率
+func calcRates(current, last map[string]*TrafficStat, elapsed float64) {
+	for tag, stat := range current {
+		prev, ok := last[tag]
+		if !ok {
+			continue
+		}
+		if delta := stat.Uplink - prev.Uplink; delta > 0 {
+			stat.UplinkRate = int64(float64(delta) / elapsed)
+		}
+		if delta := stat.Downlink - prev.Downlink; delta > 0 {
+			stat.DownlinkRate = int64(float64(delta) / elapsed)
+		}
+	}
+}
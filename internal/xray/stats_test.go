@@ -0,0 +1,73 @@
+package xray
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"myproxy.com/p/internal/config"
+)
+
+func TestGetTrafficStats(t *testing.T) {
+	// 本地 HTTP 服务器，作为代理访问的目标
+	body := []byte("hello")
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer target.Close()
+
+	port := freePort(t)
+
+	// 直连模式下流量走 direct 出站，不依赖远程服务器
+	server := &config.Server{Addr: "127.0.0.1", Port: 1, ProtocolType: "socks5"}
+	data, err := CreateXrayConfigWithOptions(port, server, ConfigOptions{RoutingMode: config.RoutingModeDirect})
+	if err != nil {
+		t.Fatalf("CreateXrayConfigWithOptions() error = %v", err)
+	}
+	xi, err := NewXrayInstanceFromJSON(data)
+	if err != nil {
+		t.Fatalf("NewXrayInstanceFromJSON() error = %v", err)
+	}
+	if err := xi.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer xi.Stop()
+
+	if _, err := xi.GetTrafficStats(); err != nil {
+		t.Fatalf("GetTrafficStats() error = %v", err)
+	}
+
+	proxyURL, _ := url.Parse(fmt.Sprintf("socks5://127.0.0.1:%d", port))
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   5 * time.Second,
+	}
+	resp, err := client.Get(target.URL)
+	if err != nil {
+		t.Fatalf("通过代理请求失败: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	time.Sleep(200 * time.Millisecond)
+	ts, err := xi.GetTrafficStats()
+	if err != nil {
+		t.Fatalf("GetTrafficStats() error = %v", err)
+	}
+
+	// 直连出站在 Linux 下可能走 splice 零拷贝，响应体不一定计入，只检查请求方向
+	if in, ok := ts.Inbounds["socks-in"]; !ok || in.Uplink <= 0 {
+		t.Errorf("socks-in 上行流量 = %+v, want > 0", in)
+	}
+	if out, ok := ts.Outbounds["direct"]; !ok || out.Uplink <= 0 {
+		t.Errorf("direct 上行流量 = %+v, want > 0", out)
+	}
+	if ts.TotalUplinkRate() <= 0 {
+		t.Errorf("TotalUplinkRate() = %d, want > 0", ts.TotalUplinkRate())
+	}
+}
@@ -0,0 +1,46 @@
+package xray
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"myproxy.com/p/internal/config"
+)
+
+// URLTestInboundTag 测速配置的本地入站标签
+const URLTestInboundTag = "test-in"
+
+// CreateURLTestConfig 创建节点测速用的最小 xray 配置。
+// 本地 SOCKS5 入站（仅监听 127.0.0.1）的全部流量都经由节点出站，不经过路由规则，
+// 节点设置了前置节点时同时生成前置节点出站。
+// 参数：
+//   - localPort: 本地 SOCKS5 监听端口
+//   - server: 待测试的服务器
+//   - servers: 用于解析前置节点链的服务器列表（可为空）
+func CreateURLTestConfig(localPort int, server *config.Server, servers []config.Server) ([]byte, error) {
+	outbound, err := CreateOutboundFromServer(server)
+	if err != nil {
+		return nil, fmt.Errorf("创建出站配置失败: %w", err)
+	}
+	hops, err := newChainBuilder().build(outbound, server, servers)
+	if err != nil {
+		return nil, fmt.Errorf("创建前置节点出站失败: %w", err)
+	}
+
+	// 没有路由规则时，所有流量使用第一个出站（即节点出站）
+	testConfig := map[string]interface{}{
+		"inbounds": []interface{}{
+			map[string]interface{}{
+				"tag":      URLTestInboundTag,
+				"listen":   config.DefaultListenAddr,
+				"port":     localPort,
+				"protocol": "socks",
+				"settings": map[string]interface{}{
+					"auth": "noauth",
+				},
+			},
+		},
+		"outbounds": append([]interface{}{outbound}, hops...),
+	}
+	return json.Marshal(testConfig)
+}
@@ -4,13 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	// 导入所有 xray-core 组件，注册必要的处理器
 	_ "github.com/xtls/xray-core/main/distro/all"
 
+	applog "github.com/xtls/xray-core/app/log"
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/common/platform"
+	"github.com/xtls/xray-core/common/serial"
 	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/outbound"
+	"github.com/xtls/xray-core/features/routing"
 	"github.com/xtls/xray-core/infra/conf"
 	"myproxy.com/p/internal/config"
 )
@@ -136,13 +145,20 @@ func (lw *logWriter) shouldFilterLog(line string) bool {
 
 // XrayInstance 封装 xray-core 实例
 type XrayInstance struct {
+	mu          sync.RWMutex // 保护 instance、ctx 和运行状态：Start/Stop 持写锁，使用实例的操作持读锁
 	instance    *core.Instance
 	ctx         context.Context
 	cancel      context.CancelFunc
 	isRunning   bool        // 运行状态
+	closed      bool        // 是否已释放 xray-core 实例
 	port        int         // 监听端口
+	httpPort    int         // 独立 HTTP 代理端口（0 表示未启用）
 	logWriter   *logWriter  // 日志写入器
 	logCallback LogCallback // 日志回调函数
+	ephemeral   bool        // 是否为测速等临时实例
+
+	statsMu     sync.Mutex    // 保护流量快照
+	lastTraffic *TrafficStats // 上一次流量快照，用于计算速率
 }
 
 // NewXrayInstanceFromJSON 从 JSON 配置创建 xray-core 实例
@@ -152,6 +168,41 @@ func NewXrayInstanceFromJSON(configJSON []byte) (*XrayInstance, error) {
 
 // NewXrayInstanceFromJSONWithCallback 从 JSON 配置创建 xray-core 实例，并设置日志回调
 func NewXrayInstanceFromJSONWithCallback(configJSON []byte, logCallback LogCallback) (*XrayInstance, error) {
+	pbConfig, err := buildCoreConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	return newXrayInstance(pbConfig, logCallback)
+}
+
+// NewEphemeralInstance 从 JSON 配置创建临时 xray-core 实例（用于测速等短时任务）。
+// xray-core 的日志模块是进程全局的，临时实例不加载日志模块，
+// 避免替换正在运行的代理实例的日志输出。
+func NewEphemeralInstance(configJSON []byte) (*XrayInstance, error) {
+	pbConfig, err := buildCoreConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	logType := serial.GetMessageType(&applog.Config{})
+	apps := pbConfig.App[:0]
+	for _, app := range pbConfig.App {
+		if app.Type != logType {
+			apps = append(apps, app)
+		}
+	}
+	pbConfig.App = apps
+
+	xi, err := newXrayInstance(pbConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+	xi.ephemeral = true
+	return xi, nil
+}
+
+// buildCoreConfig 将 JSON 配置解析并构建为 xray-core 配置
+func buildCoreConfig(configJSON []byte) (*core.Config, error) {
 	var config conf.Config
 	if err := json.Unmarshal(configJSON, &config); err != nil {
 		return nil, fmt.Errorf("解析配置失败: %w", err)
@@ -161,8 +212,12 @@ func NewXrayInstanceFromJSONWithCallback(configJSON []byte, logCallback LogCallb
 	if err != nil {
 		return nil, fmt.Errorf("构建配置失败: %w", err)
 	}
+	return pbConfig, nil
+}
 
-	instance, err := core.New(pbConfig)
+// newXrayInstance 根据已构建的配置创建 xray-core 实例
+func newXrayInstance(pbConfig *core.Config, logCallback LogCallback) (*XrayInstance, error) {
+	instance, err := newCoreInstance(pbConfig)
 	if err != nil {
 		return nil, fmt.Errorf("创建实例失败: %w", err)
 	}
@@ -195,22 +250,34 @@ func (xi *XrayInstance) SetLogCallback(callback LogCallback) {
 
 // Start 启动 xray-core 实例
 func (xi *XrayInstance) Start() error {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
 	if xi.isRunning {
 		return fmt.Errorf("xray实例已经在运行")
 	}
+	if xi.closed {
+		return fmt.Errorf("xray实例已经停止")
+	}
 	if err := xi.instance.Start(); err != nil {
 		return fmt.Errorf("启动失败: %w", err)
 	}
 	xi.isRunning = true
+	sharedDialer.add(xi)
 	return nil
 }
 
-// Stop 停止 xray-core 实例
+// Stop 停止 xray-core 实例并释放资源，启动失败的实例也需要调用。可重复调用
 func (xi *XrayInstance) Stop() error {
-	if !xi.isRunning {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	if xi.closed {
 		return nil // 已经停止，直接返回
 	}
-	xi.isRunning = false
+	xi.closed = true
+	if xi.isRunning {
+		xi.isRunning = false
+		sharedDialer.remove(xi)
+	}
 	xi.cancel()
 	if xi.instance != nil {
 		xi.instance.Close()
@@ -220,6 +287,13 @@ func (xi *XrayInstance) Stop() error {
 
 // IsRunning 检查 xray 实例是否在运行
 func (xi *XrayInstance) IsRunning() bool {
+	xi.mu.RLock()
+	defer xi.mu.RUnlock()
+	return xi.running()
+}
+
+// running 检查实例是否在运行，调用方需持有 xi.mu
+func (xi *XrayInstance) running() bool {
 	return xi.isRunning && xi.instance != nil
 }
 
@@ -233,11 +307,114 @@ func (xi *XrayInstance) GetPort() int {
 	return xi.port
 }
 
+// SetHTTPPort 设置独立 HTTP 代理端口
+func (xi *XrayInstance) SetHTTPPort(port int) {
+	xi.httpPort = port
+}
+
+// GetHTTPPort 获取独立 HTTP 代理端口，0 表示未启用
+func (xi *XrayInstance) GetHTTPPort() int {
+	return xi.httpPort
+}
+
 // GetInstance 获取底层 xray-core 实例（用于高级操作）
 func (xi *XrayInstance) GetInstance() *core.Instance {
+	xi.mu.RLock()
+	defer xi.mu.RUnlock()
 	return xi.instance
 }
 
+// SwapOutbound 在不重启 xray 实例的情况下，将 "proxy" 出站替换为指定服务器。
+// 入站监听和其他出站（direct/block）保持不变，已建立的直连连接不受影响。
+// 返回错误时调用方应回退为完整重启。
+func (xi *XrayInstance) SwapOutbound(server *config.Server) error {
+	// 链式代理需要同时生成前置节点出站，只能通过完整重启应用
+	if server.UpstreamID != "" {
+		return fmt.Errorf("节点 %s 使用了前置节点，无法原地切换", server.Name)
+	}
+
+	// 整个替换过程持有读锁，避免与 Stop 并发时使用已关闭的实例
+	xi.mu.RLock()
+	defer xi.mu.RUnlock()
+	if !xi.running() {
+		return fmt.Errorf("xray实例未运行")
+	}
+
+	// 先完整构建新的出站配置，确保替换前配置有效
+	outboundConfig, err := CreateOutboundFromServer(server)
+	if err != nil {
+		return fmt.Errorf("创建出站配置失败: %w", err)
+	}
+	handlerConfig, err := buildOutboundHandler(outboundConfig)
+	if err != nil {
+		return err
+	}
+
+	manager, ok := xi.instance.GetFeature(outbound.ManagerType()).(outbound.Manager)
+	if !ok {
+		return fmt.Errorf("获取出站管理器失败")
+	}
+
+	// 移除旧的出站，再添加新的出站
+	// 负载均衡模式下没有单一的 proxy 出站，无法原地切换
+	oldHandler := manager.GetHandler(handlerConfig.Tag)
+	if oldHandler == nil {
+		return fmt.Errorf("当前配置中没有 %s 出站（可能处于负载均衡模式）", handlerConfig.Tag)
+	}
+	if err := manager.RemoveHandler(xi.ctx, handlerConfig.Tag); err != nil {
+		return fmt.Errorf("移除旧出站失败: %w", err)
+	}
+	if err := core.AddOutboundHandler(xi.instance, handlerConfig); err != nil {
+		// 添加失败时尝试恢复旧的出站
+		manager.AddHandler(xi.ctx, oldHandler)
+		return fmt.Errorf("添加新出站失败: %w", err)
+	}
+
+	// 释放旧出站的资源
+	common.Close(oldHandler)
+
+	return nil
+}
+
+// GetBalancerTarget 获取负载均衡器当前优先选择的节点 ID。
+// 仅 leastPing/leastLoad 策略有明确的优先节点，其他策略返回候选列表中的第一个节点。
+func (xi *XrayInstance) GetBalancerTarget() (string, error) {
+	xi.mu.RLock()
+	defer xi.mu.RUnlock()
+	if !xi.running() {
+		return "", fmt.Errorf("xray实例未运行")
+	}
+	principle, ok := xi.instance.GetFeature(routing.RouterType()).(routing.BalancerPrincipleTarget)
+	if !ok {
+		return "", fmt.Errorf("路由器不支持查询负载均衡目标")
+	}
+	targets, err := principle.GetPrincipleTarget(BalancerTag)
+	if err != nil {
+		return "", fmt.Errorf("查询负载均衡目标失败: %w", err)
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("负载均衡器暂无可用节点")
+	}
+	return strings.TrimPrefix(targets[0], BalancerOutboundTag), nil
+}
+
+// buildOutboundHandler 将出站配置构建为 xray-core 出站处理器配置，用于在使用前校验配置
+func buildOutboundHandler(outboundConfig map[string]interface{}) (*core.OutboundHandlerConfig, error) {
+	data, err := json.Marshal(outboundConfig)
+	if err != nil {
+		return nil, fmt.Errorf("序列化出站配置失败: %w", err)
+	}
+	var detour conf.OutboundDetourConfig
+	if err := json.Unmarshal(data, &detour); err != nil {
+		return nil, fmt.Errorf("解析出站配置失败: %w", err)
+	}
+	handlerConfig, err := detour.Build()
+	if err != nil {
+		return nil, fmt.Errorf("构建出站配置失败: %w", err)
+	}
+	return handlerConfig, nil
+}
+
 // CreateOutboundFromServer 根据服务器配置创建 xray 出站配置
 func CreateOutboundFromServer(server *config.Server) (map[string]interface{}, error) {
 	var outbound map[string]interface{}
@@ -271,6 +448,29 @@ func CreateOutboundFromServer(server *config.Server) (map[string]interface{}, er
 			"settings": socksConfig,
 		}
 
+	case "http":
+		// 创建 HTTP 代理出站配置
+		httpServer := map[string]interface{}{
+			"address": server.Addr,
+			"port":    server.Port,
+		}
+		if server.Username != "" && server.Password != "" {
+			httpServer["users"] = []map[string]string{
+				{
+					"user": server.Username,
+					"pass": server.Password,
+				},
+			}
+		}
+
+		outbound = map[string]interface{}{
+			"tag":      "proxy",
+			"protocol": "http",
+			"settings": map[string]interface{}{
+				"servers": []map[string]interface{}{httpServer},
+			},
+		}
+
 	case "vmess":
 		// 创建 VMess 出站配置
 		vmessConfig := map[string]interface{}{
@@ -344,24 +544,35 @@ func CreateOutboundFromServer(server *config.Server) (map[string]interface{}, er
 		}
 
 		// 设置 ALPN
-		if server.TrojanAlpn != "" {
-			// ALPN 应该是字符串数组
-			alpnArray := []string{}
-			for _, alpn := range strings.Split(server.TrojanAlpn, ",") {
-				if alpn = strings.TrimSpace(alpn); alpn != "" {
-					alpnArray = append(alpnArray, alpn)
-				}
-			}
-			if len(alpnArray) > 0 {
-				tlsSettings["alpn"] = alpnArray
-			}
+		if alpnArray := splitAlpn(server.TrojanAlpn); len(alpnArray) > 0 {
+			tlsSettings["alpn"] = alpnArray
 		}
 
 		streamSettings := map[string]interface{}{
+			"network":     "tcp",
 			"security":    security,
 			"tlsSettings": tlsSettings,
 		}
 
+		// 传输协议：默认 TCP，支持 WebSocket 和 gRPC
+		switch server.TrojanNetwork {
+		case "ws", "websocket":
+			wsSettings := map[string]interface{}{}
+			if server.TrojanHost != "" {
+				wsSettings["host"] = server.TrojanHost
+			}
+			if server.TrojanPath != "" {
+				wsSettings["path"] = server.TrojanPath
+			}
+			streamSettings["network"] = "ws"
+			streamSettings["wsSettings"] = wsSettings
+		case "grpc":
+			streamSettings["network"] = "grpc"
+			streamSettings["grpcSettings"] = map[string]interface{}{
+				"serviceName": server.TrojanPath,
+			}
+		}
+
 		trojanConfig := map[string]interface{}{
 			"servers": []map[string]interface{}{
 				{
@@ -379,6 +590,37 @@ func CreateOutboundFromServer(server *config.Server) (map[string]interface{}, er
 			"streamSettings": streamSettings,
 		}
 
+	case "vless":
+		// 创建 VLESS 出站配置
+		user := map[string]interface{}{
+			"id":         server.VLESSUUID,
+			"encryption": getVLESSEncryption(server.VLESSEncryption),
+		}
+		// Vision 流控只在 TCP + TLS/REALITY 下有效
+		if server.VLESSFlow != "" {
+			user["flow"] = server.VLESSFlow
+		}
+
+		vlessConfig := map[string]interface{}{
+			"vnext": []map[string]interface{}{
+				{
+					"address": server.Addr,
+					"port":    server.Port,
+					"users":   []map[string]interface{}{user},
+				},
+			},
+		}
+
+		// 构建 streamSettings（传输协议与安全层配置）
+		streamSettings := buildVLESSStreamSettings(server)
+
+		outbound = map[string]interface{}{
+			"tag":            "proxy",
+			"protocol":       "vless",
+			"settings":       vlessConfig,
+			"streamSettings": streamSettings,
+		}
+
 	default:
 		return nil, fmt.Errorf("不支持的协议类型: %s", server.ProtocolType)
 	}
@@ -402,6 +644,26 @@ func buildVMessStreamSettings(server *config.Server) map[string]interface{} {
 
 	// 根据传输协议类型设置不同的配置
 	switch server.VMessNetwork {
+	case "", "tcp":
+		// TCP HTTP 伪装
+		if server.VMessType == "http" {
+			request := map[string]interface{}{}
+			if server.VMessHost != "" {
+				request["headers"] = map[string]interface{}{
+					"Host": []string{server.VMessHost},
+				}
+			}
+			if server.VMessPath != "" {
+				request["path"] = []string{server.VMessPath}
+			}
+			streamSettings["tcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{
+					"type":    "http",
+					"request": request,
+				},
+			}
+		}
+
 	case "ws", "websocket":
 		wsSettings := map[string]interface{}{}
 		if server.VMessHost != "" {
@@ -439,9 +701,12 @@ func buildVMessStreamSettings(server *config.Server) map[string]interface{} {
 	// TLS 配置
 	if server.VMessTLS == "tls" {
 		tlsSettings := map[string]interface{}{
-			"allowInsecure": false,
+			"allowInsecure": server.VMessAllowInsecure,
 		}
-		if server.VMessHost != "" {
+		// 优先使用单独设置的 SNI，否则使用伪装域名
+		if server.VMessSNI != "" {
+			tlsSettings["serverName"] = server.VMessSNI
+		} else if server.VMessHost != "" {
 			tlsSettings["serverName"] = server.VMessHost
 		}
 		streamSettings["security"] = "tls"
@@ -459,6 +724,130 @@ func getVMessNetwork(network string) string {
 	return network
 }
 
+// getVLESSEncryption 获取 VLESS 加密方式，默认为 "none"
+func getVLESSEncryption(encryption string) string {
+	if encryption == "" {
+		return "none"
+	}
+	return encryption
+}
+
+// splitAlpn 将逗号分隔的 ALPN 字符串转换为字符串数组
+func splitAlpn(alpn string) []string {
+	alpnArray := []string{}
+	for _, item := range strings.Split(alpn, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			alpnArray = append(alpnArray, item)
+		}
+	}
+	return alpnArray
+}
+
+// buildVLESSStreamSettings 构建 VLESS 传输协议配置
+// 支持 tcp/ws/grpc/httpupgrade/xhttp 传输，以及 tls/reality 安全层
+func buildVLESSStreamSettings(server *config.Server) map[string]interface{} {
+	network := server.VLESSNetwork
+	if network == "" {
+		network = "tcp"
+	}
+	streamSettings := map[string]interface{}{
+		"network": network,
+	}
+
+	// 根据传输协议类型设置不同的配置
+	switch network {
+	case "tcp", "raw":
+		// TCP HTTP 伪装
+		if server.VLESSHeaderType == "http" {
+			request := map[string]interface{}{}
+			if server.VLESSHost != "" {
+				request["headers"] = map[string]interface{}{
+					"Host": []string{server.VLESSHost},
+				}
+			}
+			if server.VLESSPath != "" {
+				request["path"] = []string{server.VLESSPath}
+			}
+			streamSettings["tcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{
+					"type":    "http",
+					"request": request,
+				},
+			}
+		}
+
+	case "ws", "httpupgrade", "xhttp", "splithttp":
+		transportSettings := map[string]interface{}{}
+		if server.VLESSHost != "" {
+			transportSettings["host"] = server.VLESSHost
+		}
+		if server.VLESSPath != "" {
+			transportSettings["path"] = server.VLESSPath
+		}
+		if len(transportSettings) > 0 {
+			key := map[string]string{
+				"ws":          "wsSettings",
+				"httpupgrade": "httpupgradeSettings",
+				"xhttp":       "xhttpSettings",
+				"splithttp":   "xhttpSettings",
+			}[network]
+			streamSettings[key] = transportSettings
+		}
+
+	case "grpc":
+		grpcSettings := map[string]interface{}{}
+		if server.VLESSPath != "" {
+			grpcSettings["serviceName"] = server.VLESSPath
+		}
+		if len(grpcSettings) > 0 {
+			streamSettings["grpcSettings"] = grpcSettings
+		}
+	}
+
+	// 安全层配置
+	switch server.VLESSSecurity {
+	case "tls":
+		tlsSettings := map[string]interface{}{
+			"allowInsecure": server.VLESSAllowInsecure,
+		}
+		serverName := server.VLESSSNI
+		if serverName == "" {
+			serverName = server.VLESSHost
+		}
+		if serverName != "" {
+			tlsSettings["serverName"] = serverName
+		}
+		if server.VLESSFingerprint != "" {
+			tlsSettings["fingerprint"] = server.VLESSFingerprint
+		}
+		if alpnArray := splitAlpn(server.VLESSAlpn); len(alpnArray) > 0 {
+			tlsSettings["alpn"] = alpnArray
+		}
+		streamSettings["security"] = "tls"
+		streamSettings["tlsSettings"] = tlsSettings
+
+	case "reality":
+		// REALITY 必须使用 uTLS 指纹，未指定时默认使用 chrome
+		fingerprint := server.VLESSFingerprint
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		realitySettings := map[string]interface{}{
+			"serverName":  server.VLESSSNI,
+			"fingerprint": fingerprint,
+			"publicKey":   server.VLESSPublicKey,
+			"shortId":     server.VLESSShortID,
+		}
+		if server.VLESSSpiderX != "" {
+			realitySettings["spiderX"] = server.VLESSSpiderX
+		}
+		streamSettings["security"] = "reality"
+		streamSettings["realitySettings"] = realitySettings
+	}
+
+	return streamSettings
+}
+
 // buildSSStreamSettings 构建 Shadowsocks 传输协议配置
 func buildSSStreamSettings(server *config.Server) map[string]interface{} {
 	// 默认使用 tcp
@@ -473,31 +862,136 @@ func buildSSStreamSettings(server *config.Server) map[string]interface{} {
 	return streamSettings
 }
 
+// ConfigOptions 创建 xray 配置时的可选项
+type ConfigOptions struct {
+	// RoutingMode 路由模式: config.RoutingModeDirect / RoutingModeGlobal / RoutingModeSmart
+	// 为空时按全局模式处理，与旧版本行为保持一致
+	RoutingMode string
+	// ListenAddr 本地监听地址，为空时使用 127.0.0.1
+	ListenAddr string
+	// HTTPPort 独立的 HTTP 代理端口，0 表示不创建（SOCKS5 端口本身也接受 HTTP 请求）
+	HTTPPort int
+	// Accounts 本地入站认证账户，为空时不认证
+	Accounts []config.InboundAccount
+	// AllowedSources 允许访问本地入站的来源 IP/CIDR，为空时不限制
+	// 本机回环地址始终允许，其他来源的流量路由到 block 出站
+	AllowedSources []string
+	// BalancerServers 负载均衡节点组，非空时为每个节点生成出站（标签为 "proxy-" + ID），
+	// 并由 "balancer" 负载均衡器替代单一的 "proxy" 出站，此时 server 参数被忽略
+	BalancerServers []*config.Server
+	// BalancerStrategy 负载均衡策略: random, roundRobin, leastPing, leastLoad，为空时使用 leastPing
+	BalancerStrategy string
+	// Servers 用于解析前置节点（链式代理）的服务器列表。
+	// 节点设置了 UpstreamID 时，会为链上每个前置节点生成出站（标签为 "chain-<序号>-" + ID，
+	// 序号在每次生成配置时分配），并通过 sockopt.dialerProxy 逐跳连接
+	Servers []config.Server
+}
+
+// 负载均衡相关标签
+const (
+	BalancerTag          = "balancer" // 负载均衡器标签
+	BalancerOutboundTag  = "proxy-"   // 负载均衡节点出站标签前缀
+	ChainOutboundTag     = "chain-"   // 链式代理前置节点出站标签前缀
+	balancerProbeURL     = "https://www.gstatic.com/generate_204"
+	balancerProbeTimeout = "5s"
+)
+
 // CreateXrayConfig 创建完整的 xray 配置
 // localPort: 本地 SOCKS5 监听端口（默认 10080）
 // server: 服务器配置，用于创建出站配置
 // logFilePath: 日志文件路径（可选，如果为空则不设置日志文件）
 func CreateXrayConfig(localPort int, server *config.Server, logFilePath ...string) ([]byte, error) {
+	return CreateXrayConfigWithOptions(localPort, server, ConfigOptions{}, logFilePath...)
+}
+
+// CreateXrayConfigWithOptions 创建完整的 xray 配置，并应用路由模式等可选项
+// localPort: 本地 SOCKS5 监听端口（默认 10080）
+// server: 服务器配置，用于创建出站配置
+// opts: 配置可选项
+// logFilePath: 日志文件路径（可选，如果为空则不设置日志文件）
+func CreateXrayConfigWithOptions(localPort int, server *config.Server, opts ConfigOptions, logFilePath ...string) ([]byte, error) {
 	if localPort == 0 {
 		localPort = 10080
 	}
 
-	// 创建入站配置（本地 SOCKS5 服务器）
-	inbound := map[string]interface{}{
-		"tag":      "socks-in",
-		"port":     localPort,
-		"protocol": "socks",
-		"settings": map[string]interface{}{
-			"auth": "noauth",
-			"udp":  true,
+	listenAddr := opts.ListenAddr
+	if listenAddr == "" {
+		listenAddr = config.DefaultListenAddr
+	}
+
+	// 创建入站配置（本地混合端口：SOCKS5 入站同时识别 HTTP 代理请求）
+	socksSettings := map[string]interface{}{
+		"auth": "noauth",
+		"udp":  true,
+	}
+	httpSettings := map[string]interface{}{}
+
+	// 配置了认证账户时，SOCKS5 和 HTTP 入站都需要用户名密码
+	if len(opts.Accounts) > 0 {
+		accounts := make([]map[string]string, 0, len(opts.Accounts))
+		for _, account := range opts.Accounts {
+			accounts = append(accounts, map[string]string{
+				"user": account.User,
+				"pass": account.Pass,
+			})
+		}
+		socksSettings["auth"] = "password"
+		socksSettings["accounts"] = accounts
+		httpSettings["accounts"] = accounts
+	}
+
+	inbounds := []interface{}{
+		map[string]interface{}{
+			"tag":      "socks-in",
+			"listen":   listenAddr,
+			"port":     localPort,
+			"protocol": "socks",
+			"settings": socksSettings,
 		},
 	}
 
-	// 创建出站配置
-	outbound, err := CreateOutboundFromServer(server)
-	if err != nil {
-		return nil, fmt.Errorf("创建出站配置失败: %w", err)
+	// 独立的 HTTP 代理入站
+	if opts.HTTPPort > 0 && opts.HTTPPort != localPort {
+		inbounds = append(inbounds, map[string]interface{}{
+			"tag":      "http-in",
+			"listen":   listenAddr,
+			"port":     opts.HTTPPort,
+			"protocol": "http",
+			"settings": httpSettings,
+		})
+	}
+
+	// 创建出站配置（负载均衡模式下为每个节点生成一个出站）
+	// 前置节点出站统一追加在节点出站之后，多个节点共用的前置节点只生成一次
+	var proxyOutbounds, chainOutbounds []interface{}
+	chain := newChainBuilder()
+	if len(opts.BalancerServers) > 0 {
+		for _, srv := range opts.BalancerServers {
+			outbound, err := CreateOutboundFromServer(srv)
+			if err != nil {
+				return nil, fmt.Errorf("创建出站配置失败 (%s): %w", srv.Name, err)
+			}
+			outbound["tag"] = BalancerOutboundTag + srv.ID
+			hops, err := chain.build(outbound, srv, opts.Servers)
+			if err != nil {
+				return nil, fmt.Errorf("创建前置节点出站失败 (%s): %w", srv.Name, err)
+			}
+			proxyOutbounds = append(proxyOutbounds, outbound)
+			chainOutbounds = append(chainOutbounds, hops...)
+		}
+	} else {
+		outbound, err := CreateOutboundFromServer(server)
+		if err != nil {
+			return nil, fmt.Errorf("创建出站配置失败: %w", err)
+		}
+		hops, err := chain.build(outbound, server, opts.Servers)
+		if err != nil {
+			return nil, fmt.Errorf("创建前置节点出站失败: %w", err)
+		}
+		proxyOutbounds = append(proxyOutbounds, outbound)
+		chainOutbounds = append(chainOutbounds, hops...)
 	}
+	proxyOutbounds = append(proxyOutbounds, chainOutbounds...)
 
 	// 构建日志配置
 	// 使用 warning 级别，只输出警告和错误，减少无意义的调试日志
@@ -516,19 +1010,304 @@ func CreateXrayConfig(localPort int, server *config.Server, logFilePath ...strin
 		logConfig["access"] = logFilePath[0] // 访问日志也输出到同一文件
 	}
 
+	// 负载均衡策略，默认选择延迟最低的节点
+	balancerStrategy := opts.BalancerStrategy
+	if balancerStrategy == "" {
+		balancerStrategy = config.BalancerStrategyLeastPing
+	}
+
 	// 构建完整配置
 	config := map[string]interface{}{
 		"log": logConfig,
-		"inbounds": []interface{}{
-			inbound,
-		},
-		"outbounds": []interface{}{
-			outbound,
-		},
-		"routing": map[string]interface{}{
-			"rules": []interface{}{},
+		// 启用进程内流量统计（通过 XrayInstance.GetTrafficStats 读取，无需 API 端口）
+		"stats": map[string]interface{}{},
+		"policy": map[string]interface{}{
+			"system": map[string]interface{}{
+				"statsInboundUplink":    true,
+				"statsInboundDownlink":  true,
+				"statsOutboundUplink":   true,
+				"statsOutboundDownlink": true,
+			},
 		},
+		"inbounds": inbounds,
+		"outbounds": append(proxyOutbounds,
+			// 直连出站，用于局域网、国内流量及直连模式
+			map[string]interface{}{
+				"tag":      "direct",
+				"protocol": "freedom",
+			},
+			// 阻断出站，用于拦截来源白名单之外的流量
+			map[string]interface{}{
+				"tag":      "block",
+				"protocol": "blackhole",
+			},
+		),
+		"routing": buildRouting(opts),
+	}
+
+	// 负载均衡：添加负载均衡器和节点探测
+	if len(opts.BalancerServers) > 0 {
+		config["routing"].(map[string]interface{})["balancers"] = []interface{}{
+			map[string]interface{}{
+				"tag":      BalancerTag,
+				"selector": []string{BalancerOutboundTag},
+				"strategy": map[string]interface{}{
+					"type": balancerStrategy,
+				},
+				// 所有节点都不可用时回退到第一个节点
+				"fallbackTag": BalancerOutboundTag + opts.BalancerServers[0].ID,
+			},
+		}
+		config["burstObservatory"] = map[string]interface{}{
+			"subjectSelector": []string{BalancerOutboundTag},
+			"pingConfig": map[string]interface{}{
+				"destination": balancerProbeURL,
+				"interval":    "1m",
+				"sampling":    3,
+				"timeout":     balancerProbeTimeout,
+			},
+		}
 	}
 
 	return json.MarshalIndent(config, "", "  ")
 }
+
+// SkippedServer 无法使用而被跳过的节点及原因
+type SkippedServer struct {
+	Server *config.Server
+	Err    error
+}
+
+// FilterBalancerServers 筛选可加入负载均衡的节点。
+// 为每个节点生成并构建出站配置（含前置节点链），协议或传输方式不受支持、前置节点无效的节点被跳过，
+// 连同原因一起返回。servers 参数与 ConfigOptions.Servers 相同，用于解析前置节点。
+func FilterBalancerServers(candidates []*config.Server, servers []config.Server) ([]*config.Server, []SkippedServer) {
+	var usable []*config.Server
+	var skipped []SkippedServer
+	for _, srv := range candidates {
+		if err := checkServerOutbounds(srv, servers); err != nil {
+			skipped = append(skipped, SkippedServer{Server: srv, Err: err})
+			continue
+		}
+		usable = append(usable, srv)
+	}
+	return usable, skipped
+}
+
+// checkServerOutbounds 检查节点及其前置节点的出站配置能否被 xray-core 构建
+func checkServerOutbounds(srv *config.Server, servers []config.Server) error {
+	outbound, err := CreateOutboundFromServer(srv)
+	if err != nil {
+		return err
+	}
+	outbound["tag"] = BalancerOutboundTag + srv.ID
+	hops, err := newChainBuilder().build(outbound, srv, servers)
+	if err != nil {
+		return fmt.Errorf("前置节点无效: %w", err)
+	}
+	if _, err := buildOutboundHandler(outbound); err != nil {
+		return err
+	}
+	for _, hop := range hops {
+		if _, err := buildOutboundHandler(hop.(map[string]interface{})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chainTagSeq 前置节点出站标签的序号，每份配置分配一个
+var chainTagSeq atomic.Uint64
+
+// chainBuilder 生成一份配置中的前置节点出站。
+// 各实例的 dialerProxy 都通过共用的系统拨号器按标签查找出站（见 dialer.go），
+// 因此每份配置的前置节点出站使用不同的标签前缀，运行中的代理和测速临时实例不会经由对方的前置出站连接。
+type chainBuilder struct {
+	tagPrefix string          // 前置节点出站标签前缀，如 "chain-3-"
+	added     map[string]bool // 已生成的前置节点
+}
+
+// newChainBuilder 为一份新配置创建前置节点出站生成器
+func newChainBuilder() *chainBuilder {
+	return &chainBuilder{
+		tagPrefix: ChainOutboundTag + strconv.FormatUint(chainTagSeq.Add(1), 10) + "-",
+		added:     make(map[string]bool),
+	}
+}
+
+// build 为节点出站生成前置节点链的出站配置。
+// 每一跳出站通过 sockopt.dialerProxy 指向它的前置节点出站，入口节点由本机直接连接。
+// 已生成的前置节点（及其后续链）不会重复生成。
+// 前置节点不存在或存在循环引用时返回错误。
+func (b *chainBuilder) build(outbound map[string]interface{}, server *config.Server, servers []config.Server) ([]interface{}, error) {
+	if server == nil || server.UpstreamID == "" {
+		return nil, nil
+	}
+
+	// 当前节点放在最后，确保以传入的节点配置为准
+	candidates := make([]config.Server, 0, len(servers)+1)
+	candidates = append(candidates, servers...)
+	candidates = append(candidates, *server)
+	chain, err := config.ResolveChain(candidates, server.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []interface{}
+	current := outbound
+	for _, hop := range chain {
+		tag := b.tagPrefix + hop.ID
+		setDialerProxy(current, tag)
+		if b.added[hop.ID] {
+			break
+		}
+		b.added[hop.ID] = true
+
+		hopOutbound, err := CreateOutboundFromServer(hop)
+		if err != nil {
+			return nil, fmt.Errorf("前置节点 %s: %w", hop.Name, err)
+		}
+		hopOutbound["tag"] = tag
+		hops = append(hops, hopOutbound)
+		current = hopOutbound
+	}
+	return hops, nil
+}
+
+// setDialerProxy 设置出站经由指定标签的出站建立连接
+func setDialerProxy(outbound map[string]interface{}, tag string) {
+	streamSettings, ok := outbound["streamSettings"].(map[string]interface{})
+	if !ok {
+		streamSettings = map[string]interface{}{}
+		outbound["streamSettings"] = streamSettings
+	}
+	sockopt, ok := streamSettings["sockopt"].(map[string]interface{})
+	if !ok {
+		sockopt = map[string]interface{}{}
+		streamSettings["sockopt"] = sockopt
+	}
+	sockopt["dialerProxy"] = tag
+}
+
+// privateCIDRs 局域网及保留地址段（geoip.dat 不存在时使用）
+var privateCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// hasAsset 检查 xray 资源文件（geoip.dat / geosite.dat）是否存在
+func hasAsset(file string) bool {
+	_, err := os.Stat(platform.GetAssetLocation(file))
+	return err == nil
+}
+
+// loopbackSources 本机回环地址，启用来源白名单时始终允许
+var loopbackSources = []string{"127.0.0.0/8", "::1/128"}
+
+// buildRouting 根据路由模式构建路由配置
+// 最后一条规则始终兜底匹配所有流量，保证结果不依赖出站顺序
+// 来源白名单非空时，所有规则仅匹配白名单来源，其他来源由最后一条规则路由到 block 出站
+func buildRouting(opts ConfigOptions) map[string]interface{} {
+	mode := opts.RoutingMode
+	allowedSources := opts.AllowedSources
+	rules := []interface{}{}
+	finalTag := "proxy"
+	domainStrategy := "AsIs"
+
+	switch mode {
+	case config.RoutingModeDirect:
+		finalTag = "direct"
+
+	case config.RoutingModeSmart:
+		hasGeoIP := hasAsset("geoip.dat")
+		hasGeoSite := hasAsset("geosite.dat")
+		// 域名未命中规则时解析为 IP 再匹配 geoip 规则
+		domainStrategy = "IPIfNonMatch"
+
+		// 局域网直连
+		rules = append(rules, privateRule(hasGeoIP))
+		if hasGeoSite {
+			rules = append(rules, map[string]interface{}{
+				"type":        "field",
+				"domain":      []string{"geosite:private"},
+				"outboundTag": "direct",
+			})
+		}
+
+		// 国内域名直连
+		cnDomains := []string{"domain:cn"}
+		if hasGeoSite {
+			cnDomains = []string{"geosite:cn"}
+		}
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"domain":      cnDomains,
+			"outboundTag": "direct",
+		})
+
+		// 国内 IP 直连
+		if hasGeoIP {
+			rules = append(rules, map[string]interface{}{
+				"type":        "field",
+				"ip":          []string{"geoip:cn"},
+				"outboundTag": "direct",
+			})
+		}
+
+	default:
+		// 全局模式：局域网仍然直连，其他流量走代理
+		rules = append(rules, privateRule(hasAsset("geoip.dat")))
+	}
+
+	// 兜底规则（负载均衡模式下代理流量交给负载均衡器）
+	finalRule := map[string]interface{}{
+		"type":    "field",
+		"network": "tcp,udp",
+	}
+	if finalTag == "proxy" && len(opts.BalancerServers) > 0 {
+		finalRule["balancerTag"] = BalancerTag
+	} else {
+		finalRule["outboundTag"] = finalTag
+	}
+	rules = append(rules, finalRule)
+
+	// 来源白名单：为每条规则加上来源限制，未命中的来源全部阻断
+	if len(allowedSources) > 0 {
+		sources := append(append([]string{}, loopbackSources...), allowedSources...)
+		for _, rule := range rules {
+			rule.(map[string]interface{})["source"] = sources
+		}
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"network":     "tcp,udp",
+			"outboundTag": "block",
+		})
+	}
+
+	return map[string]interface{}{
+		"domainStrategy": domainStrategy,
+		"rules":          rules,
+	}
+}
+
+// privateRule 构建局域网地址直连规则
+func privateRule(hasGeoIP bool) map[string]interface{} {
+	ips := privateCIDRs
+	if hasGeoIP {
+		ips = []string{"geoip:private"}
+	}
+	return map[string]interface{}{
+		"type":        "field",
+		"ip":          ips,
+		"outboundTag": "direct",
+	}
+}